@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
@@ -12,60 +19,96 @@ import (
 	"github.com/marcelofranco/webapp-go-demo/internal/driver"
 	"github.com/marcelofranco/webapp-go-demo/internal/handlers"
 	"github.com/marcelofranco/webapp-go-demo/internal/helpers"
+	"github.com/marcelofranco/webapp-go-demo/internal/logging"
+	"github.com/marcelofranco/webapp-go-demo/internal/migrations"
 	"github.com/marcelofranco/webapp-go-demo/internal/models"
 	"github.com/marcelofranco/webapp-go-demo/internal/render"
+	"github.com/marcelofranco/webapp-go-demo/internal/repository/dbrepo"
+	"github.com/marcelofranco/webapp-go-demo/internal/sessionstore"
+	"github.com/marcelofranco/webapp-go-demo/internal/tokens"
 )
 
-const portNumber = ":8085"
-
 var app config.AppConfig
 var session *scs.SessionManager
-var infoLog *log.Logger
-var errorLog *log.Logger
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	db, err := run()
+	db, err := run(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.SQL.Close()
 
-	defer close(app.MailChan)
-	log.Println("Starting mail service")
-	ListenForMail()
-
-	log.Printf("Starting application on port %s\n", portNumber)
+	app.Logger.Info("starting mail service")
+	stopMail := StartMailQueue(dbrepo.NewPostgresRepo(&app, db.SQL))
 
 	srv := &http.Server{
-		Addr:    portNumber,
+		Addr:    app.Addr,
 		Handler: routes(&app),
 	}
 
-	err = srv.ListenAndServe()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	if err != nil {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	app.Logger.Info("starting application", "addr", app.Addr)
+	app.SetReady(true)
+
+	select {
+	case err := <-serveErr:
 		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	// a second signal stops the app right away
+	stop()
+
+	shutdown(srv, stopMail)
+}
+
+// shutdown stops the app without losing requests or mail: it reports not ready
+// first so that the load balancer stops sending requests, waits for the ones in
+// flight and then for the mails being sent
+func shutdown(srv *http.Server, stopMail func()) {
+	app.Logger.Info("shutting down")
+	app.SetReady(false)
+	time.Sleep(app.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), app.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		app.Logger.Error("requests still running were cut off", "error", err)
+	}
+
+	stopMail()
+	if store, ok := session.Store.(*sessionstore.PostgresStore); ok {
+		store.StopCleanup()
 	}
+	app.Logger.Info("stopped")
 }
 
-func run() (*driver.DB, error) {
+func run(args []string) (*driver.DB, error) {
+	if err := loadSettings("webapp", args); err != nil {
+		return nil, err
+	}
+
 	gob.Register(models.Reservation{})
 	gob.Register(models.User{})
 	gob.Register(models.Room{})
 	gob.Register(models.Restriction{})
 	gob.Register(models.RoomRestriction{})
-
-	mailChan := make(chan models.MailData)
-	app.MailChan = mailChan
-
-	app.InProduction = false
-
-	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	app.InfoLog = infoLog
-
-	errorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-	app.ErrorLog = errorLog
+	gob.Register(map[string]int{})
 
 	session = scs.New()
 	session.Lifetime = 24 * time.Hour
@@ -75,13 +118,25 @@ func run() (*driver.DB, error) {
 	app.Session = session
 
 	// connect to database
-	log.Println("Connecting to database...")
-	dns := os.Getenv("DATABASE_DSN")
-	db, err := driver.ConnectSQL(dns)
+	app.Logger.Info("connecting to database")
+	db, err := driver.ConnectSQL(app.DatabaseDSN)
 	if err != nil {
 		log.Fatal("Cannot connect to database! Dying...")
 	}
-	log.Println("Connected to database!")
+	app.Logger.Info("connected to database")
+
+	// the queries expect the latest schema, so an outdated database fails here rather than at request time
+	pending, err := migrations.Pending(context.Background(), db.SQL)
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) > 0 {
+		return nil, fmt.Errorf("%d database migrations are pending, run \"webapp migrate up\"", len(pending))
+	}
+
+	if app.SessionStore == "postgres" {
+		session.Store = sessionstore.NewPostgres(db.SQL, app.SessionCleanupInterval, app.Logger)
+	}
 
 	tc, err := render.CreateTemplateCache()
 	if err != nil {
@@ -91,7 +146,15 @@ func run() (*driver.DB, error) {
 
 	app.TemplateCache = tc
 
-	app.UseCache = false
+	mtc, err := render.CreateMailTemplateCache()
+	if err != nil {
+		return nil, err
+	}
+	if len(mtc) == 0 {
+		return nil, errors.New("no mail templates found in ./email-templates")
+	}
+
+	app.MailTemplateCache = mtc
 
 	repo := handlers.NewRepo(&app, db)
 	handlers.NewHandlers(repo)
@@ -100,3 +163,41 @@ func run() (*driver.DB, error) {
 
 	return db, nil
 }
+
+// loadSettings fills app.Settings from the config file, the environment and args,
+// then sets up the logger and logs them once they are valid
+func loadSettings(name string, args []string) error {
+	rest, err := app.Settings.Load(name, args, os.Getenv)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("unexpected arguments %q", rest)
+	}
+	if err := app.Validate(); err != nil {
+		return err
+	}
+
+	level, err := logging.ParseLevel(app.LogLevel)
+	if err != nil {
+		return err
+	}
+	app.Logger, err = logging.New(os.Stdout, app.LogFormat, level)
+	if err != nil {
+		return err
+	}
+	// what is still logged with the log package goes through it as well
+	slog.SetDefault(app.Logger)
+
+	app.Logger.Info("settings loaded", "settings", app.Summary())
+
+	if app.SigningKey == "" {
+		// fine in development, but the links mailed stop working at the next start
+		app.SigningKey, _, err = tokens.New()
+		if err != nil {
+			return err
+		}
+		app.Logger.Warn("signing-key is not set, using a random one")
+	}
+	return nil
+}
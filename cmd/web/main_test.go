@@ -3,7 +3,7 @@ package main
 import "testing"
 
 func TestRun(t *testing.T) {
-	_, err := run()
+	_, err := run(nil)
 	if err != nil {
 		t.Error("failed run()")
 	}
@@ -1,11 +1,188 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
 	"net/http"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/justinas/nosurf"
+	"github.com/marcelofranco/webapp-go-demo/internal/handlers"
+	"github.com/marcelofranco/webapp-go-demo/internal/helpers"
+	"github.com/marcelofranco/webapp-go-demo/internal/i18n"
+	"github.com/marcelofranco/webapp-go-demo/internal/logging"
+	"github.com/marcelofranco/webapp-go-demo/internal/metrics"
 )
 
+// requestIDPattern matches the request IDs kept from the X-Request-ID header of the load balancer
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type accessLogKey struct{}
+
+// accessLogEntry holds what is known of a request only once it reaches the session
+type accessLogEntry struct {
+	userID int
+}
+
+// RequestLog gives every request an ID, sent back in the X-Request-ID header, and a
+// logger carrying it for the handlers, then writes the access log entry of the request
+func RequestLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		logger := app.Logger.With("request_id", id)
+		entry := &accessLogEntry{}
+		ctx := logging.NewContext(r.Context(), logger)
+		ctx = context.WithValue(ctx, accessLogKey{}, entry)
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		logger.Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"bytes", ww.BytesWritten(),
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+			"user_id", entry.userID,
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
+
+// CheckSession signs the user out of a session older than the last password reset
+func CheckSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := session.GetInt(r.Context(), "user_id")
+		if userID == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := handlers.Repo.DB.GetUserByID(r.Context(), userID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			// the user stays logged in while the database is unavailable
+			logging.FromContext(r.Context()).Error("can't check session", "user_id", userID, "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err != nil || user.SessionVersion != session.GetInt(r.Context(), "session_version") {
+			_ = session.Destroy(r.Context())
+			session.Put(r.Context(), "warning", "You have been signed out, log in again")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// metricsMethods are the request methods counted under their own name
+var metricsMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true,
+	http.MethodPut: true, http.MethodPatch: true, http.MethodDelete: true,
+	http.MethodConnect: true, http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// metricsMethod returns the method of a request to count it under, any method a client
+// makes up being counted as OTHER so that the number of series stays bounded
+func metricsMethod(method string) string {
+	if metricsMethods[method] {
+		return method
+	}
+	return "OTHER"
+}
+
+// RecordMetrics counts the requests and their duration by route
+func RecordMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		// the pattern is known once the router matched the request
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		metrics.ObserveRequest(metricsMethod(r.Method), route, status, time.Since(start))
+	})
+}
+
+// LogUser adds the logged in user to the logs of the request, which needs the session loaded
+func LogUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry, _ := r.Context().Value(accessLogKey{}).(*accessLogEntry)
+		if entry == nil {
+			entry = &accessLogEntry{}
+		}
+
+		entry.userID = session.GetInt(r.Context(), "user_id")
+		if entry.userID != 0 {
+			logger := logging.FromContext(r.Context()).With("user_id", entry.userID)
+			r = r.WithContext(logging.NewContext(r.Context(), logger))
+		}
+
+		next.ServeHTTP(w, r)
+
+		// the user who just logged in
+		if userID := session.GetInt(r.Context(), "user_id"); userID != 0 {
+			entry.userID = userID
+		}
+	})
+}
+
+// localeCookie keeps the language chosen with the switcher of the pages
+const localeCookie = "lang"
+
+// Locale finds the language of the request, which needs the session loaded: the one chosen
+// with ?lang=, then the one of the logged in user or chosen before, then the preferred one
+// of the browser which the site is translated to
+func Locale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale := r.URL.Query().Get("lang")
+		if i18n.IsSupported(locale) {
+			session.Put(r.Context(), "locale", locale)
+			http.SetCookie(w, &http.Cookie{
+				Name:     localeCookie,
+				Value:    locale,
+				Path:     "/",
+				MaxAge:   365 * 24 * 60 * 60,
+				HttpOnly: true,
+				Secure:   app.InProduction,
+				SameSite: http.SameSiteLaxMode,
+			})
+		} else if locale = session.GetString(r.Context(), "locale"); !i18n.IsSupported(locale) {
+			if c, err := r.Cookie(localeCookie); err == nil && i18n.IsSupported(c.Value) {
+				locale = c.Value
+			} else {
+				locale = i18n.Match(r.Header.Get("Accept-Language"))
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(i18n.WithLocale(r.Context(), locale)))
+	})
+}
+
 // NoSurf adds csrf protection to all post requests
 func NoSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
@@ -24,3 +201,63 @@ func NoSurf(next http.Handler) http.Handler {
 func SessionLoad(next http.Handler) http.Handler {
 	return session.LoadAndSave(next)
 }
+
+// Auth redirects to the home page when no user is logged in
+func Auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !helpers.IsAuthenticated(r) {
+			session.Put(r.Context(), "error", "Log in first!")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole redirects to the home page when the logged in user
+// does not have at least the given access level
+func RequireRole(accessLevel int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !helpers.HasRole(r, accessLevel) {
+				session.Put(r.Context(), "error", "You are not allowed to access this page")
+				http.Redirect(w, r, "/", http.StatusSeeOther)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// APIKey answers 401 to API requests without the "Authorization: Bearer <key>" header
+// matching the configured API key, and to every request when no key is configured
+func APIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hasBearer(r, app.APIKey) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			helpers.WriteAPIError(w, http.StatusUnauthorized, "Missing or invalid API key", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// MetricsToken answers 401 to requests without the "Authorization: Bearer <token>" header
+// matching the configured metrics token, and to every request when no token is configured
+func MetricsToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hasBearer(r, app.MetricsToken) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hasBearer reports whether the request has the bearer token key, which is never the case
+// when key is empty
+func hasBearer(r *http.Request, key string) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return key != "" && subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1
+}
@@ -1,8 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/marcelofranco/webapp-go-demo/internal/i18n"
+	"github.com/marcelofranco/webapp-go-demo/internal/logging"
 )
 
 func TestNoSurf(t *testing.T) {
@@ -26,3 +34,254 @@ func TestSessionLoad(t *testing.T) {
 		t.Errorf("type is not http.Handler but is %t", v)
 	}
 }
+
+func TestAuth(t *testing.T) {
+	var th myHandler
+	h := Auth(&th)
+	switch v := h.(type) {
+	case http.Handler:
+		// do nothing
+	default:
+		t.Errorf("type is not http.Handler but is %t", v)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	var th myHandler
+	h := RequireRole(1)(&th)
+	switch v := h.(type) {
+	case http.Handler:
+		// do nothing
+	default:
+		t.Errorf("type is not http.Handler but is %t", v)
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	var th myHandler
+	h := APIKey(&th)
+
+	tests := []struct {
+		name          string
+		configuredKey string
+		header        string
+		expectedCode  int
+	}{
+		{"valid-key", "secret", "Bearer secret", http.StatusOK},
+		{"wrong-key", "secret", "Bearer guess", http.StatusUnauthorized},
+		{"missing-key", "secret", "", http.StatusUnauthorized},
+		{"no-key-configured", "", "Bearer ", http.StatusUnauthorized},
+	}
+
+	for _, e := range tests {
+		app.APIKey = e.configuredKey
+
+		req := httptest.NewRequest("GET", "/api/v1/reservations/1", nil)
+		if e.header != "" {
+			req.Header.Set("Authorization", e.header)
+		}
+		rr := httptest.NewRecorder()
+
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedCode, rr.Code)
+		}
+	}
+
+	app.APIKey = ""
+}
+
+func TestMetricsToken(t *testing.T) {
+	var th myHandler
+	h := MetricsToken(&th)
+
+	tests := []struct {
+		name            string
+		configuredToken string
+		header          string
+		expectedCode    int
+	}{
+		{"valid-token", "secret", "Bearer secret", http.StatusOK},
+		{"wrong-token", "secret", "Bearer guess", http.StatusUnauthorized},
+		{"missing-token", "secret", "", http.StatusUnauthorized},
+		{"api-key", "secret", "Bearer api-key", http.StatusUnauthorized},
+		{"no-token-configured", "", "Bearer ", http.StatusUnauthorized},
+	}
+
+	app.APIKey = "api-key"
+	for _, e := range tests {
+		app.MetricsToken = e.configuredToken
+
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if e.header != "" {
+			req.Header.Set("Authorization", e.header)
+		}
+		rr := httptest.NewRecorder()
+
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedCode, rr.Code)
+		}
+	}
+
+	app.APIKey = ""
+	app.MetricsToken = ""
+}
+
+func TestRequestLog(t *testing.T) {
+	var buf bytes.Buffer
+	app.Logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	defer func() { app.Logger = nil }()
+
+	h := RequestLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Info("in handler")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tests := []struct {
+		name       string
+		header     string
+		expectedID string
+	}{
+		{"new-id", "", ""},
+		{"load-balancer-id", "lb-1234.5", "lb-1234.5"},
+		{"invalid-id", "<script>", ""},
+	}
+
+	for _, e := range tests {
+		buf.Reset()
+
+		req := httptest.NewRequest("GET", "/rooms", nil)
+		if e.header != "" {
+			req.Header.Set("X-Request-ID", e.header)
+		}
+		rr := httptest.NewRecorder()
+
+		h.ServeHTTP(rr, req)
+
+		id := rr.Header().Get("X-Request-ID")
+		if e.expectedID != "" && id != e.expectedID {
+			t.Errorf("%s: expected request ID %s but got %s", e.name, e.expectedID, id)
+		}
+		if e.expectedID == "" && (!requestIDPattern.MatchString(id) || id == e.header) {
+			t.Errorf("%s: expected a new request ID but got %q", e.name, id)
+		}
+
+		var lines []map[string]interface{}
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var line map[string]interface{}
+			if err := dec.Decode(&line); err != nil {
+				t.Fatal(err)
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) != 2 {
+			t.Fatalf("%s: expected 2 log entries but got %d", e.name, len(lines))
+		}
+		for _, line := range lines {
+			if line["request_id"] != id {
+				t.Errorf("%s: expected request_id %s on %v", e.name, id, line)
+			}
+		}
+		if access := lines[1]; access["status"] != float64(http.StatusTeapot) || access["path"] != "/rooms" {
+			t.Errorf("%s: unexpected access log entry %v", e.name, access)
+		}
+	}
+}
+
+func TestLogUser(t *testing.T) {
+	var th myHandler
+	h := LogUser(&th)
+	switch v := h.(type) {
+	case http.Handler:
+		// do nothing
+	default:
+		t.Errorf("type is not http.Handler but is %t", v)
+	}
+}
+
+func TestRecordMetrics(t *testing.T) {
+	var th myHandler
+	h := RecordMetrics(&th)
+	switch v := h.(type) {
+	case http.Handler:
+		// do nothing
+	default:
+		t.Errorf("type is not http.Handler but is %t", v)
+	}
+}
+
+func TestMetricsMethod(t *testing.T) {
+	tests := []struct {
+		method   string
+		expected string
+	}{
+		{"GET", "GET"},
+		{"POST", "POST"},
+		{"OPTIONS", "OPTIONS"},
+		{"get", "OTHER"},
+		{"PROPFIND", "OTHER"},
+		{"X-RANDOM-1234", "OTHER"},
+	}
+
+	for _, e := range tests {
+		if got := metricsMethod(e.method); got != e.expected {
+			t.Errorf("%s: expected %s but got %s", e.method, e.expected, got)
+		}
+	}
+}
+
+func TestLocale(t *testing.T) {
+	session = scs.New()
+	defer func() { session = nil }()
+
+	var locale string
+	h := session.LoadAndSave(Locale(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale = i18n.FromContext(r.Context())
+	})))
+
+	tests := []struct {
+		name           string
+		url            string
+		cookie         string
+		acceptLanguage string
+		expectedLocale string
+		expectedCookie string
+	}{
+		{"default", "/", "", "", "en", ""},
+		{"browser", "/", "", "pt-BR,pt;q=0.9,en;q=0.8", "pt", ""},
+		{"browser-unsupported", "/", "", "de-DE,de;q=0.9", "en", ""},
+		{"cookie", "/", "es", "pt-BR", "es", ""},
+		{"unsupported-cookie", "/", "de", "pt-BR", "pt", ""},
+		{"switcher", "/rooms?lang=es", "pt", "pt-BR", "es", "es"},
+		{"unsupported-switcher", "/rooms?lang=de", "", "", "en", ""},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", e.url, nil)
+		if e.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: localeCookie, Value: e.cookie})
+		}
+		req.Header.Set("Accept-Language", e.acceptLanguage)
+		rr := httptest.NewRecorder()
+
+		h.ServeHTTP(rr, req)
+
+		if locale != e.expectedLocale {
+			t.Errorf("%s: expected locale %s but got %s", e.name, e.expectedLocale, locale)
+		}
+
+		var cookie string
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == localeCookie {
+				cookie = c.Value
+			}
+		}
+		if cookie != e.expectedCookie {
+			t.Errorf("%s: expected cookie %q but got %q", e.name, e.expectedCookie, cookie)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/driver"
+	"github.com/marcelofranco/webapp-go-demo/internal/migrations"
+)
+
+const migrateUsage = "usage: webapp migrate [flags] up|down|status"
+
+// migrate runs the migrate subcommand against the configured database
+func migrate(args []string) error {
+	args, err := app.Settings.Load("webapp migrate", args, os.Getenv)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+	if err := app.Validate(); err != nil {
+		return err
+	}
+
+	db, err := driver.ConnectSQL(app.DatabaseDSN)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		done, err := migrations.Up(ctx, db.SQL)
+		for _, m := range done {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			fmt.Println("database is up to date")
+		}
+	case "down":
+		m, reverted, err := migrations.Down(ctx, db.SQL)
+		if err != nil {
+			return err
+		}
+		if !reverted {
+			fmt.Println("no migration to revert")
+			return nil
+		}
+		fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+	case "status":
+		statuses, err := migrations.GetStatus(ctx, db.SQL)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return tw.Flush()
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
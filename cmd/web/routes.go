@@ -7,39 +7,119 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/marcelofranco/webapp-go-demo/internal/config"
 	"github.com/marcelofranco/webapp-go-demo/internal/handlers"
+	"github.com/marcelofranco/webapp-go-demo/internal/models"
 )
 
 func routes(app *config.AppConfig) http.Handler {
 	mux := chi.NewRouter()
 
+	mux.Use(RequestLog)
+	mux.Use(RecordMetrics)
 	mux.Use(middleware.Recoverer)
-	mux.Use(NoSurf)
-	mux.Use(SessionLoad)
-
-	mux.Get("/", handlers.Repo.Home)
-	mux.Get("/about", handlers.Repo.About)
-	mux.Get("/generals-quarters", handlers.Repo.Generals)
-	mux.Get("/majors-suite", handlers.Repo.Majors)
-
-	mux.Get("/search-availability", handlers.Repo.Availability)
-	mux.Post("/search-availability", handlers.Repo.PostAvailability)
-	mux.Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
-	mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
-	mux.Get("/book-room", handlers.Repo.BookRoom)
-
-	mux.Get("/contact", handlers.Repo.Contact)
-	mux.Get("/make-reservation", handlers.Repo.Reservation)
-	mux.Post("/make-reservation", handlers.Repo.PostReservation)
-	mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
-	mux.Get("/booked-rooms", handlers.Repo.BookedRooms)
-
-	mux.Get("/sign-up", handlers.Repo.SignUp)
-	mux.Post("/sign-up", handlers.Repo.PostSignUp)
-	mux.Post("/signin", handlers.Repo.Signin)
-	mux.Get("/logout", handlers.Repo.Logout)
+
+	mux.Get("/healthz", handlers.Repo.Healthz)
+	mux.Get("/readyz", handlers.Repo.Readyz)
+	mux.With(MetricsToken).Get("/metrics", handlers.Repo.Metrics)
+
+	// the JSON API authenticates its clients with an API key, so it has no session nor CSRF token
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.NotFound(handlers.Repo.APINotFound)
+		mux.MethodNotAllowed(handlers.Repo.APIMethodNotAllowed)
+
+		mux.Get("/rooms", handlers.Repo.APIRooms)
+		mux.Get("/rooms/{id}/availability", handlers.Repo.APIRoomAvailability)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(APIKey)
+
+			mux.Post("/reservations", handlers.Repo.APIPostReservation)
+			mux.Get("/reservations/{id}", handlers.Repo.APIReservation)
+		})
+	})
 
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
+	mux.Group(func(mux chi.Router) {
+		mux.Use(NoSurf)
+		mux.Use(SessionLoad)
+		mux.Use(CheckSession)
+		mux.Use(LogUser)
+		mux.Use(Locale)
+
+		mux.Get("/", handlers.Repo.Home)
+		mux.Get("/about", handlers.Repo.About)
+		mux.Get("/rooms", handlers.Repo.Rooms)
+		mux.Get("/rooms/{slug}", handlers.Repo.Room)
+		// the rooms used to have their own pages
+		mux.Handle("/generals-quarters", http.RedirectHandler("/rooms/generals-quarters", http.StatusMovedPermanently))
+		mux.Handle("/majors-suite", http.RedirectHandler("/rooms/majors-suite", http.StatusMovedPermanently))
+
+		mux.Get("/search-availability", handlers.Repo.Availability)
+		mux.Post("/search-availability", handlers.Repo.PostAvailability)
+		mux.Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
+		mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
+		mux.Get("/book-room", handlers.Repo.BookRoom)
+
+		mux.Get("/contact", handlers.Repo.Contact)
+		mux.Get("/make-reservation", handlers.Repo.Reservation)
+		mux.Post("/make-reservation", handlers.Repo.PostReservation)
+		mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
+		mux.Get("/find-reservation", handlers.Repo.FindReservation)
+		mux.Post("/find-reservation", handlers.Repo.PostFindReservation)
+		mux.Get("/my-reservation", handlers.Repo.MyReservation)
+		mux.Post("/my-reservation/dates", handlers.Repo.PostChangeReservation)
+		mux.Post("/my-reservation/cancel", handlers.Repo.PostCancelReservation)
+		mux.With(Auth).Get("/booked-rooms", handlers.Repo.BookedRooms)
+		mux.With(Auth).Get("/profile", handlers.Repo.Profile)
+		mux.With(Auth).Post("/profile", handlers.Repo.PostProfile)
+		mux.With(Auth).Post("/profile/password", handlers.Repo.PostChangePassword)
+
+		mux.Get("/sign-up", handlers.Repo.SignUp)
+		mux.Post("/sign-up", handlers.Repo.PostSignUp)
+		mux.Post("/signin", handlers.Repo.Signin)
+		mux.Get("/logout", handlers.Repo.Logout)
+		mux.Get("/forgot-password", handlers.Repo.ForgotPassword)
+		mux.Post("/forgot-password", handlers.Repo.PostForgotPassword)
+		mux.Get("/reset-password", handlers.Repo.ResetPassword)
+		mux.Post("/reset-password", handlers.Repo.PostResetPassword)
+		mux.Get("/verify-email", handlers.Repo.VerifyEmail)
+		mux.With(Auth).Post("/verify-email/resend", handlers.Repo.PostResendVerification)
+		mux.Get("/ical/{token}.ics", handlers.Repo.RoomCalendar)
+
+		mux.Route("/admin", func(mux chi.Router) {
+			mux.Use(Auth)
+			mux.Use(RequireRole(models.AccessLevelStaff))
+
+			mux.Get("/dashboard", handlers.Repo.AdminDashboard)
+			mux.Get("/reservations-new", handlers.Repo.AdminNewReservations)
+			mux.Get("/reservations-all", handlers.Repo.AdminAllReservations)
+			mux.Get("/reservations/{src}/{id}/show", handlers.Repo.AdminShowReservation)
+			mux.Post("/reservations/{src}/{id}/show", handlers.Repo.AdminPostShowReservation)
+			mux.Post("/process-reservation/{src}/{id}", handlers.Repo.AdminProcessReservation)
+			mux.Post("/delete-reservation/{src}/{id}", handlers.Repo.AdminDeleteReservation)
+			mux.Get("/mail", handlers.Repo.AdminMail)
+			mux.Post("/mail/{id}/resend", handlers.Repo.AdminResendMail)
+			mux.Get("/security", handlers.Repo.AdminSecurity)
+			mux.Post("/lockouts/{id}/lift", handlers.Repo.AdminLiftLockout)
+
+			mux.Group(func(mux chi.Router) {
+				mux.Use(RequireRole(models.AccessLevelOwner))
+
+				mux.Get("/reservations-calendar", handlers.Repo.AdminReservationsCalendar)
+				mux.Post("/reservations-calendar", handlers.Repo.AdminPostReservationsCalendar)
+
+				mux.Get("/rooms", handlers.Repo.AdminRooms)
+				mux.Get("/rooms/{id}", handlers.Repo.AdminRoom)
+				mux.Post("/rooms/{id}", handlers.Repo.AdminPostRoom)
+				mux.Post("/rooms/{id}/delete", handlers.Repo.AdminDeleteRoom)
+				mux.Post("/rooms/{id}/seasons", handlers.Repo.AdminPostSeason)
+				mux.Post("/rooms/{id}/seasons/{season}/delete", handlers.Repo.AdminDeleteSeason)
+				mux.Post("/rooms/{id}/ical-token", handlers.Repo.AdminPostRoomCalendarToken)
+				mux.Post("/rooms/{id}/ical-import", handlers.Repo.AdminPostRoomCalendarImport)
+			})
+		})
+	})
+
 	return mux
 }
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"net/http"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
@@ -19,3 +22,35 @@ func TestRoutes(t *testing.T) {
 		t.Errorf("expected type chi.Mux got %t", v)
 	}
 }
+
+func TestRoutes_APIWithoutSession(t *testing.T) {
+	var app config.AppConfig
+
+	mux := routes(&app).(*chi.Mux)
+
+	// the API is called without a session, the site always loads one
+	sessionLoad := reflect.ValueOf(SessionLoad).Pointer()
+	err := chi.Walk(mux, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		withSession := false
+		for _, mw := range middlewares {
+			if reflect.ValueOf(mw).Pointer() == sessionLoad {
+				withSession = true
+			}
+		}
+
+		// chi.Walk leaves out the middlewares of a group for the routers mounted in it, like /admin
+		isAPI := strings.HasPrefix(route, "/api/")
+		site := !isAPI && !strings.HasPrefix(route, "/admin/") &&
+			route != "/healthz" && route != "/readyz" && route != "/metrics" && route != "/static/*"
+		if isAPI && withSession {
+			t.Errorf("%s %s: expected no session", method, route)
+		}
+		if site && !withSession {
+			t.Errorf("%s %s: expected a session", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,35 +1,59 @@
 package main
 
 import (
-	"fmt"
-	"io/ioutil"
-	"strings"
+	"context"
 	"time"
 
+	"github.com/marcelofranco/webapp-go-demo/internal/mailer"
+	"github.com/marcelofranco/webapp-go-demo/internal/metrics"
 	"github.com/marcelofranco/webapp-go-demo/internal/models"
+	"github.com/marcelofranco/webapp-go-demo/internal/repository"
 	mail "github.com/xhit/go-simple-mail/v2"
 )
 
-func ListenForMail() {
+// StartMailQueue starts the queue that sends the mail handlers store in the outbox, so
+// they never wait on the SMTP server. The function it returns stops the queue, waiting
+// for the mails being sent; it is called once no handler is running anymore
+func StartMailQueue(repo repository.DatabaseRepo) (stop func()) {
+	queue := mailer.New(repo, sendMail)
+	queue.Logger = app.Logger
+	app.MailQueue = queue
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
 	go func() {
-		for {
-			msg := <-app.MailChan
-			sendMail(msg)
-		}
+		queue.Run(ctx)
+		close(done)
 	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
 }
 
-func sendMail(m models.MailData) {
+// sendMail sends one mail through the SMTP server
+func sendMail(m models.MailData) (err error) {
+	defer func() {
+		if err != nil {
+			metrics.MailFailed.Inc()
+		} else {
+			metrics.MailSent.Inc()
+		}
+	}()
+
 	server := mail.NewSMTPClient()
-	server.Host = "localhost"
-	server.Port = 1025
+	server.Host = app.SMTPHost
+	server.Port = app.SMTPPort
+	server.Username = app.SMTPUsername
+	server.Password = app.SMTPPassword
 	server.KeepAlive = false
 	server.ConnectTimeout = 10 * time.Second
 	server.SendTimeout = 10 * time.Second
 
 	client, err := server.Connect()
 	if err != nil {
-		app.ErrorLog.Println(err)
+		return err
 	}
 
 	email := mail.NewMSG()
@@ -37,22 +61,13 @@ func sendMail(m models.MailData) {
 		AddTo(m.To).
 		SetSubject(m.Subject)
 
-	if m.Template == "" {
-		email.SetBody(mail.TextHTML, m.Content)
+	// the plain text comes first, mail clients show the last part they can
+	if m.TextContent != "" {
+		email.SetBody(mail.TextPlain, m.TextContent)
+		email.AddAlternative(mail.TextHTML, m.Content)
 	} else {
-		data, err := ioutil.ReadFile(fmt.Sprintf("./email-templates/%s", m.Template))
-		if err != nil {
-			app.ErrorLog.Println(err)
-		}
-		mailTemplate := string(data)
-		msgToSend := strings.Replace(mailTemplate, "[%body%]", m.Content, 1)
-		email.SetBody(mail.TextHTML, msgToSend)
+		email.SetBody(mail.TextHTML, m.Content)
 	}
 
-	err = email.Send(client)
-	if err != nil {
-		app.ErrorLog.Println(err)
-	} else {
-		app.InfoLog.Println("Email sent!")
-	}
+	return email.Send(client)
 }
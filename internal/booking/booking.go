@@ -0,0 +1,57 @@
+// Package booking holds the rules every stay follows, whatever the room and the way it is
+// booked. The minimum stay of the rooms and seasons is checked when the stay is priced
+package booking
+
+import (
+	"time"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/forms"
+)
+
+// Rules are the limits of the stays guests can book
+type Rules struct {
+	MinNights     int
+	MaxNights     int           // no limit when 0
+	HorizonDays   int           // how many days ahead a stay can start, no limit when 0
+	SameDayCutoff time.Duration // time of day until which stays starting the same day are taken
+}
+
+// Check parses the arrival and departure of a stay from startField and endField, written
+// like forms.DateLayout, and checks them against the rules at now. Problems are added to
+// the form as errors of the field they come from, so the dates are only usable when the
+// form is valid. Dates are days of the calendar of now
+func (rules Rules) Check(form *forms.Form, startField, endField string, now time.Time) (time.Time, time.Time) {
+	form.Required(startField, endField)
+	if !form.IsDate(startField) || !form.IsDate(endField) || !form.Has(startField) || !form.Has(endField) {
+		return time.Time{}, time.Time{}
+	}
+	start, end := form.Date(startField), form.Date(endField)
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	sinceMidnight := now.Sub(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()))
+	switch {
+	case start.Before(today):
+		form.Errors.Add(startField, "The arrival date can't be in the past")
+	case start.Equal(today) && sinceMidnight >= rules.SameDayCutoff:
+		form.Errors.Add(startField, "It is too late to book a stay starting today")
+	case rules.HorizonDays > 0 && start.After(today.AddDate(0, 0, rules.HorizonDays)):
+		form.Errors.Add(startField, "Stays can be booked up to %d days ahead", rules.HorizonDays)
+	}
+
+	n := nights(start, end)
+	switch {
+	case n < 1:
+		form.Errors.Add(endField, "The departure date must be after the arrival date")
+	case n < rules.MinNights:
+		form.Errors.Add(endField, "The stay must be at least %d nights", rules.MinNights)
+	case rules.MaxNights > 0 && n > rules.MaxNights:
+		form.Errors.Add(endField, "The stay can be at most %d nights", rules.MaxNights)
+	}
+
+	return start, end
+}
+
+// nights returns the number of nights from start to end, negative when end is before start
+func nights(start, end time.Time) int {
+	return int(end.Sub(start).Hours() / 24)
+}
@@ -0,0 +1,78 @@
+package booking
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/forms"
+)
+
+var rules = Rules{
+	MinNights:     2,
+	MaxNights:     14,
+	HorizonDays:   365,
+	SameDayCutoff: 18 * time.Hour,
+}
+
+// now is a Monday afternoon, the time of day being the one of its own time zone
+var now = time.Date(2050, 1, 3, 15, 0, 0, 0, time.FixedZone("UTC-3", -3*60*60))
+
+var checkTests = []struct {
+	name       string
+	start      string
+	end        string
+	now        time.Time
+	startError string
+	endError   string
+}{
+	{"valid", "2050-01-10", "2050-01-12", now, "", ""},
+	{"today-before-cutoff", "2050-01-03", "2050-01-05", now, "", ""},
+	{"today-after-cutoff", "2050-01-03", "2050-01-05", now.Add(4 * time.Hour), "It is too late to book a stay starting today", ""},
+	{"past", "2050-01-02", "2050-01-05", now, "The arrival date can't be in the past", ""},
+	{"last-day-of-horizon", "2051-01-03", "2051-01-05", now, "", ""},
+	{"beyond-horizon", "2051-01-04", "2051-01-06", now, "Stays can be booked up to 365 days ahead", ""},
+	{"zero-nights", "2050-01-10", "2050-01-10", now, "", "The departure date must be after the arrival date"},
+	{"reversed", "2050-01-12", "2050-01-10", now, "", "The departure date must be after the arrival date"},
+	{"too-short", "2050-01-10", "2050-01-11", now, "", "The stay must be at least 2 nights"},
+	{"longest", "2050-01-10", "2050-01-24", now, "", ""},
+	{"too-long", "2050-01-10", "2050-01-25", now, "", "The stay can be at most 14 nights"},
+	{"past-and-reversed", "2050-01-02", "2050-01-01", now, "The arrival date can't be in the past", "The departure date must be after the arrival date"},
+	{"blank", "", "2050-01-12", now, "This field cannot be blank", ""},
+	{"not-a-date", "2050-01-10", "12/01/2050", now, "", "Use a date like 2006-01-02"},
+}
+
+func TestRules_Check(t *testing.T) {
+	for _, e := range checkTests {
+		form := forms.New(url.Values{"start": {e.start}, "end": {e.end}})
+		start, end := rules.Check(form, "start", "end", e.now)
+
+		if got := form.Errors.Get("start"); got != e.startError {
+			t.Errorf("%s: expected start error %q but got %q", e.name, e.startError, got)
+		}
+		if got := form.Errors.Get("end"); got != e.endError {
+			t.Errorf("%s: expected end error %q but got %q", e.name, e.endError, got)
+		}
+
+		if form.Valid() && (start.Format(forms.DateLayout) != e.start || end.Format(forms.DateLayout) != e.end) {
+			t.Errorf("%s: expected %s to %s but got %s to %s", e.name, e.start, e.end, start, end)
+		}
+	}
+}
+
+func TestRules_Check_Limits(t *testing.T) {
+	// without a maximum stay or a horizon, and with no stay starting the same day
+	unlimited := Rules{MinNights: 1}
+
+	form := forms.New(url.Values{"start": {"2060-01-01"}, "end": {"2061-01-01"}})
+	unlimited.Check(form, "start", "end", now)
+	if !form.Valid() {
+		t.Errorf("expected a long stay far ahead to be valid but got %v", form.Errors.Fields())
+	}
+
+	form = forms.New(url.Values{"start": {"2050-01-03"}, "end": {"2050-01-04"}})
+	unlimited.Check(form, "start", "end", time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC))
+	if got := form.Errors.Get("start"); got != "It is too late to book a stay starting today" {
+		t.Errorf("unexpected start error %q", got)
+	}
+}
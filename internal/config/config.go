@@ -2,19 +2,35 @@ package config
 
 import (
 	"html/template"
-	"log"
+	"log/slog"
+	"sync/atomic"
 
 	"github.com/alexedwards/scs/v2"
-	"github.com/marcelofranco/webapp-go-demo/internal/models"
+	"github.com/marcelofranco/webapp-go-demo/internal/mailer"
 )
 
 // AppConfig holds application config
 type AppConfig struct {
-	UseCache      bool
-	TemplateCache map[string]*template.Template
-	InfoLog       *log.Logger
-	ErrorLog      *log.Logger
-	InProduction  bool
-	Session       *scs.SessionManager
-	MailChan      chan models.MailData
+	Settings
+	TemplateCache     map[string]*template.Template
+	MailTemplateCache map[string]*template.Template
+	Logger            *slog.Logger
+	Session           *scs.SessionManager
+	MailQueue         *mailer.Queue
+
+	ready int32
+}
+
+// SetReady sets if the app takes new requests, which it stops doing when shutting down
+func (a *AppConfig) SetReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&a.ready, v)
+}
+
+// Ready tells if the app takes new requests
+func (a *AppConfig) Ready() bool {
+	return atomic.LoadInt32(&a.ready) == 1
 }
@@ -0,0 +1,326 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"gopkg.in/yaml.v3"
+)
+
+// Settings is the part of the config that changes between deployments
+type Settings struct {
+	Addr         string
+	BaseURL      string
+	InProduction bool
+	UseCache     bool
+	DatabaseDSN  string
+	DBTimeout    time.Duration
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+	OwnerEmail   string
+	APIKey       string
+	MetricsToken string
+	SigningKey   string
+	LogFormat    string
+	LogLevel     string
+
+	SessionStore           string
+	SessionCleanupInterval time.Duration
+
+	SigninMaxFailures   int
+	SigninIPMaxFailures int
+	SigninLockout       time.Duration
+	TrustProxyHeaders   bool
+
+	BookingMinNights     int
+	BookingMaxNights     int
+	BookingHorizonDays   int
+	BookingSameDayCutoff time.Duration
+
+	ShutdownDelay   time.Duration
+	ShutdownTimeout time.Duration
+}
+
+// secrets are the settings never printed in the summary
+var secrets = map[string]bool{
+	"smtp-password": true,
+	"api-key":       true,
+	"metrics-token": true,
+	"signing-key":   true,
+}
+
+// DefaultSettings returns the settings used for development
+func DefaultSettings() Settings {
+	return Settings{
+		Addr:       ":8085",
+		BaseURL:    "http://localhost:8085",
+		DBTimeout:  3 * time.Second,
+		SMTPHost:   "localhost",
+		SMTPPort:   1025,
+		MailFrom:   "me@here.com",
+		OwnerEmail: "owner@room.com",
+		LogFormat:  "text",
+		LogLevel:   "info",
+
+		SessionStore:           "memory",
+		SessionCleanupInterval: 5 * time.Minute,
+
+		SigninMaxFailures:   5,
+		SigninIPMaxFailures: 20,
+		SigninLockout:       15 * time.Minute,
+
+		BookingMinNights:     1,
+		BookingMaxNights:     30,
+		BookingHorizonDays:   365,
+		BookingSameDayCutoff: 18 * time.Hour,
+
+		ShutdownTimeout: 30 * time.Second,
+	}
+}
+
+// flagSet returns a flag set bound to the settings, with their current values as defaults
+func (s *Settings) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&s.Addr, "addr", s.Addr, "address the web server listens on")
+	fs.StringVar(&s.BaseURL, "base-url", s.BaseURL, "URL the site is reached at, for the links sent by mail")
+	fs.BoolVar(&s.InProduction, "in-production", s.InProduction, "serve secure cookies")
+	fs.BoolVar(&s.UseCache, "use-cache", s.UseCache, "parse the templates once at start up")
+	fs.StringVar(&s.DatabaseDSN, "database-dsn", s.DatabaseDSN, "postgres connection string")
+	fs.DurationVar(&s.DBTimeout, "db-timeout", s.DBTimeout, "timeout of database queries")
+	fs.StringVar(&s.SMTPHost, "smtp-host", s.SMTPHost, "host of the SMTP server")
+	fs.IntVar(&s.SMTPPort, "smtp-port", s.SMTPPort, "port of the SMTP server")
+	fs.StringVar(&s.SMTPUsername, "smtp-username", s.SMTPUsername, "user name on the SMTP server")
+	fs.StringVar(&s.SMTPPassword, "smtp-password", s.SMTPPassword, "password on the SMTP server")
+	fs.StringVar(&s.MailFrom, "mail-from", s.MailFrom, "sender of the mail sent to guests")
+	fs.StringVar(&s.OwnerEmail, "owner-email", s.OwnerEmail, "address notified of new reservations")
+	fs.StringVar(&s.APIKey, "api-key", s.APIKey, "bearer token of the JSON API, which is closed when empty")
+	fs.StringVar(&s.MetricsToken, "metrics-token", s.MetricsToken, "bearer token of /metrics, which is closed when empty")
+	fs.StringVar(&s.SigningKey, "signing-key", s.SigningKey, "secret key of the signed links sent by mail, at least 32 characters, random at each start when empty")
+	fs.StringVar(&s.LogFormat, "log-format", s.LogFormat, "format of the logs, text for logfmt or json")
+	fs.StringVar(&s.LogLevel, "log-level", s.LogLevel, "lowest level logged: debug, info, warn or error")
+	fs.StringVar(&s.SessionStore, "session-store", s.SessionStore, "where the sessions are kept, memory or postgres to share them between instances")
+	fs.DurationVar(&s.SessionCleanupInterval, "session-cleanup-interval", s.SessionCleanupInterval, "how often the expired sessions are deleted from postgres")
+	fs.IntVar(&s.SigninMaxFailures, "signin-max-failures", s.SigninMaxFailures, "failed sign ins locking an account out")
+	fs.IntVar(&s.SigninIPMaxFailures, "signin-ip-max-failures", s.SigninIPMaxFailures, "failed sign ins locking an IP address out, whatever the accounts")
+	fs.DurationVar(&s.SigninLockout, "signin-lockout", s.SigninLockout, "how long a lockout lasts, and how far back failed sign ins count")
+	fs.BoolVar(&s.TrustProxyHeaders, "trust-proxy-headers", s.TrustProxyHeaders, "take the client IP address from X-Forwarded-For, set by the load balancer")
+	fs.IntVar(&s.BookingMinNights, "booking-min-nights", s.BookingMinNights, "fewest nights of a stay, rooms and seasons can ask for more")
+	fs.IntVar(&s.BookingMaxNights, "booking-max-nights", s.BookingMaxNights, "most nights of a stay, without a limit when 0")
+	fs.IntVar(&s.BookingHorizonDays, "booking-horizon-days", s.BookingHorizonDays, "how many days ahead a stay can start, without a limit when 0")
+	fs.DurationVar(&s.BookingSameDayCutoff, "booking-same-day-cutoff", s.BookingSameDayCutoff, "time of day until which stays starting the same day are taken, 0 to take none")
+	fs.DurationVar(&s.ShutdownDelay, "shutdown-delay", s.ShutdownDelay, "time given to the load balancer to notice the app is not ready before it stops")
+	fs.DurationVar(&s.ShutdownTimeout, "shutdown-timeout", s.ShutdownTimeout, "time given to the requests in flight to finish when stopping")
+	return fs
+}
+
+// envName returns the environment variable of a setting, DATABASE_DSN for database-dsn
+func envName(setting string) string {
+	return strings.ToUpper(strings.ReplaceAll(setting, "-", "_"))
+}
+
+// fileKey returns the key of a setting in the config file, database_dsn for database-dsn
+func fileKey(setting string) string {
+	return strings.ReplaceAll(setting, "-", "_")
+}
+
+// Load fills the settings from, lowest priority first, their defaults, the YAML file given
+// with -config or CONFIG_FILE, the environment and the command line flags in args.
+// It returns the arguments left after the flags
+func (s *Settings) Load(name string, args []string, getenv func(string) string) ([]string, error) {
+	*s = DefaultSettings()
+
+	fs := s.flagSet(name)
+	configFile := fs.String("config", "", "YAML file to read the settings from")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	fromFlags := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		fromFlags[f.Name] = true
+	})
+
+	if *configFile == "" {
+		*configFile = getenv("CONFIG_FILE")
+	}
+	if *configFile != "" {
+		if err := s.loadFile(fs, *configFile, fromFlags); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value := getenv(envName(f.Name))
+		if err != nil || f.Name == "config" || fromFlags[f.Name] || value == "" {
+			return
+		}
+		if setErr := f.Value.Set(value); setErr != nil {
+			err = fmt.Errorf("invalid value %q for %s: %v", value, envName(f.Name), setErr)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.Args(), nil
+}
+
+// loadFile sets the settings found in a YAML file, except the ones given as flags
+func (s *Settings) loadFile(fs *flag.FlagSet, path string, fromFlags map[string]bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	for key, value := range values {
+		setting := strings.ReplaceAll(key, "_", "-")
+		f := fs.Lookup(setting)
+		if f == nil || setting == "config" || key != fileKey(setting) {
+			return fmt.Errorf("%s: unknown setting %s", path, key)
+		}
+		if fromFlags[setting] {
+			continue
+		}
+
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return fmt.Errorf("%s: %s must be a single value", path, key)
+		case nil:
+			value = ""
+		}
+		if err := f.Value.Set(fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("%s: invalid value %v for %s: %v", path, value, key, err)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the settings make sense together
+func (s *Settings) Validate() error {
+	var problems []string
+
+	if _, _, err := net.SplitHostPort(s.Addr); err != nil {
+		problems = append(problems, fmt.Sprintf("addr %q is not a host:port address", s.Addr))
+	}
+	if u, err := url.Parse(s.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("base-url %q is not an http or https URL", s.BaseURL))
+	}
+	if s.DatabaseDSN == "" {
+		problems = append(problems, "database-dsn is required")
+	}
+	if s.DBTimeout <= 0 {
+		problems = append(problems, "db-timeout must be positive")
+	}
+	if s.SMTPHost == "" {
+		problems = append(problems, "smtp-host is required")
+	}
+	if s.SMTPPort < 1 || s.SMTPPort > 65535 {
+		problems = append(problems, fmt.Sprintf("smtp-port %d is not a port number", s.SMTPPort))
+	}
+	if (s.SMTPUsername == "") != (s.SMTPPassword == "") {
+		problems = append(problems, "smtp-username and smtp-password go together")
+	}
+	if !govalidator.IsEmail(s.MailFrom) {
+		problems = append(problems, fmt.Sprintf("mail-from %q is not an email address", s.MailFrom))
+	}
+	if !govalidator.IsEmail(s.OwnerEmail) {
+		problems = append(problems, fmt.Sprintf("owner-email %q is not an email address", s.OwnerEmail))
+	}
+	if s.SigningKey != "" && len(s.SigningKey) < 32 {
+		problems = append(problems, "signing-key must have at least 32 characters")
+	}
+	if s.LogFormat != "text" && s.LogFormat != "json" {
+		problems = append(problems, fmt.Sprintf("log-format %q is not text or json", s.LogFormat))
+	}
+	switch s.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("log-level %q is not debug, info, warn or error", s.LogLevel))
+	}
+	if s.SessionStore != "memory" && s.SessionStore != "postgres" {
+		problems = append(problems, fmt.Sprintf("session-store %q is not memory or postgres", s.SessionStore))
+	}
+	if s.SessionCleanupInterval <= 0 {
+		problems = append(problems, "session-cleanup-interval must be positive")
+	}
+	if s.SigninMaxFailures < 1 || s.SigninIPMaxFailures < 1 {
+		problems = append(problems, "signin-max-failures and signin-ip-max-failures must be positive")
+	}
+	if s.SigninLockout <= 0 {
+		problems = append(problems, "signin-lockout must be positive")
+	}
+	if s.BookingMinNights < 1 {
+		problems = append(problems, "booking-min-nights must be positive")
+	}
+	if s.BookingMaxNights != 0 && s.BookingMaxNights < s.BookingMinNights {
+		problems = append(problems, "booking-max-nights must be 0 or at least booking-min-nights")
+	}
+	if s.BookingHorizonDays < 0 {
+		problems = append(problems, "booking-horizon-days can't be negative")
+	}
+	if s.BookingSameDayCutoff < 0 || s.BookingSameDayCutoff > 24*time.Hour {
+		problems = append(problems, "booking-same-day-cutoff must be a time of day, from 0 to 24h")
+	}
+	if s.ShutdownDelay < 0 {
+		problems = append(problems, "shutdown-delay can't be negative")
+	}
+	if s.ShutdownTimeout <= 0 {
+		problems = append(problems, "shutdown-timeout must be positive")
+	}
+	if s.InProduction && !s.UseCache {
+		problems = append(problems, "use-cache must be on in production")
+	}
+	if s.InProduction && s.SigningKey == "" {
+		problems = append(problems, "signing-key is required in production")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Summary returns one "name = value" line per setting, with the secrets and
+// the database password hidden, to be logged at start up
+func (s Settings) Summary() []string {
+	var lines []string
+	s.flagSet("").VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		switch {
+		case f.Name == "database-dsn":
+			value = redactDSN(value)
+		case secrets[f.Name] && value != "":
+			value = "xxxxx"
+		}
+		lines = append(lines, fmt.Sprintf("%s = %s", f.Name, value))
+	})
+	return lines
+}
+
+var dsnPassword = regexp.MustCompile(`(password=)('(\\'|[^'])*'|\S+)`)
+
+// redactDSN hides the password of a postgres connection string, either a URL or key=value pairs
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		return u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "${1}xxxxx")
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string {
+		return vars[key]
+	}
+}
+
+func TestSettings_Load(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(file, []byte("addr: \":9000\"\nsmtp_port: 2525\ndb_timeout: 5s\nin_production: true\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var s Settings
+	rest, err := s.Load("test", []string{"-config", file, "-smtp-port", "25", "up"}, env(map[string]string{
+		"SMTP_PORT":    "587",
+		"DB_TIMEOUT":   "10s",
+		"DATABASE_DSN": "postgres://localhost/bookings",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rest) != 1 || rest[0] != "up" {
+		t.Errorf("expected the arguments left to be [up] but got %v", rest)
+	}
+	if s.Addr != ":9000" {
+		t.Errorf("expected addr from the file but got %s", s.Addr)
+	}
+	if !s.InProduction {
+		t.Error("expected in-production from the file")
+	}
+	if s.DBTimeout != 10*time.Second {
+		t.Errorf("expected db-timeout from the environment over the file but got %s", s.DBTimeout)
+	}
+	if s.SMTPPort != 25 {
+		t.Errorf("expected smtp-port from the flags over the environment but got %d", s.SMTPPort)
+	}
+	if s.DatabaseDSN != "postgres://localhost/bookings" {
+		t.Errorf("expected database-dsn from the environment but got %s", s.DatabaseDSN)
+	}
+	if s.SMTPHost != "localhost" {
+		t.Errorf("expected the default smtp-host but got %s", s.SMTPHost)
+	}
+}
+
+func TestSettings_LoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	unknown := filepath.Join(dir, "unknown.yaml")
+	if err := os.WriteFile(unknown, []byte("smtp-host: mail\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(dir, "nested.yaml")
+	if err := os.WriteFile(nested, []byte("smtp_host:\n  name: mail\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+	}{
+		{"unknown-flag", []string{"-port", "80"}, nil},
+		{"invalid-flag", []string{"-smtp-port", "smtp"}, nil},
+		{"invalid-env", nil, map[string]string{"DB_TIMEOUT": "3"}},
+		{"missing-file", nil, map[string]string{"CONFIG_FILE": filepath.Join(dir, "missing.yaml")}},
+		{"unknown-key", []string{"-config", unknown}, nil},
+		{"nested-value", []string{"-config", nested}, nil},
+	}
+
+	for _, e := range tests {
+		var s Settings
+		if _, err := s.Load("test", e.args, env(e.env)); err == nil {
+			t.Errorf("%s: expected an error", e.name)
+		}
+	}
+}
+
+func TestSettings_Validate(t *testing.T) {
+	valid := DefaultSettings()
+	valid.DatabaseDSN = "host=localhost dbname=bookings"
+
+	tests := []struct {
+		name    string
+		change  func(s *Settings)
+		problem string
+	}{
+		{"valid", func(s *Settings) {}, ""},
+		{"addr", func(s *Settings) { s.Addr = "8085" }, "addr"},
+		{"base-url", func(s *Settings) { s.BaseURL = "localhost:8085" }, "base-url"},
+		{"dsn", func(s *Settings) { s.DatabaseDSN = "" }, "database-dsn"},
+		{"timeout", func(s *Settings) { s.DBTimeout = 0 }, "db-timeout"},
+		{"port", func(s *Settings) { s.SMTPPort = 70000 }, "smtp-port"},
+		{"smtp-auth", func(s *Settings) { s.SMTPUsername = "user" }, "smtp-password"},
+		{"mail-from", func(s *Settings) { s.MailFrom = "me" }, "mail-from"},
+		{"log-format", func(s *Settings) { s.LogFormat = "xml" }, "log-format"},
+		{"log-level", func(s *Settings) { s.LogLevel = "trace" }, "log-level"},
+		{"session-store", func(s *Settings) { s.SessionStore = "redis" }, "session-store"},
+		{"signin-max-failures", func(s *Settings) { s.SigninMaxFailures = 0 }, "signin-max-failures"},
+		{"signin-lockout", func(s *Settings) { s.SigninLockout = 0 }, "signin-lockout"},
+		{"signing-key", func(s *Settings) { s.SigningKey = "short" }, "signing-key"},
+		{"booking-max-nights", func(s *Settings) { s.BookingMaxNights = 0 }, ""},
+		{"booking-max-below-min", func(s *Settings) { s.BookingMinNights, s.BookingMaxNights = 7, 3 }, "booking-max-nights"},
+		{"booking-same-day-cutoff", func(s *Settings) { s.BookingSameDayCutoff = 25 * time.Hour }, "booking-same-day-cutoff"},
+		{"production", func(s *Settings) { s.InProduction = true }, "use-cache"},
+		{"production-signing-key", func(s *Settings) { s.InProduction, s.UseCache = true, true }, "signing-key"},
+	}
+
+	for _, e := range tests {
+		s := valid
+		e.change(&s)
+		err := s.Validate()
+		if e.problem == "" {
+			if err != nil {
+				t.Errorf("%s: expected no error but got %v", e.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), e.problem) {
+			t.Errorf("%s: expected an error about %s but got %v", e.name, e.problem, err)
+		}
+	}
+}
+
+func TestSettings_Summary(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{"postgres://app:secret@db:5432/bookings", "database-dsn = postgres://app:xxxxx@db:5432/bookings"},
+		{"host=db user=app password=secret dbname=bookings", "database-dsn = host=db user=app password=xxxxx dbname=bookings"},
+		{"host=db password='se cret' dbname=bookings", "database-dsn = host=db password=xxxxx dbname=bookings"},
+	}
+
+	for _, e := range tests {
+		s := DefaultSettings()
+		s.DatabaseDSN = e.dsn
+		s.SMTPPassword = "secret"
+		s.APIKey = "secret"
+		s.MetricsToken = "secret"
+		s.SigningKey = "secret-signing-key-of-32-characters"
+
+		summary := strings.Join(s.Summary(), "\n")
+		if strings.Contains(summary, "secret") {
+			t.Errorf("expected the secrets to be hidden but got\n%s", summary)
+		}
+		if !strings.Contains(summary, e.want) {
+			t.Errorf("expected %q in\n%s", e.want, summary)
+		}
+		if !strings.Contains(summary, "smtp-host = localhost") {
+			t.Errorf("expected the smtp host in\n%s", summary)
+		}
+	}
+}
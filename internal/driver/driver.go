@@ -2,12 +2,9 @@ package driver
 
 import (
 	"database/sql"
-	"errors"
 	"time"
 
-	"github.com/marcelofranco/webapp-go-demo/internal/models"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
+	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
 type DB struct {
@@ -24,26 +21,16 @@ const maxDbLifetime = 5 * time.Minute
 func ConnectSQL(dsn string) (*DB, error) {
 	d, err := NewDatabase(dsn)
 	if err != nil {
-		panic(err)
-	}
-
-	err = runMigrations(d)
-	if err != nil {
-		panic(err)
-	}
-
-	sqlDB, err := d.DB()
-	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	sqlDB.SetMaxOpenConns(maxOpenDbConn)
-	sqlDB.SetMaxIdleConns(maxIdleDbConn)
-	sqlDB.SetConnMaxLifetime(maxDbLifetime)
+	d.SetMaxOpenConns(maxOpenDbConn)
+	d.SetMaxIdleConns(maxIdleDbConn)
+	d.SetConnMaxLifetime(maxDbLifetime)
 
-	dbConn.SQL = sqlDB
+	dbConn.SQL = d
 
-	err = testDB(sqlDB)
+	err = testDB(d)
 	if err != nil {
 		return nil, err
 	}
@@ -52,13 +39,8 @@ func ConnectSQL(dsn string) (*DB, error) {
 }
 
 // NewDatabase creates a new database for the application
-func NewDatabase(dsn string) (*gorm.DB, error) {
-	gc, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		return nil, err
-	}
-
-	db, err := gc.DB()
+func NewDatabase(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("pgx", dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -67,7 +49,7 @@ func NewDatabase(dsn string) (*gorm.DB, error) {
 		return nil, err
 	}
 
-	return gc, nil
+	return db, nil
 }
 
 // testDB tries to ping the database
@@ -78,53 +60,3 @@ func testDB(d *sql.DB) error {
 	}
 	return nil
 }
-
-func runMigrations(d *gorm.DB) error {
-	err := d.AutoMigrate(&models.User{},
-		&models.Reservation{},
-		&models.Restriction{},
-		&models.Room{},
-		&models.RoomRestriction{})
-
-	if err != nil {
-		return err
-	}
-
-	if d.Migrator().HasTable(&models.Room{}) {
-		if err = d.First(&models.Room{}).Error; errors.Is(err, gorm.ErrRecordNotFound) {
-			var rooms = []models.Room{
-				{
-					RoomName: "General's Quarters",
-				},
-				{
-					RoomName: "Major's Suite",
-				},
-			}
-			for _, r := range rooms {
-				if err = d.Create(&r).Error; err != nil {
-					return err
-				}
-			}
-		}
-	}
-
-	if d.Migrator().HasTable(&models.Restriction{}) {
-		if err = d.First(&models.Restriction{}).Error; errors.Is(err, gorm.ErrRecordNotFound) {
-			var restrictions = []models.Restriction{
-				{
-					RestrictionName: "Reservation",
-				},
-				{
-					RestrictionName: "Owner Block",
-				},
-			}
-			for _, rr := range restrictions {
-				if err = d.Create(&rr).Error; err != nil {
-					return err
-				}
-			}
-		}
-	}
-
-	return nil
-}
@@ -0,0 +1,176 @@
+package forms
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Bind sets the fields of the struct dst points to from the form and checks them. The
+// form tag of a field names its form field and the validate tag lists its rules:
+//
+//	type Guest struct {
+//		Name    string    `form:"name" validate:"required,min=3,max=100"`
+//		Phone   string    `form:"phone" validate:"phone"`
+//		Guests  int       `form:"guests" validate:"required,min=1,max=4"`
+//		Arrival time.Time `form:"start_date" validate:"required"`
+//		Leave   time.Time `form:"end_date" validate:"required,after=start_date"`
+//	}
+//
+// The rules are required, email, phone, password, min and max, which are lengths for
+// strings and values for numbers, after, for a date after the one of another field, and
+// eq, for the same value as another field. Fields of type string, int and time.Time,
+// written like DateLayout, can be bound. Phone numbers are set written like E.164.
+//
+// The errors of the fields are added to the form, as by the other checks. The error
+// returned is for a struct that can't be bound, like one with an unknown rule
+func (f *Form) Bind(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("can't bind form to %T, it must be a pointer to a struct", dst)
+	}
+	v = v.Elem()
+
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		field, ok := sf.Tag.Lookup("form")
+		if !ok || field == "-" {
+			continue
+		}
+		if !sf.IsExported() {
+			return fmt.Errorf("can't bind form field %s to unexported %s", field, sf.Name)
+		}
+
+		if err := f.bindField(v.Field(i), field, sf.Tag.Get("validate")); err != nil {
+			return fmt.Errorf("can't bind form field %s to %s: %w", field, sf.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// bindField sets fv from the form field and checks the rules of its validate tag
+func (f *Form) bindField(fv reflect.Value, field, tag string) error {
+	var rules []string
+	if tag != "" {
+		rules = strings.Split(tag, ",")
+	}
+
+	// the rules are checked first, so that a struct with a wrong rule is always an error
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			if arg != "" {
+				return fmt.Errorf("rule %s takes no argument", name)
+			}
+		case "email", "phone", "password":
+			if arg != "" {
+				return fmt.Errorf("rule %s takes no argument", name)
+			}
+			if fv.Kind() != reflect.String {
+				return fmt.Errorf("rule %s needs a string", name)
+			}
+		case "min", "max":
+			if _, err := strconv.Atoi(arg); err != nil {
+				return fmt.Errorf("rule %s needs a number", name)
+			}
+			if fv.Kind() != reflect.String && fv.Kind() != reflect.Int {
+				return fmt.Errorf("rule %s needs a string or a number", name)
+			}
+		case "after":
+			if fv.Type() != timeType {
+				return fmt.Errorf("rule %s needs a date", name)
+			}
+			fallthrough
+		case "eq":
+			if arg == "" {
+				return fmt.Errorf("rule %s needs the name of a field", name)
+			}
+		default:
+			return fmt.Errorf("unknown rule %q", rule)
+		}
+	}
+
+	switch {
+	case fv.Kind() == reflect.String:
+		fv.SetString(f.Get(field))
+	case fv.Kind() == reflect.Int:
+		if f.Has(field) && !f.IntRange(field, math.MinInt, math.MaxInt) {
+			return nil
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(f.Get(field)))
+		fv.SetInt(int64(n))
+	case fv.Type() == timeType:
+		if !f.IsDate(field) {
+			return nil
+		}
+		fv.Set(reflect.ValueOf(f.Date(field)))
+	default:
+		return fmt.Errorf("type %s can't be bound", fv.Type())
+	}
+
+	// the min and max of a number are checked together, naming both in the error
+	lo, hi := math.MinInt, math.MaxInt
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		if n, err := strconv.Atoi(arg); err == nil && name == "min" {
+			lo = n
+		} else if err == nil && name == "max" {
+			hi = n
+		}
+	}
+
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		if name == "required" {
+			if !f.Has(field) {
+				f.Required(field)
+				return nil
+			}
+			continue
+		}
+		if !f.Has(field) {
+			continue
+		}
+
+		var ok bool
+		switch name {
+		case "email":
+			ok = f.IsEmail(field)
+		case "phone":
+			if ok = f.IsPhone(field); ok {
+				phone, _ := E164(f.Get(field))
+				fv.SetString(phone)
+			}
+		case "password":
+			ok = f.ValidPassword(field)
+		case "min", "max":
+			if fv.Kind() == reflect.Int {
+				ok = f.IntRange(field, lo, hi)
+			} else if n, _ := strconv.Atoi(arg); name == "min" {
+				ok = f.MinLenght(field, n)
+			} else {
+				ok = f.MaxLength(field, n)
+			}
+		case "after":
+			if other := f.Date(arg); !other.IsZero() {
+				ok = f.DateRange(arg, field)
+			} else {
+				ok = true
+			}
+		case "eq":
+			ok = f.Equal(field, arg)
+		}
+		if !ok {
+			return nil
+		}
+	}
+
+	return nil
+}
@@ -1,18 +1,39 @@
 package forms
 
-type errors map[string][]string
+import "github.com/marcelofranco/webapp-go-demo/internal/i18n"
 
-// Add adds an error message for a giving field
-func (e errors) Add(field, message string) {
-	e[field] = append(e[field], message)
+// message is an error message kept in English with its arguments, so that it is
+// translated to the language of the page showing it
+type message struct {
+	text string
+	args []interface{}
 }
 
-// Get returns the first error message
+type errors struct {
+	locale string
+	fields map[string][]message
+}
+
+// Add adds an error message for a giving field, formatted with args like fmt.Sprintf
+func (e errors) Add(field, text string, args ...interface{}) {
+	e.fields[field] = append(e.fields[field], message{text: text, args: args})
+}
+
+// Get returns the first error message, in the language of the form
 func (e errors) Get(field string) string {
-	es, exists := e[field]
+	es, exists := e.fields[field]
 	if !exists {
 		return ""
 	}
 
-	return es[0]
+	return i18n.T(e.locale, es[0].text, es[0].args...)
+}
+
+// Fields returns the fields with errors
+func (e errors) Fields() []string {
+	var fields []string
+	for field := range e.fields {
+		fields = append(fields, field)
+	}
+	return fields
 }
@@ -2,12 +2,50 @@ package forms
 
 import (
 	"fmt"
+	"math"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/asaskevich/govalidator"
 )
 
+// DateLayout is how the dates of the forms are written
+const DateLayout = "2006-01-02"
+
+// phonePattern matches the phone numbers of E.164: a plus sign, the country code and up to
+// 15 digits in all
+var phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// phoneSeparators are the characters people write phone numbers with, left out by E164
+var phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+
+// Rule checks the value of a field, returning the error to show when it is not valid.
+// Errors made with Errorf are shown in the language of the page
+type Rule func(value string) error
+
+// ruleError is the error of a rule, kept with its arguments like the form errors
+type ruleError message
+
+func (e *ruleError) Error() string {
+	return fmt.Sprintf(e.text, e.args...)
+}
+
+// Errorf returns the error of a rule, formatted with args like fmt.Sprintf
+func Errorf(text string, args ...interface{}) error {
+	return &ruleError{text: text, args: args}
+}
+
+// E164 returns phone written like E.164, as in +15555555555, and whether it is a valid
+// international phone number. Spaces, dashes, dots and parentheses are left out
+func E164(phone string) (string, bool) {
+	phone = phoneSeparators.Replace(strings.TrimSpace(phone))
+	return phone, phonePattern.MatchString(phone)
+}
+
 // Form creates a custom form struct, embeds url.Values object
 type Form struct {
 	url.Values
@@ -18,10 +56,15 @@ type Form struct {
 func New(data url.Values) *Form {
 	return &Form{
 		data,
-		errors(map[string][]string{}),
+		errors{fields: map[string][]message{}},
 	}
 }
 
+// Localize shows the error messages of the form in locale
+func (f *Form) Localize(locale string) {
+	f.Errors.locale = locale
+}
+
 // Required checks if form fields exists in post request
 func (f *Form) Required(fields ...string) {
 	for _, field := range fields {
@@ -43,12 +86,12 @@ func (f *Form) MinLenght(field string, lenght int) bool {
 	if f.Has(field) {
 		valid := f.Get(field)
 		if len(valid) < lenght {
-			f.Errors.Add(field, fmt.Sprintf("This field must be at least %d characters long", lenght))
+			f.Errors.Add(field, "This field must be at least %d characters long", lenght)
 			return false
 		}
 		return true
 	} else {
-		f.Errors.Add(field, fmt.Sprintf("Field %s not found to validate minimal lenght", field))
+		f.Errors.Add(field, "Field %s not found to validate minimal lenght", field)
 		return false
 	}
 }
@@ -62,7 +105,7 @@ func (f *Form) IsEmail(field string) bool {
 		}
 		return true
 	} else {
-		f.Errors.Add(field, fmt.Sprintf("Field %s not found to validate if is email", field))
+		f.Errors.Add(field, "Field %s not found to validate if is email", field)
 		return false
 	}
 }
@@ -88,12 +131,128 @@ func (f *Form) ValidPassword(field string) bool {
 			return true
 		}
 	} else {
-		f.Errors.Add(field, fmt.Sprintf("Field %s not found", field))
+		f.Errors.Add(field, "Field %s not found", field)
 		return false
 	}
 }
 
+// The checks below leave out blank fields, which Required checks, so that they can be
+// used on optional fields too
+
+// MaxLength checks a field is at most length characters long
+func (f *Form) MaxLength(field string, length int) bool {
+	if utf8.RuneCountInString(f.Get(field)) > length {
+		f.Errors.Add(field, "This field must be at most %d characters long", length)
+		return false
+	}
+	return true
+}
+
+// IntRange checks a field is a whole number from min to max. Use math.MinInt or math.MaxInt
+// for a range without a lower or an upper bound
+func (f *Form) IntRange(field string, min, max int) bool {
+	if !f.Has(field) {
+		return true
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(f.Get(field)))
+	if err != nil {
+		f.Errors.Add(field, "This field must be a whole number")
+		return false
+	}
+	switch {
+	case n >= min && n <= max:
+		return true
+	case max == math.MaxInt:
+		f.Errors.Add(field, "This field must be a number of at least %d", min)
+	case min == math.MinInt:
+		f.Errors.Add(field, "This field must be a number of at most %d", max)
+	default:
+		f.Errors.Add(field, "This field must be a number from %d to %d", min, max)
+	}
+	return false
+}
+
+// IsPhone checks a field is an international phone number, see E164
+func (f *Form) IsPhone(field string) bool {
+	if !f.Has(field) {
+		return true
+	}
+
+	if _, ok := E164(f.Get(field)); !ok {
+		f.Errors.Add(field, "Use an international phone number like +1 555 555 5555")
+		return false
+	}
+	return true
+}
+
+// IsDate checks a field is a date written like DateLayout
+func (f *Form) IsDate(field string) bool {
+	if !f.Has(field) {
+		return true
+	}
+
+	if _, err := time.Parse(DateLayout, strings.TrimSpace(f.Get(field))); err != nil {
+		f.Errors.Add(field, "Use a date like %s", DateLayout)
+		return false
+	}
+	return true
+}
+
+// DateRange checks the dates of two fields, adding an error to endField unless it is
+// after startField. Invalid dates are errors of their own field
+func (f *Form) DateRange(startField, endField string) bool {
+	if !f.IsDate(startField) || !f.IsDate(endField) {
+		return false
+	}
+	if !f.Has(startField) || !f.Has(endField) {
+		return true
+	}
+
+	if !f.Date(endField).After(f.Date(startField)) {
+		f.Errors.Add(endField, "The end date must be after the start date")
+		return false
+	}
+	return true
+}
+
+// Date returns the date of a field, or the zero time when it is not a valid date
+func (f *Form) Date(field string) time.Time {
+	t, _ := time.Parse(DateLayout, strings.TrimSpace(f.Get(field)))
+	return t
+}
+
+// Equal checks a field has the same value as otherField, like the confirmation of a password
+func (f *Form) Equal(field, otherField string) bool {
+	if f.Has(field) && f.Get(field) != f.Get(otherField) {
+		f.Errors.Add(field, "The values don't match")
+		return false
+	}
+	return true
+}
+
+// Check runs the rules on the value of a field, in order, and adds the error of the
+// first one it fails
+func (f *Form) Check(field string, rules ...Rule) bool {
+	if !f.Has(field) {
+		return true
+	}
+
+	value := f.Get(field)
+	for _, rule := range rules {
+		if err := rule(value); err != nil {
+			if re, ok := err.(*ruleError); ok {
+				f.Errors.Add(field, re.text, re.args...)
+			} else {
+				f.Errors.Add(field, err.Error())
+			}
+			return false
+		}
+	}
+	return true
+}
+
 // Valid returns true if form has no error, otherwise false
 func (f *Form) Valid() bool {
-	return len(f.Errors) == 0
+	return len(f.Errors.fields) == 0
 }
@@ -1,9 +1,13 @@
 package forms
 
 import (
+	"fmt"
+	"math"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestForm_Valid(t *testing.T) {
@@ -117,3 +121,308 @@ func TestForm_IsEmail(t *testing.T) {
 		t.Error("expected to return true when field is a valid email but returned false")
 	}
 }
+
+func TestForm_Localize(t *testing.T) {
+	form := New(url.Values{"a": {"a"}})
+	form.Required("b")
+	form.MinLenght("a", 3)
+
+	if got := form.Errors.Get("b"); got != "This field cannot be blank" {
+		t.Errorf("expected the error in English but got %q", got)
+	}
+
+	form.Localize("pt")
+	if got := form.Errors.Get("b"); got != "Este campo não pode ficar em branco" {
+		t.Errorf("expected the error in Portuguese but got %q", got)
+	}
+	if got := form.Errors.Get("a"); got != "Este campo deve ter pelo menos 3 caracteres" {
+		t.Errorf("expected the error in Portuguese but got %q", got)
+	}
+	if got := form.Errors.Get("c"); got != "" {
+		t.Errorf("expected no error but got %q", got)
+	}
+}
+
+func TestForm_MaxLength(t *testing.T) {
+	form := New(url.Values{"a": {"João"}, "b": {"abcde"}})
+
+	if !form.MaxLength("a", 4) {
+		t.Error("expected letters with accents to count once")
+	}
+	if !form.MaxLength("c", 4) {
+		t.Error("expected a blank field to pass")
+	}
+	if form.MaxLength("b", 4) {
+		t.Error("expected to return false when the field is too long")
+	}
+	if got := form.Errors.Get("b"); got != "This field must be at most 4 characters long" {
+		t.Errorf("unexpected error %q", got)
+	}
+}
+
+func TestForm_IntRange(t *testing.T) {
+	tests := []struct {
+		value         string
+		min           int
+		max           int
+		expectedError string
+	}{
+		{"", 1, 10, ""},
+		{"5", 1, 10, ""},
+		{" 10 ", 1, 10, ""},
+		{"0", 1, 10, "This field must be a number from 1 to 10"},
+		{"11", 1, 10, "This field must be a number from 1 to 10"},
+		{"0", 1, math.MaxInt, "This field must be a number of at least 1"},
+		{"11", math.MinInt, 10, "This field must be a number of at most 10"},
+		{"1.5", 1, 10, "This field must be a whole number"},
+		{"five", 1, 10, "This field must be a whole number"},
+	}
+
+	for _, e := range tests {
+		form := New(url.Values{"a": {e.value}})
+		if valid := form.IntRange("a", e.min, e.max); valid != (e.expectedError == "") {
+			t.Errorf("%q: expected valid %t but got %t", e.value, e.expectedError == "", valid)
+		}
+		if got := form.Errors.Get("a"); got != e.expectedError {
+			t.Errorf("%q: expected error %q but got %q", e.value, e.expectedError, got)
+		}
+	}
+}
+
+func TestE164(t *testing.T) {
+	tests := []struct {
+		phone    string
+		expected string
+		valid    bool
+	}{
+		{"+15555555555", "+15555555555", true},
+		{" +1 (555) 555-5555 ", "+15555555555", true},
+		{"+55 11 91234.5678", "+5511912345678", true},
+		{"555-555-5555", "5555555555", false},
+		{"+05555555555", "+05555555555", false},
+		{"+1234567890123456", "+1234567890123456", false},
+		{"+1 555 CALL NOW", "+1555CALLNOW", false},
+	}
+
+	for _, e := range tests {
+		phone, valid := E164(e.phone)
+		if phone != e.expected || valid != e.valid {
+			t.Errorf("%q: expected %q, %t but got %q, %t", e.phone, e.expected, e.valid, phone, valid)
+		}
+	}
+
+	form := New(url.Values{"a": {"555-555-5555"}})
+	if form.IsPhone("a") || form.Errors.Get("a") == "" {
+		t.Error("expected an error for a phone number without its country code")
+	}
+}
+
+func TestForm_DateRange(t *testing.T) {
+	tests := []struct {
+		start      string
+		end        string
+		valid      bool
+		startError string
+		endError   string
+	}{
+		{"2050-01-01", "2050-01-02", true, "", ""},
+		{"", "", true, "", ""},
+		{"2050-01-01", "", true, "", ""},
+		{"2050-01-02", "2050-01-02", false, "", "The end date must be after the start date"},
+		{"2050-01-03", "2050-01-02", false, "", "The end date must be after the start date"},
+		{"01/01/2050", "2050-01-02", false, "Use a date like 2006-01-02", ""},
+		{"2050-01-01", "2050-02-30", false, "", "Use a date like 2006-01-02"},
+	}
+
+	for _, e := range tests {
+		form := New(url.Values{"start": {e.start}, "end": {e.end}})
+		if valid := form.DateRange("start", "end"); valid != e.valid {
+			t.Errorf("%s %s: expected valid %t but got %t", e.start, e.end, e.valid, valid)
+		}
+		if got := form.Errors.Get("start"); got != e.startError {
+			t.Errorf("%s %s: expected start error %q but got %q", e.start, e.end, e.startError, got)
+		}
+		if got := form.Errors.Get("end"); got != e.endError {
+			t.Errorf("%s %s: expected end error %q but got %q", e.start, e.end, e.endError, got)
+		}
+	}
+
+	form := New(url.Values{"start": {"2050-01-02"}})
+	if got := form.Date("start"); !got.Equal(time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected date %s", got)
+	}
+	if got := form.Date("end"); !got.IsZero() {
+		t.Errorf("expected the zero time but got %s", got)
+	}
+}
+
+func TestForm_Equal(t *testing.T) {
+	form := New(url.Values{"password": {"Secret1!"}, "password_confirm": {"Secret1!"}, "other": {"secret1!"}})
+
+	if !form.Equal("password_confirm", "password") {
+		t.Error("expected equal values to pass")
+	}
+	if form.Equal("other", "password") {
+		t.Error("expected different values to fail")
+	}
+	if got := form.Errors.Get("other"); got != "The values don't match" {
+		t.Errorf("unexpected error %q", got)
+	}
+}
+
+func TestForm_Check(t *testing.T) {
+	noSpaces := func(value string) error {
+		if strings.Contains(value, " ") {
+			return Errorf("Remove the %d spaces", strings.Count(value, " "))
+		}
+		return nil
+	}
+	notAdmin := func(value string) error {
+		if value == "admin" {
+			return fmt.Errorf("This name is taken")
+		}
+		return nil
+	}
+
+	form := New(url.Values{"a": {"a b c"}, "b": {"admin"}, "c": {"guest"}})
+
+	if form.Check("a", noSpaces, notAdmin) {
+		t.Error("expected the rule to fail")
+	}
+	if form.Check("b", noSpaces, notAdmin) {
+		t.Error("expected the second rule to fail")
+	}
+	if !form.Check("c", noSpaces, notAdmin) {
+		t.Error("expected the rules to pass")
+	}
+
+	if got := form.Errors.Get("a"); got != "Remove the 2 spaces" {
+		t.Errorf("unexpected error %q", got)
+	}
+	if got := form.Errors.Get("b"); got != "This name is taken" {
+		t.Errorf("unexpected error %q", got)
+	}
+}
+
+type testBooking struct {
+	Name      string    `form:"name" validate:"required,min=3,max=10"`
+	Email     string    `form:"email" validate:"required,email"`
+	Phone     string    `form:"phone" validate:"phone"`
+	Guests    int       `form:"guests" validate:"required,min=1,max=4"`
+	Arrival   time.Time `form:"start_date" validate:"required"`
+	Departure time.Time `form:"end_date" validate:"required,after=start_date"`
+	Code      string    `form:"code" validate:"eq=code_confirm"`
+	Notes     string    `form:"notes"`
+	Ignored   string
+}
+
+func TestForm_Bind(t *testing.T) {
+	form := New(url.Values{
+		"name":         {"John"},
+		"email":        {"john@smith.com"},
+		"phone":        {"+1 555-555-5555"},
+		"guests":       {"2"},
+		"start_date":   {"2050-01-01"},
+		"end_date":     {"2050-01-03"},
+		"code":         {"abc"},
+		"code_confirm": {"abc"},
+		"notes":        {"Late arrival"},
+		"Ignored":      {"x"},
+	})
+
+	var b testBooking
+	if err := form.Bind(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !form.Valid() {
+		t.Fatalf("expected the form to be valid but got %v", form.Errors.Fields())
+	}
+
+	expected := testBooking{
+		Name:      "John",
+		Email:     "john@smith.com",
+		Phone:     "+15555555555",
+		Guests:    2,
+		Arrival:   time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		Departure: time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		Code:      "abc",
+		Notes:     "Late arrival",
+	}
+	if b != expected {
+		t.Errorf("expected %+v but got %+v", expected, b)
+	}
+
+	form = New(url.Values{
+		"name":         {"Jo"},
+		"email":        {"john"},
+		"phone":        {"555"},
+		"guests":       {"9"},
+		"end_date":     {"2050-01-03"},
+		"code":         {"abc"},
+		"code_confirm": {"abd"},
+	})
+	if err := form.Bind(&testBooking{}); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedErrors := map[string]string{
+		"name":       "This field must be at least 3 characters long",
+		"email":      "Invalid email address",
+		"phone":      "Use an international phone number like +1 555 555 5555",
+		"guests":     "This field must be a number from 1 to 4",
+		"start_date": "This field cannot be blank",
+		"end_date":   "",
+		"code":       "The values don't match",
+		"notes":      "",
+	}
+	for field, expected := range expectedErrors {
+		if got := form.Errors.Get(field); got != expected {
+			t.Errorf("%s: expected error %q but got %q", field, expected, got)
+		}
+	}
+
+	form = New(url.Values{"start_date": {"2050-01-03"}, "end_date": {"2050-01-03"}, "guests": {"two"}})
+	form.Bind(&testBooking{})
+	if got := form.Errors.Get("end_date"); got != "The end date must be after the start date" {
+		t.Errorf("unexpected end date error %q", got)
+	}
+	if got := form.Errors.Get("guests"); got != "This field must be a whole number" {
+		t.Errorf("unexpected guests error %q", got)
+	}
+}
+
+func TestForm_Bind_Errors(t *testing.T) {
+	var b testBooking
+	tests := []struct {
+		name string
+		dst  interface{}
+	}{
+		{"not-a-pointer", b},
+		{"not-a-struct", new(string)},
+		{"unknown-rule", &struct {
+			A string `form:"a" validate:"required,shiny"`
+		}{}},
+		{"min-without-number", &struct {
+			A string `form:"a" validate:"min=x"`
+		}{}},
+		{"after-not-a-date", &struct {
+			A string `form:"a" validate:"after=b"`
+		}{}},
+		{"phone-not-a-string", &struct {
+			A int `form:"a" validate:"phone"`
+		}{}},
+		{"unsupported-type", &struct {
+			A float64 `form:"a"`
+		}{}},
+		{"unexported", &struct {
+			a string `form:"a"`
+		}{}},
+	}
+
+	for _, e := range tests {
+		form := New(url.Values{"a": {"1"}})
+		if err := form.Bind(e.dst); err == nil {
+			t.Errorf("%s: expected an error but got none", e.name)
+		}
+	}
+}
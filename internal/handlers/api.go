@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/forms"
+	"github.com/marcelofranco/webapp-go-demo/internal/helpers"
+	"github.com/marcelofranco/webapp-go-demo/internal/i18n"
+	"github.com/marcelofranco/webapp-go-demo/internal/logging"
+	"github.com/marcelofranco/webapp-go-demo/internal/metrics"
+	"github.com/marcelofranco/webapp-go-demo/internal/models"
+	"github.com/marcelofranco/webapp-go-demo/internal/pricing"
+	"github.com/marcelofranco/webapp-go-demo/internal/repository"
+)
+
+// apiRoom is a room as returned by the JSON API
+type apiRoom struct {
+	ID           int      `json:"id"`
+	Name         string   `json:"name"`
+	Slug         string   `json:"slug"`
+	Description  string   `json:"description"`
+	Capacity     int      `json:"capacity"`
+	NightlyPrice int      `json:"nightly_price"` // in cents
+	WeekendPrice int      `json:"weekend_price"` // in cents
+	MinNights    int      `json:"min_nights"`
+	Photos       []string `json:"photos"`
+}
+
+// apiAvailability is the availability of a room for a stay as returned by the JSON API
+type apiAvailability struct {
+	RoomID     int    `json:"room_id"`
+	StartDate  string `json:"start_date"`
+	EndDate    string `json:"end_date"`
+	Available  bool   `json:"available"`
+	Nights     int    `json:"nights"`
+	TotalPrice int    `json:"total_price"` // in cents
+}
+
+// apiReservation is a reservation as returned and accepted by the JSON API
+type apiReservation struct {
+	ID         int    `json:"id"`
+	RoomID     int    `json:"room_id"`
+	RoomName   string `json:"room_name,omitempty"`
+	FirstName  string `json:"first_name"`
+	LastName   string `json:"last_name"`
+	Email      string `json:"email"`
+	Phone      string `json:"phone"`
+	StartDate  string `json:"start_date"`
+	EndDate    string `json:"end_date"`
+	TotalPrice int    `json:"total_price"` // in cents
+	Processed  bool   `json:"processed"`
+
+	ConfirmationCode string `json:"confirmation_code,omitempty"`
+	Cancelled        bool   `json:"cancelled"`
+}
+
+func newAPIRoom(room models.Room) apiRoom {
+	photos := room.Photos
+	if photos == nil {
+		photos = []string{}
+	}
+
+	return apiRoom{
+		ID:           room.ID,
+		Name:         room.RoomName,
+		Slug:         room.Slug,
+		Description:  room.Description,
+		Capacity:     room.Capacity,
+		NightlyPrice: room.NightlyPrice,
+		WeekendPrice: room.WeekendPrice,
+		MinNights:    room.MinNights,
+		Photos:       photos,
+	}
+}
+
+func newAPIReservation(res models.Reservation) apiReservation {
+	return apiReservation{
+		ID:         res.ID,
+		RoomID:     res.RoomID,
+		RoomName:   res.Room.RoomName,
+		FirstName:  res.FirstName,
+		LastName:   res.LastName,
+		Email:      res.Email,
+		Phone:      res.Phone,
+		StartDate:  res.StartDate.Format("2006-01-02"),
+		EndDate:    res.EndDate.Format("2006-01-02"),
+		TotalPrice: res.TotalPrice,
+		Processed:  res.Processed != 0,
+
+		ConfirmationCode: res.ConfirmationCode,
+		Cancelled:        res.Cancelled(),
+	}
+}
+
+// APIRooms returns every room at GET /api/v1/rooms
+func (m *Repository) APIRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.WriteAPIError(w, http.StatusInternalServerError, "Can't get rooms", nil)
+		return
+	}
+
+	resp := []apiRoom{}
+	for _, room := range rooms {
+		resp = append(resp, newAPIRoom(room))
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, resp)
+}
+
+// APIRoomAvailability returns if a room is free and what it costs at
+// GET /api/v1/rooms/{id}/availability?start=2050-01-02&end=2050-01-04
+func (m *Repository) APIRoomAvailability(w http.ResponseWriter, r *http.Request) {
+	exploded := strings.Split(r.URL.Path, "/")
+	if len(exploded) < 5 {
+		helpers.WriteAPIError(w, http.StatusNotFound, "Room not found", nil)
+		return
+	}
+
+	roomID, err := strconv.Atoi(exploded[4])
+	if err != nil {
+		helpers.WriteAPIError(w, http.StatusNotFound, "Room not found", nil)
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(r.Context(), roomID)
+	if err != nil {
+		helpers.WriteAPIError(w, http.StatusNotFound, "Room not found", nil)
+		return
+	}
+
+	form := forms.New(url.Values{
+		"start": {r.URL.Query().Get("start")},
+		"end":   {r.URL.Query().Get("end")},
+	})
+	startDate, endDate := m.stayDates(form, "start", "end")
+	if !form.Valid() {
+		helpers.WriteAPIError(w, http.StatusUnprocessableEntity, "Invalid dates", fieldErrors(form))
+		return
+	}
+
+	metrics.AvailabilitySearches.Inc()
+	available, err := m.DB.SearchAvailabilityByDatesByRoomID(r.Context(), startDate, endDate, roomID)
+	if err != nil {
+		helpers.WriteAPIError(w, http.StatusInternalServerError, "Can't search availability", nil)
+		return
+	}
+
+	// a stay shorter than the minimum is only an error when the room could be booked,
+	// a room taken for these dates is answered as such
+	quote, err := m.quoteStay(r.Context(), room, startDate, endDate)
+	var minStay pricing.MinStayError
+	if err != nil && (available || !errors.As(err, &minStay)) {
+		writeQuoteError(w, err, "end")
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, apiAvailability{
+		RoomID:     roomID,
+		StartDate:  startDate.Format("2006-01-02"),
+		EndDate:    endDate.Format("2006-01-02"),
+		Available:  available,
+		Nights:     len(quote.Nights),
+		TotalPrice: quote.Total,
+	})
+}
+
+// maxReservationBodySize is the largest JSON body accepted to book a room, in bytes
+const maxReservationBodySize = 8 << 10
+
+// APIPostReservation books a room at POST /api/v1/reservations
+func (m *Repository) APIPostReservation(w http.ResponseWriter, r *http.Request) {
+	var in apiReservation
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxReservationBodySize)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			helpers.WriteAPIError(w, http.StatusRequestEntityTooLarge, "Request body too large", nil)
+			return
+		}
+		helpers.WriteAPIError(w, http.StatusBadRequest, "Invalid JSON body", nil)
+		return
+	}
+
+	form := forms.New(url.Values{
+		"first_name": {in.FirstName},
+		"last_name":  {in.LastName},
+		"email":      {in.Email},
+		"phone":      {in.Phone},
+		"start_date": {in.StartDate},
+		"end_date":   {in.EndDate},
+	})
+
+	form.Required("first_name", "last_name", "email")
+	form.MinLenght("first_name", 3)
+	form.MaxLength("first_name", 100)
+	form.MaxLength("last_name", 100)
+	form.IsEmail("email")
+	form.IsPhone("phone")
+	startDate, endDate := m.stayDates(form, "start_date", "end_date")
+
+	room, err := m.DB.GetRoomByID(r.Context(), in.RoomID)
+	if err != nil {
+		form.Errors.Add("room_id", "Room not found")
+	}
+
+	if !form.Valid() {
+		helpers.WriteAPIError(w, http.StatusUnprocessableEntity, "Invalid reservation", fieldErrors(form))
+		return
+	}
+
+	quote, err := m.quoteStay(r.Context(), room, startDate, endDate)
+	if err != nil {
+		writeQuoteError(w, err, "end_date")
+		return
+	}
+
+	phone, _ := forms.E164(in.Phone)
+	reservation := models.Reservation{
+		FirstName:  in.FirstName,
+		LastName:   in.LastName,
+		Email:      in.Email,
+		Phone:      phone,
+		StartDate:  startDate,
+		EndDate:    endDate,
+		RoomID:     room.ID,
+		Room:       room,
+		TotalPrice: quote.Total,
+	}
+
+	token, err := newGuestAccess(&reservation)
+	if err != nil {
+		helpers.WriteAPIError(w, http.StatusInternalServerError, "Can't insert reservation", nil)
+		return
+	}
+
+	mails := m.reservationMails(r.Context(), i18n.FromContext(r.Context()), reservation, token)
+	reservation.ID, err = m.DB.BookReservation(r.Context(), reservation, mails)
+	if errors.Is(err, repository.ErrRoomNotAvailable) {
+		helpers.WriteAPIError(w, http.StatusConflict, "The room is not available for these dates", nil)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("can't book reservation", "error", err)
+		helpers.WriteAPIError(w, http.StatusInternalServerError, "Can't insert reservation", nil)
+		return
+	}
+	metrics.ReservationsCreated.Inc()
+	m.notifyMailQueue()
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/reservations/%d", reservation.ID))
+	helpers.WriteJSON(w, http.StatusCreated, newAPIReservation(reservation))
+}
+
+// APIReservation returns a reservation at GET /api/v1/reservations/{id}
+func (m *Repository) APIReservation(w http.ResponseWriter, r *http.Request) {
+	exploded := strings.Split(r.URL.Path, "/")
+	if len(exploded) < 5 {
+		helpers.WriteAPIError(w, http.StatusNotFound, "Reservation not found", nil)
+		return
+	}
+
+	id, err := strconv.Atoi(exploded[4])
+	if err != nil {
+		helpers.WriteAPIError(w, http.StatusNotFound, "Reservation not found", nil)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		helpers.WriteAPIError(w, http.StatusNotFound, "Reservation not found", nil)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, newAPIReservation(res))
+}
+
+// APINotFound returns a JSON error for unknown API routes
+func (m *Repository) APINotFound(w http.ResponseWriter, r *http.Request) {
+	helpers.WriteAPIError(w, http.StatusNotFound, "Not found", nil)
+}
+
+// APIMethodNotAllowed returns a JSON error for API routes called with the wrong method
+func (m *Repository) APIMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	helpers.WriteAPIError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+}
+
+// writeQuoteError writes the error of a stay that can't be priced, on endField when the dates are the cause
+func writeQuoteError(w http.ResponseWriter, err error, endField string) {
+	var minStay pricing.MinStayError
+	if errors.Is(err, pricing.ErrInvalidRange) || errors.As(err, &minStay) {
+		helpers.WriteAPIError(w, http.StatusUnprocessableEntity, "Invalid dates", map[string]string{
+			endField: quoteMessage(i18n.DefaultLocale, err),
+		})
+		return
+	}
+
+	helpers.WriteAPIError(w, http.StatusInternalServerError, quoteMessage(i18n.DefaultLocale, err), nil)
+}
+
+// fieldErrors returns the first error of each field of the form
+func fieldErrors(form *forms.Form) map[string]string {
+	fields := make(map[string]string)
+	for _, field := range form.Errors.Fields() {
+		fields[field] = form.Errors.Get(field)
+	}
+	return fields
+}
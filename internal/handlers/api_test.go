@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// apiErrorResponse is the body of a JSON API error
+type apiErrorResponse struct {
+	Error struct {
+		Status  int               `json:"status"`
+		Code    string            `json:"code"`
+		Message string            `json:"message"`
+		Fields  map[string]string `json:"fields"`
+	} `json:"error"`
+}
+
+var apiTests = []struct {
+	name               string
+	method             string
+	url                string
+	body               string
+	handler            func(*Repository, http.ResponseWriter, *http.Request)
+	expectedStatusCode int
+	expectedJSON       string
+	expectedField      string
+}{
+	{
+		name:               "rooms",
+		method:             "GET",
+		url:                "/api/v1/rooms",
+		handler:            (*Repository).APIRooms,
+		expectedStatusCode: http.StatusOK,
+		expectedJSON:       `"slug":"generals-quarters"`,
+	},
+	{
+		name:               "availability",
+		method:             "GET",
+		url:                "/api/v1/rooms/1/availability?start=2050-01-02&end=2050-01-04",
+		handler:            (*Repository).APIRoomAvailability,
+		expectedStatusCode: http.StatusOK,
+		expectedJSON:       `"available":true,"nights":2,"total_price":24000`,
+	},
+	{
+		name:               "availability-pricing-error",
+		method:             "GET",
+		url:                "/api/v1/rooms/2/availability?start=2050-01-02&end=2050-01-04",
+		handler:            (*Repository).APIRoomAvailability,
+		expectedStatusCode: http.StatusInternalServerError,
+	},
+	{
+		name:               "availability-invalid-date",
+		method:             "GET",
+		url:                "/api/v1/rooms/1/availability?start=2050-01-32&end=2050-01-04",
+		handler:            (*Repository).APIRoomAvailability,
+		expectedStatusCode: http.StatusUnprocessableEntity,
+		expectedField:      "start",
+	},
+	{
+		name:               "availability-missing-date",
+		method:             "GET",
+		url:                "/api/v1/rooms/1/availability?start=2050-01-02",
+		handler:            (*Repository).APIRoomAvailability,
+		expectedStatusCode: http.StatusUnprocessableEntity,
+		expectedField:      "end",
+	},
+	{
+		name:               "availability-min-stay",
+		method:             "GET",
+		url:                "/api/v1/rooms/1/availability?start=2049-12-24&end=2049-12-25",
+		handler:            (*Repository).APIRoomAvailability,
+		expectedStatusCode: http.StatusUnprocessableEntity,
+		expectedField:      "end",
+	},
+	{
+		name:               "availability-taken-min-stay",
+		method:             "GET",
+		url:                "/api/v1/rooms/4/availability?start=2049-12-24&end=2049-12-25",
+		handler:            (*Repository).APIRoomAvailability,
+		expectedStatusCode: http.StatusOK,
+		expectedJSON:       `"available":false,"nights":1`,
+	},
+	{
+		name:               "availability-room-not-found",
+		method:             "GET",
+		url:                "/api/v1/rooms/3/availability?start=2050-01-02&end=2050-01-04",
+		handler:            (*Repository).APIRoomAvailability,
+		expectedStatusCode: http.StatusNotFound,
+	},
+	{
+		name:               "availability-malformed-url",
+		method:             "GET",
+		url:                "/api/v1/rooms/fish/availability",
+		handler:            (*Repository).APIRoomAvailability,
+		expectedStatusCode: http.StatusNotFound,
+	},
+	{
+		name:               "create-reservation",
+		method:             "POST",
+		url:                "/api/v1/reservations",
+		body:               `{"room_id":1,"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2050-01-02","end_date":"2050-01-04"}`,
+		handler:            (*Repository).APIPostReservation,
+		expectedStatusCode: http.StatusCreated,
+		expectedJSON:       `"id":1,"room_id":1`,
+	},
+	{
+		name:               "create-reservation-invalid-json",
+		method:             "POST",
+		url:                "/api/v1/reservations",
+		body:               `{"room_id":"one"}`,
+		handler:            (*Repository).APIPostReservation,
+		expectedStatusCode: http.StatusBadRequest,
+	},
+	{
+		name:               "create-reservation-too-large",
+		method:             "POST",
+		url:                "/api/v1/reservations",
+		body:               `{"room_id":1,"first_name":"` + strings.Repeat("a", 10<<10) + `"}`,
+		handler:            (*Repository).APIPostReservation,
+		expectedStatusCode: http.StatusRequestEntityTooLarge,
+	},
+	{
+		name:               "create-reservation-invalid-data",
+		method:             "POST",
+		url:                "/api/v1/reservations",
+		body:               `{"room_id":1,"first_name":"John","last_name":"Smith","email":"not-an-email","start_date":"2050-01-02","end_date":"2050-01-04"}`,
+		handler:            (*Repository).APIPostReservation,
+		expectedStatusCode: http.StatusUnprocessableEntity,
+		expectedField:      "email",
+	},
+	{
+		name:               "create-reservation-room-not-found",
+		method:             "POST",
+		url:                "/api/v1/reservations",
+		body:               `{"room_id":3,"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2050-01-02","end_date":"2050-01-04"}`,
+		handler:            (*Repository).APIPostReservation,
+		expectedStatusCode: http.StatusUnprocessableEntity,
+		expectedField:      "room_id",
+	},
+	{
+		name:               "create-reservation-reversed-dates",
+		method:             "POST",
+		url:                "/api/v1/reservations",
+		body:               `{"room_id":1,"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2050-01-04","end_date":"2050-01-02"}`,
+		handler:            (*Repository).APIPostReservation,
+		expectedStatusCode: http.StatusUnprocessableEntity,
+		expectedField:      "end_date",
+	},
+	{
+		name:               "create-reservation-taken",
+		method:             "POST",
+		url:                "/api/v1/reservations",
+		body:               `{"room_id":4,"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2050-01-02","end_date":"2050-01-04"}`,
+		handler:            (*Repository).APIPostReservation,
+		expectedStatusCode: http.StatusConflict,
+	},
+	{
+		name:               "reservation",
+		method:             "GET",
+		url:                "/api/v1/reservations/1",
+		handler:            (*Repository).APIReservation,
+		expectedStatusCode: http.StatusOK,
+		expectedJSON:       `"first_name":"John"`,
+	},
+	{
+		name:               "reservation-not-found",
+		method:             "GET",
+		url:                "/api/v1/reservations/2",
+		handler:            (*Repository).APIReservation,
+		expectedStatusCode: http.StatusNotFound,
+	},
+}
+
+func TestAPI(t *testing.T) {
+	for _, e := range apiTests {
+		req, _ := http.NewRequest(e.method, e.url, strings.NewReader(e.body))
+		req.Header.Set("Content-Type", "application/json")
+
+		rr := httptest.NewRecorder()
+
+		e.handler(Repo, rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: expected a JSON response but got %s", e.name, ct)
+		}
+
+		if e.expectedJSON != "" && !strings.Contains(rr.Body.String(), e.expectedJSON) {
+			t.Errorf("%s: expected to find %s in %s", e.name, e.expectedJSON, rr.Body.String())
+		}
+
+		if rr.Code >= 400 {
+			var j apiErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &j); err != nil {
+				t.Errorf("%s: failed to parse error json: %v", e.name, err)
+			}
+
+			if j.Error.Status != rr.Code || j.Error.Message == "" {
+				t.Errorf("%s: unexpected error object %+v", e.name, j.Error)
+			}
+
+			if e.expectedField != "" && j.Error.Fields[e.expectedField] == "" {
+				t.Errorf("%s: expected an error on %s but got %v", e.name, e.expectedField, j.Error.Fields)
+			}
+		}
+	}
+}
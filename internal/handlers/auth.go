@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/forms"
+	"github.com/marcelofranco/webapp-go-demo/internal/helpers"
+	"github.com/marcelofranco/webapp-go-demo/internal/logging"
+	"github.com/marcelofranco/webapp-go-demo/internal/models"
+	"github.com/marcelofranco/webapp-go-demo/internal/render"
+)
+
+// maxSigninDelay caps the wait before checking a password
+const maxSigninDelay = 8 * time.Second
+
+// signinDelay returns the wait before checking a password after some failed sign ins:
+// none for the first ones, then doubling from a second
+func signinDelay(failures int) time.Duration {
+	if failures < 3 {
+		return 0
+	}
+	if failures > 6 {
+		return maxSigninDelay
+	}
+	return time.Second << (failures - 3)
+}
+
+// sleepContext waits for d, or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// recordAuthEvent adds an entry to the auth log. The request goes on when it can't
+func (m *Repository) recordAuthEvent(r *http.Request, e models.AuthEvent) {
+	if e.IP == "" {
+		e.IP = helpers.ClientIP(r)
+	}
+	if err := m.DB.InsertAuthEvent(r.Context(), e); err != nil {
+		logging.FromContext(r.Context()).Error("can't record auth event", "event", e.Event, "error", err)
+	}
+}
+
+// signinFailures returns the recent failed sign ins for an account and from an IP address
+func (m *Repository) signinFailures(ctx context.Context, email, ip string) (int, int, error) {
+	since := time.Now().Add(-m.App.SigninLockout)
+
+	byEmail, err := m.DB.CountSigninFailures(ctx, models.LockoutEmail, email, since)
+	if err != nil {
+		return 0, 0, err
+	}
+	byIP, err := m.DB.CountSigninFailures(ctx, models.LockoutIP, ip, since)
+	if err != nil {
+		return 0, 0, err
+	}
+	return byEmail, byIP, nil
+}
+
+// recordSigninFailure logs a failed sign in, and locks the account or the IP address out
+// when it reached its limit of failures
+func (m *Repository) recordSigninFailure(r *http.Request, email, ip string, byEmail, byIP int) {
+	m.recordAuthEvent(r, models.AuthEvent{Event: models.AuthSigninFailure, Email: email, IP: ip})
+
+	if byEmail >= m.App.SigninMaxFailures {
+		m.lockOut(r, models.LockoutEmail, email, ip, byEmail)
+	}
+	if byIP >= m.App.SigninIPMaxFailures {
+		m.lockOut(r, models.LockoutIP, ip, ip, byIP)
+	}
+}
+
+// checkPassword checks the password a signed in user gave in field of the form, counting a
+// wrong one as a failed sign in: it waits longer after each failure, is refused while the
+// account or the IP address is locked out and can lock them out. Problems are added to the
+// form as errors of field
+func (m *Repository) checkPassword(r *http.Request, form *forms.Form, field string, user models.User) {
+	email := strings.ToLower(strings.TrimSpace(user.Email))
+	ip := helpers.ClientIP(r)
+
+	lockedUntil, err := m.DB.LockedUntil(r.Context(), email, ip)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("can't check lockouts", "error", err)
+		form.Errors.Add(field, "Can't check the password now, try again later")
+		return
+	}
+	if !lockedUntil.IsZero() {
+		m.recordAuthEvent(r, models.AuthEvent{Event: models.AuthSigninLocked, Email: email, UserID: user.ID, IP: ip})
+		minutes := int(time.Until(lockedUntil).Minutes()) + 1
+		form.Errors.Add(field, "Too many failed sign in attempts, try again in %d minutes", minutes)
+		return
+	}
+
+	byEmail, byIP, err := m.signinFailures(r.Context(), email, ip)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("can't count failed sign ins", "error", err)
+	}
+	sleepContext(r.Context(), signinDelay(max(byEmail, byIP)))
+
+	if _, _, err := m.DB.Authenticate(r.Context(), user.Email, form.Get(field)); err != nil {
+		m.recordSigninFailure(r, email, ip, byEmail+1, byIP+1)
+		form.Errors.Add(field, "The current password is not correct")
+	}
+}
+
+// lockOut stops sign ins to an account or from an IP address for the lockout time
+func (m *Repository) lockOut(r *http.Request, kind, key, ip string, failures int) {
+	_, err := m.DB.InsertLockout(r.Context(), models.Lockout{
+		Kind:        kind,
+		Key:         key,
+		LockedUntil: time.Now().Add(m.App.SigninLockout),
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("can't lock out", "kind", kind, "key", key, "error", err)
+		return
+	}
+
+	logging.FromContext(r.Context()).Warn("locked out after failed sign ins", "kind", kind, "key", key, "failures", failures)
+	e := models.AuthEvent{Event: models.AuthLockout, IP: ip, Detail: fmt.Sprintf("%s locked out after %d failed sign ins", kind, failures)}
+	if kind == models.LockoutEmail {
+		e.Email = key
+	}
+	m.recordAuthEvent(r, e)
+}
+
+// AdminSecurity renders the active lockouts and the latest entries of the auth log
+func (m *Repository) AdminSecurity(w http.ResponseWriter, r *http.Request) {
+	lockouts, err := m.DB.ActiveLockouts(r.Context())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't get lockouts")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	events, err := m.DB.RecentAuthEvents(r.Context(), 100)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't get the auth log")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["lockouts"] = lockouts
+	data["events"] = events
+
+	render.RenderTemplate(w, r, "admin-security.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminLiftLockout ends the lockout at /admin/lockouts/{id}/lift before its time
+func (m *Repository) AdminLiftLockout(w http.ResponseWriter, r *http.Request) {
+	exploded := strings.Split(r.URL.Path, "/")
+	if len(exploded) < 4 {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/security", http.StatusSeeOther)
+		return
+	}
+
+	id, err := strconv.Atoi(exploded[3])
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/security", http.StatusSeeOther)
+		return
+	}
+
+	staffID := m.App.Session.GetInt(r.Context(), "user_id")
+	if err := m.DB.LiftLockout(r.Context(), id, staffID); err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't lift the lockout")
+		http.Redirect(w, r, "/admin/security", http.StatusSeeOther)
+		return
+	}
+
+	m.recordAuthEvent(r, models.AuthEvent{
+		Event:  models.AuthLockoutLifted,
+		UserID: staffID,
+		Detail: fmt.Sprintf("lockout %d lifted", id),
+	})
+
+	m.App.Session.Put(r.Context(), "flash", "Lockout lifted")
+	http.Redirect(w, r, "/admin/security", http.StatusSeeOther)
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSigninDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{6, 8 * time.Second},
+		{50, maxSigninDelay},
+	}
+
+	for _, e := range tests {
+		if got := signinDelay(e.failures); got != e.want {
+			t.Errorf("%d failures: expected %s but got %s", e.failures, e.want, got)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/forms"
+	"github.com/marcelofranco/webapp-go-demo/internal/helpers"
+	"github.com/marcelofranco/webapp-go-demo/internal/i18n"
+	"github.com/marcelofranco/webapp-go-demo/internal/logging"
+	"github.com/marcelofranco/webapp-go-demo/internal/models"
+	"github.com/marcelofranco/webapp-go-demo/internal/render"
+	"github.com/marcelofranco/webapp-go-demo/internal/repository"
+	"github.com/marcelofranco/webapp-go-demo/internal/tokens"
+)
+
+// confirmationCodeLength is the number of characters of a confirmation code
+const confirmationCodeLength = 8
+
+// newGuestAccess gives a reservation the confirmation code and the token hash guests use to
+// find it again, and returns the token to put in the link mailed to them
+func newGuestAccess(reservation *models.Reservation) (string, error) {
+	code, err := tokens.NewCode(confirmationCodeLength)
+	if err != nil {
+		return "", err
+	}
+	token, hash, err := tokens.New()
+	if err != nil {
+		return "", err
+	}
+
+	reservation.ConfirmationCode = code
+	reservation.AccessTokenHash = hash
+	return token, nil
+}
+
+// guestLink returns the link letting a guest manage a reservation
+func (m *Repository) guestLink(token string) string {
+	return fmt.Sprintf("%s/my-reservation?token=%s", strings.TrimSuffix(m.App.BaseURL, "/"), token)
+}
+
+// guestCanChange tells if a guest can still change or cancel a reservation, which is
+// no longer possible once the stay started
+func guestCanChange(reservation models.Reservation) bool {
+	return !reservation.Cancelled() && time.Now().Before(reservation.StartDate)
+}
+
+// guestReservation returns the reservation the guest opened with a link or a confirmation
+// code, or puts an error in the session when there is none
+func (m *Repository) guestReservation(r *http.Request) (models.Reservation, bool) {
+	id, ok := m.App.Session.Get(r.Context(), "guest_reservation_id").(int)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Find your reservation with its confirmation code first")
+		return models.Reservation{}, false
+	}
+
+	reservation, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't find the reservation")
+		return models.Reservation{}, false
+	}
+
+	return reservation, true
+}
+
+// renderGuestReservation renders the page of a reservation for the guest, with the dates of the form
+func renderGuestReservation(w http.ResponseWriter, r *http.Request, reservation models.Reservation, form *forms.Form) {
+	stringMap := map[string]string{
+		"start_date": reservation.StartDate.Format("2006-01-02"),
+		"end_date":   reservation.EndDate.Format("2006-01-02"),
+	}
+	if form.Has("start_date") {
+		stringMap["start_date"] = form.Get("start_date")
+	}
+	if form.Has("end_date") {
+		stringMap["end_date"] = form.Get("end_date")
+	}
+
+	render.RenderTemplate(w, r, "my-reservation.page.tmpl", &models.TemplateData{
+		Form:      form,
+		StringMap: stringMap,
+		Data: map[string]interface{}{
+			"reservation": reservation,
+			"can_change":  guestCanChange(reservation),
+		},
+	})
+}
+
+// FindReservation renders the page where guests find their reservation with its confirmation code
+func (m *Repository) FindReservation(w http.ResponseWriter, r *http.Request) {
+	render.RenderTemplate(w, r, "find-reservation.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// PostFindReservation opens the reservation matching a confirmation code and an email address.
+// A wrong code counts as a failed sign in, so that codes can't be tried one after the other
+func (m *Repository) PostFindReservation(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("confirmation_code", "email")
+	form.IsEmail("email")
+
+	if form.Valid() {
+		if reservation, ok := m.findReservation(r, form); ok {
+			_ = m.App.Session.RenewToken(r.Context())
+			m.App.Session.Put(r.Context(), "guest_reservation_id", reservation.ID)
+			http.Redirect(w, r, "/my-reservation", http.StatusSeeOther)
+			return
+		}
+	}
+
+	render.RenderTemplate(w, r, "find-reservation.page.tmpl", &models.TemplateData{
+		Form: form,
+	})
+}
+
+// findReservation returns the reservation matching the confirmation code and the email address
+// of the form. Like a sign in, it is refused while the address or the IP address is locked out,
+// waits longer after each failure and can lock them out. Problems are added to the form
+func (m *Repository) findReservation(r *http.Request, form *forms.Form) (models.Reservation, bool) {
+	email := strings.ToLower(strings.TrimSpace(form.Get("email")))
+	ip := helpers.ClientIP(r)
+
+	lockedUntil, err := m.DB.LockedUntil(r.Context(), email, ip)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("can't check lockouts", "error", err)
+		form.Errors.Add("confirmation_code", "Can't look for the reservation now, try again later")
+		return models.Reservation{}, false
+	}
+	if !lockedUntil.IsZero() {
+		m.recordAuthEvent(r, models.AuthEvent{Event: models.AuthSigninLocked, Email: email, IP: ip})
+		minutes := int(time.Until(lockedUntil).Minutes()) + 1
+		form.Errors.Add("confirmation_code", "Too many failed attempts, try again in %d minutes", minutes)
+		return models.Reservation{}, false
+	}
+
+	byEmail, byIP, err := m.signinFailures(r.Context(), email, ip)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("can't count failed sign ins", "error", err)
+	}
+	sleepContext(r.Context(), signinDelay(max(byEmail, byIP)))
+
+	code := strings.ToUpper(strings.TrimSpace(form.Get("confirmation_code")))
+	reservation, err := m.DB.GetReservationByConfirmationCode(r.Context(), code)
+	// the same answer for both, so that codes can't be found without the address
+	if err != nil || !strings.EqualFold(reservation.Email, email) {
+		m.recordSigninFailure(r, email, ip, byEmail+1, byIP+1)
+		form.Errors.Add("confirmation_code", "No reservation matches this code and email address")
+		return models.Reservation{}, false
+	}
+	return reservation, true
+}
+
+// MyReservation renders the reservation the guest opened. Opened with the token of the
+// link mailed to the guest, it remembers the reservation and drops the token from the URL
+func (m *Repository) MyReservation(w http.ResponseWriter, r *http.Request) {
+	if token := r.URL.Query().Get("token"); token != "" {
+		reservation, err := m.DB.GetReservationByAccessToken(r.Context(), tokens.Hash(token))
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "This link is invalid, find your reservation with its confirmation code")
+			http.Redirect(w, r, "/find-reservation", http.StatusSeeOther)
+			return
+		}
+		// the token came in a url, the session it opens gets a new one
+		_ = m.App.Session.RenewToken(r.Context())
+		m.App.Session.Put(r.Context(), "guest_reservation_id", reservation.ID)
+		http.Redirect(w, r, "/my-reservation", http.StatusSeeOther)
+		return
+	}
+
+	reservation, ok := m.guestReservation(r)
+	if !ok {
+		http.Redirect(w, r, "/find-reservation", http.StatusSeeOther)
+		return
+	}
+
+	renderGuestReservation(w, r, reservation, forms.New(nil))
+}
+
+// PostChangeReservation moves the reservation the guest opened to new dates, when the
+// room is still free then
+func (m *Repository) PostChangeReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := m.guestReservation(r)
+	if !ok {
+		http.Redirect(w, r, "/find-reservation", http.StatusSeeOther)
+		return
+	}
+	if !guestCanChange(reservation) {
+		m.App.Session.Put(r.Context(), "error", "This reservation can't be changed anymore")
+		http.Redirect(w, r, "/my-reservation", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, "/my-reservation", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	startDate, endDate := m.stayDates(form, "start_date", "end_date")
+
+	var total int
+	if form.Valid() {
+		quote, err := m.quoteRoom(r.Context(), reservation.RoomID, startDate, endDate)
+		if err != nil {
+			form.Errors.Add("end_date", quoteMessage(i18n.FromContext(r.Context()), err))
+		}
+		total = quote.Total
+	}
+
+	if !form.Valid() {
+		renderGuestReservation(w, r, reservation, form)
+		return
+	}
+
+	previous := reservation
+	reservation.StartDate = startDate
+	reservation.EndDate = endDate
+	reservation.TotalPrice = total
+
+	mails := m.guestChangeMails(r.Context(), i18n.FromContext(r.Context()), previous, reservation, "changed")
+	err := m.DB.ChangeReservationDates(r.Context(), reservation, mails)
+	if errors.Is(err, repository.ErrRoomNotAvailable) {
+		form.Errors.Add("start_date", "Sorry, the room is not available for these dates")
+		w.WriteHeader(http.StatusConflict)
+		renderGuestReservation(w, r, previous, form)
+		return
+	}
+	if errors.Is(err, repository.ErrReservationCancelled) {
+		m.App.Session.Put(r.Context(), "error", "This reservation was already cancelled")
+		http.Redirect(w, r, "/my-reservation", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("can't change reservation", "reservation_id", reservation.ID, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Can't change the reservation, try again later")
+		http.Redirect(w, r, "/my-reservation", http.StatusSeeOther)
+		return
+	}
+
+	m.notifyMailQueue()
+
+	m.App.Session.Put(r.Context(), "flash", "Your reservation was changed.")
+	http.Redirect(w, r, "/my-reservation", http.StatusSeeOther)
+}
+
+// PostCancelReservation cancels the reservation the guest opened, which frees the room
+func (m *Repository) PostCancelReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := m.guestReservation(r)
+	if !ok {
+		http.Redirect(w, r, "/find-reservation", http.StatusSeeOther)
+		return
+	}
+	if !guestCanChange(reservation) {
+		m.App.Session.Put(r.Context(), "error", "This reservation can't be cancelled anymore")
+		http.Redirect(w, r, "/my-reservation", http.StatusSeeOther)
+		return
+	}
+
+	mails := m.guestChangeMails(r.Context(), i18n.FromContext(r.Context()), reservation, reservation, "cancelled")
+	err := m.DB.CancelReservation(r.Context(), reservation.ID, mails)
+	if errors.Is(err, repository.ErrReservationCancelled) {
+		m.App.Session.Put(r.Context(), "error", "This reservation was already cancelled")
+		http.Redirect(w, r, "/my-reservation", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("can't cancel reservation", "reservation_id", reservation.ID, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Can't cancel the reservation, try again later")
+		http.Redirect(w, r, "/my-reservation", http.StatusSeeOther)
+		return
+	}
+
+	m.notifyMailQueue()
+
+	m.App.Session.Put(r.Context(), "flash", "Your reservation was cancelled.")
+	http.Redirect(w, r, "/my-reservation", http.StatusSeeOther)
+}
+
+// guestChangeMails renders the mails letting the guest, in locale, and the owner know the
+// guest changed or cancelled a reservation, previous being the reservation before the change
+func (m *Repository) guestChangeMails(ctx context.Context, locale string, previous, reservation models.Reservation, change string) []models.MailData {
+	data := models.ReservationMailData{Reservation: reservation, Previous: previous, Change: change}
+
+	return m.renderMails(ctx,
+		models.MailData{
+			From:     m.App.MailFrom,
+			To:       reservation.Email,
+			Subject:  "Reservation " + change,
+			Template: "reservation-change.mail.tmpl",
+			Data:     data,
+			Locale:   locale,
+		},
+		models.MailData{
+			From:     m.App.MailFrom,
+			To:       m.App.OwnerEmail,
+			Subject:  "Reservation " + change,
+			Template: "reservation-change-owner.mail.tmpl",
+			Data:     data,
+		},
+	)
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+var guestTests = []struct {
+	name               string
+	method             string
+	url                string
+	reservationID      int
+	postedData         url.Values
+	handler            func(*Repository, http.ResponseWriter, *http.Request)
+	expectedStatusCode int
+	expectedLocation   string
+	expectedHTML       string
+	expectedFlash      string
+	expectedError      string
+	expectedNewToken   bool
+}{
+	{
+		name:               "find-reservation",
+		method:             "GET",
+		url:                "/find-reservation",
+		handler:            (*Repository).FindReservation,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `action="/find-reservation"`,
+	},
+	{
+		name:               "post-find-reservation",
+		method:             "POST",
+		url:                "/find-reservation",
+		postedData:         url.Values{"confirmation_code": {" abcd2345 "}, "email": {"John@Smith.com"}},
+		handler:            (*Repository).PostFindReservation,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/my-reservation",
+		expectedNewToken:   true,
+	},
+	{
+		name:               "post-find-reservation-other-email",
+		method:             "POST",
+		url:                "/find-reservation",
+		postedData:         url.Values{"confirmation_code": {"ABCD2345"}, "email": {"jane@smith.com"}},
+		handler:            (*Repository).PostFindReservation,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "No reservation matches this code and email address",
+	},
+	{
+		name:               "post-find-reservation-unknown-code",
+		method:             "POST",
+		url:                "/find-reservation",
+		postedData:         url.Values{"confirmation_code": {"ZZZZ2345"}, "email": {"john@smith.com"}},
+		handler:            (*Repository).PostFindReservation,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "No reservation matches this code and email address",
+	},
+	{
+		name:               "post-find-reservation-locked",
+		method:             "POST",
+		url:                "/find-reservation",
+		postedData:         url.Values{"confirmation_code": {"ABCD2345"}, "email": {"locked@here.com"}},
+		handler:            (*Repository).PostFindReservation,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "Too many failed attempts, try again in",
+	},
+	{
+		name:               "my-reservation-link",
+		method:             "GET",
+		url:                "/my-reservation?token=guest-token",
+		handler:            (*Repository).MyReservation,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/my-reservation",
+		expectedNewToken:   true,
+	},
+	{
+		name:               "my-reservation-invalid-link",
+		method:             "GET",
+		url:                "/my-reservation?token=other-token",
+		handler:            (*Repository).MyReservation,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/find-reservation",
+	},
+	{
+		name:               "my-reservation",
+		method:             "GET",
+		url:                "/my-reservation",
+		reservationID:      5,
+		handler:            (*Repository).MyReservation,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `action="/my-reservation/cancel"`,
+	},
+	{
+		name:               "my-reservation-cancelled",
+		method:             "GET",
+		url:                "/my-reservation",
+		reservationID:      7,
+		handler:            (*Repository).MyReservation,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "This reservation was cancelled",
+	},
+	{
+		name:               "my-reservation-not-found",
+		method:             "GET",
+		url:                "/my-reservation",
+		handler:            (*Repository).MyReservation,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/find-reservation",
+	},
+	{
+		name:               "change-dates",
+		method:             "POST",
+		url:                "/my-reservation/dates",
+		reservationID:      5,
+		postedData:         url.Values{"start_date": {inDays(40)}, "end_date": {inDays(43)}},
+		handler:            (*Repository).PostChangeReservation,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/my-reservation",
+		expectedFlash:      "Your reservation was changed.",
+	},
+	{
+		name:               "change-dates-taken",
+		method:             "POST",
+		url:                "/my-reservation/dates",
+		reservationID:      6,
+		postedData:         url.Values{"start_date": {inDays(40)}, "end_date": {inDays(43)}},
+		handler:            (*Repository).PostChangeReservation,
+		expectedStatusCode: http.StatusConflict,
+		expectedHTML:       "Sorry, the room is not available for these dates",
+	},
+	{
+		name:               "change-dates-past",
+		method:             "POST",
+		url:                "/my-reservation/dates",
+		reservationID:      5,
+		postedData:         url.Values{"start_date": {inDays(-2)}, "end_date": {inDays(1)}},
+		handler:            (*Repository).PostChangeReservation,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "The arrival date can&#39;t be in the past",
+	},
+	{
+		name:               "change-dates-reversed",
+		method:             "POST",
+		url:                "/my-reservation/dates",
+		reservationID:      5,
+		postedData:         url.Values{"start_date": {inDays(43)}, "end_date": {inDays(40)}},
+		handler:            (*Repository).PostChangeReservation,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "The departure date must be after the arrival date",
+	},
+	{
+		name:               "change-dates-invalid",
+		method:             "POST",
+		url:                "/my-reservation/dates",
+		reservationID:      5,
+		postedData:         url.Values{"start_date": {"soon"}, "end_date": {inDays(43)}},
+		handler:            (*Repository).PostChangeReservation,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "Use a date like 2006-01-02",
+	},
+	{
+		name:               "change-dates-cancelled",
+		method:             "POST",
+		url:                "/my-reservation/dates",
+		reservationID:      7,
+		postedData:         url.Values{"start_date": {inDays(40)}, "end_date": {inDays(43)}},
+		handler:            (*Repository).PostChangeReservation,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/my-reservation",
+	},
+	{
+		name:               "change-dates-cancelled-meanwhile",
+		method:             "POST",
+		url:                "/my-reservation/dates",
+		reservationID:      8,
+		postedData:         url.Values{"start_date": {inDays(40)}, "end_date": {inDays(43)}},
+		handler:            (*Repository).PostChangeReservation,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/my-reservation",
+		expectedError:      "This reservation was already cancelled",
+	},
+	{
+		name:               "cancel",
+		method:             "POST",
+		url:                "/my-reservation/cancel",
+		reservationID:      5,
+		postedData:         url.Values{},
+		handler:            (*Repository).PostCancelReservation,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/my-reservation",
+		expectedFlash:      "Your reservation was cancelled.",
+	},
+	{
+		name:               "cancel-cancelled-meanwhile",
+		method:             "POST",
+		url:                "/my-reservation/cancel",
+		reservationID:      8,
+		postedData:         url.Values{},
+		handler:            (*Repository).PostCancelReservation,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/my-reservation",
+		expectedError:      "This reservation was already cancelled",
+	},
+	{
+		name:               "cancel-started",
+		method:             "POST",
+		url:                "/my-reservation/cancel",
+		reservationID:      1,
+		postedData:         url.Values{},
+		handler:            (*Repository).PostCancelReservation,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/my-reservation",
+	},
+}
+
+// inDays returns the date n days from today as posted by the forms
+func inDays(n int) string {
+	return time.Now().AddDate(0, 0, n).Format("2006-01-02")
+}
+
+func TestGuestSelfService(t *testing.T) {
+	for _, e := range guestTests {
+		var req *http.Request
+		if e.postedData != nil {
+			req, _ = http.NewRequest(e.method, e.url, strings.NewReader(e.postedData.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req, _ = http.NewRequest(e.method, e.url, nil)
+		}
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		if e.reservationID > 0 {
+			session.Put(ctx, "guest_reservation_id", e.reservationID)
+		}
+		rr := httptest.NewRecorder()
+
+		e.handler(Repo, rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if e.expectedLocation != "" {
+			if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+				t.Errorf("%s: expected location %s but got %s", e.name, e.expectedLocation, loc)
+			}
+		}
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("%s: expected to find %s but did not", e.name, e.expectedHTML)
+		}
+		if e.expectedFlash != "" {
+			if flash := session.PopString(ctx, "flash"); flash != e.expectedFlash {
+				t.Errorf("%s: expected flash %q but got %q", e.name, e.expectedFlash, flash)
+			}
+		}
+		if e.expectedNewToken && session.Token(ctx) == "" {
+			t.Errorf("%s: expected the session to get a new token", e.name)
+		}
+		if e.expectedError != "" {
+			if msg := session.PopString(ctx, "error"); msg != e.expectedError {
+				t.Errorf("%s: expected error %q but got %q", e.name, e.expectedError, msg)
+			}
+		}
+	}
+}
@@ -1,17 +1,28 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/marcelofranco/webapp-go-demo/internal/booking"
 	"github.com/marcelofranco/webapp-go-demo/internal/config"
 	"github.com/marcelofranco/webapp-go-demo/internal/driver"
 	"github.com/marcelofranco/webapp-go-demo/internal/forms"
+	"github.com/marcelofranco/webapp-go-demo/internal/helpers"
+	"github.com/marcelofranco/webapp-go-demo/internal/i18n"
+	"github.com/marcelofranco/webapp-go-demo/internal/logging"
+	"github.com/marcelofranco/webapp-go-demo/internal/metrics"
 	"github.com/marcelofranco/webapp-go-demo/internal/models"
+	"github.com/marcelofranco/webapp-go-demo/internal/pricing"
 	"github.com/marcelofranco/webapp-go-demo/internal/render"
 	"github.com/marcelofranco/webapp-go-demo/internal/repository"
 	"github.com/marcelofranco/webapp-go-demo/internal/repository/dbrepo"
@@ -66,7 +77,7 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	room, err := m.DB.GetRoomByID(res.RoomID)
+	room, err := m.DB.GetRoomByID(r.Context(), res.RoomID)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "Can't find room")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -118,7 +129,12 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 
 	form.Required("first_name", "last_name", "email")
 	form.MinLenght("first_name", 3)
+	form.MaxLength("first_name", 100)
+	form.MaxLength("last_name", 100)
 	form.IsEmail("email")
+	if form.IsPhone("phone") {
+		reservation.Phone, _ = forms.E164(reservation.Phone)
+	}
 
 	if !form.Valid() {
 		data := make(map[string]interface{})
@@ -137,132 +153,191 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	reservationID, err := m.DB.InsertReservation(reservation)
+	token, err := newGuestAccess(&reservation)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "Can't insert reservation")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	rr := models.RoomRestriction{
-		StartDate:     reservation.StartDate,
-		EndDate:       reservation.EndDate,
-		RoomID:        reservation.RoomID,
-		ReservationID: reservationID,
-		RestrictionID: 1,
-	}
+	mails := m.reservationMails(r.Context(), i18n.FromContext(r.Context()), reservation, token)
+	reservation.ID, err = m.DB.BookReservation(r.Context(), reservation, mails)
+	if errors.Is(err, repository.ErrRoomNotAvailable) {
+		form.Errors.Add("room", "Sorry, this room was just booked for these dates. Please search again.")
+
+		data := make(map[string]interface{})
+		data["reservation"] = reservation
+
+		stringMap := make(map[string]string)
+		stringMap["start_date"] = reservation.StartDate.Format("2006-01-02")
+		stringMap["end_date"] = reservation.EndDate.Format("2006-01-02")
 
-	err = m.DB.InsertRoomRestriction(rr)
+		w.WriteHeader(http.StatusConflict)
+		render.RenderTemplate(w, r, "make-reservation.page.tmpl", &models.TemplateData{
+			Form:      form,
+			Data:      data,
+			StringMap: stringMap,
+		})
+		return
+	}
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't insert room restriction")
+		logging.FromContext(r.Context()).Error("can't book reservation", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Can't insert reservation")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
+	metrics.ReservationsCreated.Inc()
+	m.notifyMailQueue()
 
-	htmlMsg := fmt.Sprintf(`
-	<strong>Reservation Confirmation</strong><br>
-	Dear, %s:<br>
-	This is to confirm your reservation from %s to %s.
-	`, reservation.FirstName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
+	m.App.Session.Put(r.Context(), "reservation", reservation)
 
-	//SEND NOTIFICATIONS
-	msg := models.MailData{
-		From:     "me@here.com",
-		To:       reservation.Email,
-		Subject:  "Reservation confirmation",
-		Content:  htmlMsg,
-		Template: "basic.html",
-	}
-	m.App.MailChan <- msg
+	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+}
 
-	htmlMsg = fmt.Sprintf(`
-	<strong>Room Reserved</strong><br>
-	Dear, Owner:<br>
-	This is to inform that room %s was reserved from %s to %s.
-	`, reservation.Room.RoomName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
+// reservationMails renders the confirmation to the guest in locale, with the link to manage
+// the reservation using token, and the mail letting the owner know about a reservation. They
+// are stored in the outbox along with the reservation
+func (m *Repository) reservationMails(ctx context.Context, locale string, reservation models.Reservation, token string) []models.MailData {
+	return m.renderMails(ctx,
+		models.MailData{
+			From:     m.App.MailFrom,
+			To:       reservation.Email,
+			Subject:  "Reservation confirmation",
+			Template: "reservation-confirmation.mail.tmpl",
+			Data:     models.ReservationMailData{Reservation: reservation, Link: m.guestLink(token)},
+			Locale:   locale,
+		},
+		models.MailData{
+			From:     m.App.MailFrom,
+			To:       m.App.OwnerEmail,
+			Subject:  "Room Reserved",
+			Template: "reservation-owner.mail.tmpl",
+			Data:     models.ReservationMailData{Reservation: reservation},
+		},
+	)
+}
 
-	//SEND NOTIFICATIONS
-	msg = models.MailData{
-		From:    "me@here.com",
-		To:      "owner@room.com",
-		Subject: "Room Reserved",
-		Content: htmlMsg,
+// renderMails renders mails for the outbox. A mail which can't be rendered is logged and
+// left out rather than sent empty
+func (m *Repository) renderMails(ctx context.Context, mails ...models.MailData) []models.MailData {
+	var rendered []models.MailData
+	for _, mail := range mails {
+		mail, err := render.RenderMail(mail)
+		if err != nil {
+			metrics.MailFailed.Inc()
+			logging.FromContext(ctx).Error("can't render mail, it is not sent", "to", mail.To, "template", mail.Template, "error", err)
+			continue
+		}
+		rendered = append(rendered, mail)
 	}
-	m.App.MailChan <- msg
+	return rendered
+}
 
-	m.App.Session.Put(r.Context(), "reservation", reservation)
+// queueMail renders a mail and stores it in the outbox, for the mails which are not about
+// a change made in the same transaction
+func (m *Repository) queueMail(ctx context.Context, mail models.MailData) error {
+	for _, mail := range m.renderMails(ctx, mail) {
+		if _, err := m.DB.EnqueueMail(ctx, mail); err != nil {
+			return err
+		}
+	}
+	m.notifyMailQueue()
+	return nil
+}
 
-	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+// notifyMailQueue wakes the mail queue up to send the mail just stored in the outbox
+func (m *Repository) notifyMailQueue() {
+	if m.App.MailQueue != nil {
+		m.App.MailQueue.Notify()
+	}
 }
 
 func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request) {
 	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 	if !ok {
-		m.App.ErrorLog.Println("Can't get error from session")
+		logging.FromContext(r.Context()).Warn("no reservation in session")
 		m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	sd := reservation.StartDate.Format("2006-01-02")
-	ed := reservation.EndDate.Format("2006-01-02")
-
-	stringMap := make(map[string]string)
-	stringMap["start_date"] = sd
-	stringMap["end_date"] = ed
-
 	m.App.Session.Remove(r.Context(), "reservation")
 	data := make(map[string]interface{})
 	data["reservation"] = reservation
 
 	render.RenderTemplate(w, r, "reservation-summary.page.tmpl", &models.TemplateData{
-		Data:      data,
-		StringMap: stringMap,
+		Data: data,
 	})
 }
 
-// Generals renders the rooms page
-func (m *Repository) Generals(w http.ResponseWriter, r *http.Request) {
-	render.RenderTemplate(w, r, "generals.page.tmpl", &models.TemplateData{})
+// Rooms renders the list of rooms
+func (m *Repository) Rooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't get rooms")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+
+	render.RenderTemplate(w, r, "rooms.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
 }
 
-// Majors renders the rooms page
-func (m *Repository) Majors(w http.ResponseWriter, r *http.Request) {
-	render.RenderTemplate(w, r, "majors.page.tmpl", &models.TemplateData{})
+// Room renders the page of a room found by the slug in /rooms/{slug}
+func (m *Repository) Room(w http.ResponseWriter, r *http.Request) {
+	exploded := strings.Split(r.URL.Path, "/")
+	if len(exploded) < 3 || exploded[2] == "" {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/rooms", http.StatusSeeOther)
+		return
+	}
+
+	room, err := m.DB.GetRoomBySlug(r.Context(), exploded[2])
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't find room")
+		http.Redirect(w, r, "/rooms", http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["room"] = room
+
+	render.RenderTemplate(w, r, "room.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
 }
 
 // Availability renders the availability page
 func (m *Repository) Availability(w http.ResponseWriter, r *http.Request) {
-	render.RenderTemplate(w, r, "search-availability.page.tmpl", &models.TemplateData{})
+	render.RenderTemplate(w, r, "search-availability.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+	})
 }
 
 // PostAvailability renders the availability page
 func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse form!")
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	sd := r.Form.Get("start_date")
-	ed := r.Form.Get("end_date")
-	layout := "2006-01-02"
-
-	startDate, err := time.Parse(layout, sd)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse start date!")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
-	}
-	endDate, err := time.Parse(layout, ed)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse end date!")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+	form := forms.New(r.PostForm)
+	startDate, endDate := m.stayDates(form, "start_date", "end_date")
+	if !form.Valid() {
+		render.RenderTemplate(w, r, "search-availability.page.tmpl", &models.TemplateData{
+			Form: form,
+		})
 		return
 	}
 
-	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	metrics.AvailabilitySearches.Inc()
+	rooms, err := m.DB.SearchAvailabilityForAllRooms(r.Context(), startDate, endDate)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't get availability for rooms")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -275,8 +350,22 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	quotes := make(map[int]pricing.Quote)
+	for _, room := range rooms {
+		quote, err := m.quoteStay(r.Context(), room, startDate, endDate)
+		// rooms with a longer minimum stay are still listed, with their minimum
+		var minStay pricing.MinStayError
+		if err != nil && !errors.As(err, &minStay) {
+			m.App.Session.Put(r.Context(), "error", quoteMessage(i18n.FromContext(r.Context()), err))
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		}
+		quotes[room.ID] = quote
+	}
+
 	data := make(map[string]interface{})
 	data["rooms"] = rooms
+	data["quotes"] = quotes
 
 	res := models.Reservation{
 		StartDate: startDate,
@@ -291,11 +380,15 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 }
 
 type jsonResponse struct {
-	OK        bool   `json:"ok"`
-	Message   string `json:"message"`
-	RoomID    string `json:"room_id"`
-	StartDate string `json:"start_date"`
-	EndDate   string `json:"end_date"`
+	OK         bool   `json:"ok"`
+	Message    string `json:"message"`
+	RoomID     string `json:"room_id"`
+	StartDate  string `json:"start_date"`
+	EndDate    string `json:"end_date"`
+	Nights     int    `json:"nights"`
+	TotalPrice int    `json:"total_price"` // in cents
+
+	Fields map[string]string `json:"fields,omitempty"`
 }
 
 // AvailabilityJSON handles request for availability and returns reponse
@@ -317,12 +410,33 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 
 	sd := r.Form.Get("start_modal")
 	ed := r.Form.Get("end_modal")
-	layout := "2006-01-02"
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
 	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
 
-	available, err := m.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, roomID)
+	form := forms.New(r.PostForm)
+	startDate, endDate := m.stayDates(form, "start_modal", "end_modal")
+	if !form.Valid() {
+		// the message is the first problem, to be shown as it is, the fields have them all
+		form.Localize(i18n.FromContext(r.Context()))
+		resp := jsonResponse{
+			OK:        false,
+			Message:   form.Errors.Get("start_modal"),
+			RoomID:    strconv.Itoa(roomID),
+			StartDate: sd,
+			EndDate:   ed,
+			Fields:    fieldErrors(form),
+		}
+		if resp.Message == "" {
+			resp.Message = form.Errors.Get("end_modal")
+		}
+
+		out, _ := json.Marshal(resp)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
+
+	metrics.AvailabilitySearches.Inc()
+	available, err := m.DB.SearchAvailabilityByDatesByRoomID(r.Context(), startDate, endDate, roomID)
 	if err != nil {
 		// can't parse form, so return appropriate json
 		resp := jsonResponse{
@@ -344,6 +458,16 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 		RoomID:    strconv.Itoa(roomID),
 	}
 
+	if available {
+		quote, err := m.quoteRoom(r.Context(), roomID, startDate, endDate)
+		if err != nil {
+			res.OK = false
+			res.Message = quoteMessage(i18n.FromContext(r.Context()), err)
+		}
+		res.Nights = len(quote.Nights)
+		res.TotalPrice = quote.Total
+	}
+
 	out, _ := json.Marshal(res)
 
 	w.Header().Set("Content-Type", "application/json")
@@ -371,7 +495,15 @@ func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	quote, err := m.quoteRoom(r.Context(), roomID, res.StartDate, res.EndDate)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", quoteMessage(i18n.FromContext(r.Context()), err))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
 	res.RoomID = roomID
+	res.TotalPrice = quote.Total
 
 	m.App.Session.Put(r.Context(), "reservation", res)
 
@@ -385,26 +517,32 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
-	startDate := r.URL.Query().Get("s")
-	endDate := r.URL.Query().Get("e")
-	layout := "2006-01-02"
-	sd, err := time.Parse(layout, startDate)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse start date!")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+
+	// the dates come from a link, the search form shows what is wrong with them
+	form := forms.New(url.Values{
+		"start_date": {r.URL.Query().Get("s")},
+		"end_date":   {r.URL.Query().Get("e")},
+	})
+	sd, ed := m.stayDates(form, "start_date", "end_date")
+	if !form.Valid() {
+		render.RenderTemplate(w, r, "search-availability.page.tmpl", &models.TemplateData{
+			Form: form,
+		})
 		return
 	}
-	ed, err := time.Parse(layout, endDate)
+
+	quote, err := m.quoteRoom(r.Context(), roomID, sd, ed)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse end date!")
+		m.App.Session.Put(r.Context(), "error", quoteMessage(i18n.FromContext(r.Context()), err))
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
 	res := models.Reservation{
-		RoomID:    roomID,
-		StartDate: sd,
-		EndDate:   ed,
+		RoomID:     roomID,
+		StartDate:  sd,
+		EndDate:    ed,
+		TotalPrice: quote.Total,
 	}
 
 	m.App.Session.Put(r.Context(), "reservation", res)
@@ -412,6 +550,51 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
 }
 
+// stayDates parses the arrival and departure of a stay and checks them against the booking
+// rules of the settings, adding field errors to the form
+func (m *Repository) stayDates(form *forms.Form, startField, endField string) (time.Time, time.Time) {
+	rules := booking.Rules{
+		MinNights:     m.App.BookingMinNights,
+		MaxNights:     m.App.BookingMaxNights,
+		HorizonDays:   m.App.BookingHorizonDays,
+		SameDayCutoff: m.App.BookingSameDayCutoff,
+	}
+	return rules.Check(form, startField, endField, time.Now())
+}
+
+// quoteRoom prices a stay in the room with the given id
+func (m *Repository) quoteRoom(ctx context.Context, roomID int, start, end time.Time) (pricing.Quote, error) {
+	room, err := m.DB.GetRoomByID(ctx, roomID)
+	if err != nil {
+		return pricing.Quote{}, err
+	}
+
+	return m.quoteStay(ctx, room, start, end)
+}
+
+// quoteStay prices a stay in a room, applying the seasonal rates of the room
+func (m *Repository) quoteStay(ctx context.Context, room models.Room, start, end time.Time) (pricing.Quote, error) {
+	seasons, err := m.DB.GetSeasonsForRoom(ctx, room.ID)
+	if err != nil {
+		return pricing.Quote{}, err
+	}
+
+	return pricing.Calculate(room, seasons, start, end)
+}
+
+// quoteMessage returns the message shown to the guest in locale when a stay can't be priced
+func quoteMessage(locale string, err error) string {
+	var minStay pricing.MinStayError
+	switch {
+	case errors.Is(err, pricing.ErrInvalidRange):
+		return i18n.T(locale, "The departure date must be after the arrival date")
+	case errors.As(err, &minStay):
+		return i18n.T(locale, "The minimum stay for these dates is %d nights", minStay.MinNights)
+	default:
+		return i18n.T(locale, "Can't get the price for this room")
+	}
+}
+
 // PostSignUp handles post sign up request
 func (m *Repository) PostSignUp(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
@@ -425,6 +608,7 @@ func (m *Repository) PostSignUp(w http.ResponseWriter, r *http.Request) {
 	user.LastName = r.Form.Get("last_name")
 	user.Email = r.Form.Get("email")
 	user.Password = r.Form.Get("password")
+	user.Locale = i18n.FromContext(r.Context())
 
 	form := forms.New(r.PostForm)
 
@@ -434,7 +618,7 @@ func (m *Repository) PostSignUp(w http.ResponseWriter, r *http.Request) {
 	form.IsEmail("email")
 	form.ValidPassword("password")
 
-	_, err := m.DB.GetUserByEmail(user.Email)
+	_, err := m.DB.GetUserByEmail(r.Context(), user.Email)
 	if form.Valid() && err == nil {
 		form.Errors.Add("email", "Email already registered")
 	}
@@ -450,14 +634,19 @@ func (m *Repository) PostSignUp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = m.DB.CreateUser(user)
+	user.ID, err = m.DB.CreateUser(r.Context(), user)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "Can't insert user")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	m.App.Session.Put(r.Context(), "flash", "Register successfully, you can login now.")
+	if err := m.sendVerification(r.Context(), user); err != nil {
+		logging.FromContext(r.Context()).Error("can't send verification", "user_id", user.ID, "error", err)
+		m.App.Session.Put(r.Context(), "warning", "Register successfully, you can login now. We couldn't mail the link to verify your address, ask for a new one once signed in.")
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Register successfully, you can login now. Open the link we mailed you to verify your address.")
+	}
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -482,20 +671,65 @@ func (m *Repository) Signin(w http.ResponseWriter, r *http.Request) {
 	user.Email = r.Form.Get("username_login")
 	user.Password = r.Form.Get("password_login")
 
-	id, _, err := m.DB.Authenticate(user.Email, user.Password)
+	email := strings.ToLower(strings.TrimSpace(user.Email))
+	ip := helpers.ClientIP(r)
+
+	lockedUntil, err := m.DB.LockedUntil(r.Context(), email, ip)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("can't check lockouts", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Can't sign in now, try again later")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		m.recordAuthEvent(r, models.AuthEvent{Event: models.AuthSigninLocked, Email: email, IP: ip})
+		minutes := int(time.Until(lockedUntil).Minutes()) + 1
+		m.App.Session.Put(r.Context(), "error", i18n.T(i18n.FromContext(r.Context()),
+			"Too many failed sign in attempts, try again in %d minutes", minutes))
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	// each failure makes the next attempt wait longer
+	byEmail, byIP, err := m.signinFailures(r.Context(), email, ip)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("can't count failed sign ins", "error", err)
+	}
+	sleepContext(r.Context(), signinDelay(max(byEmail, byIP)))
+
+	id, _, err := m.DB.Authenticate(r.Context(), user.Email, user.Password)
 	if err != nil {
+		m.recordSigninFailure(r, email, ip, byEmail+1, byIP+1)
 		m.App.Session.Put(r.Context(), "error", "Unauthorized user, check if your email and/or password is correct")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
+	user, err = m.DB.GetUserByID(r.Context(), id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't find user")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	m.recordAuthEvent(r, models.AuthEvent{Event: models.AuthSigninSuccess, Email: email, UserID: id, IP: ip})
+
 	m.App.Session.Put(r.Context(), "user_id", id)
+	m.App.Session.Put(r.Context(), "access_level", user.AccessLevel)
+	m.App.Session.Put(r.Context(), "session_version", user.SessionVersion)
+	if i18n.IsSupported(user.Locale) {
+		m.App.Session.Put(r.Context(), "locale", user.Locale)
+	}
 	m.App.Session.Put(r.Context(), "flash", "Logged in successfully.")
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
+	if userID := m.App.Session.GetInt(r.Context(), "user_id"); userID != 0 {
+		m.recordAuthEvent(r, models.AuthEvent{Event: models.AuthLogout, UserID: userID})
+	}
+
 	_ = m.App.Session.Destroy(r.Context())
 	_ = m.App.Session.RenewToken(r.Context())
 
@@ -510,14 +744,23 @@ func (m *Repository) BookedRooms(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := m.DB.GetUserByID(userID)
+	user, err := m.DB.GetUserByID(r.Context(), userID)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "Can't find user")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	reservations, err := m.DB.GetReservationsByUser(user.Email)
+	// anybody can sign up with any address, so the bookings made with it are
+	// only shown to who proved to own it
+	if !user.Verified() {
+		render.RenderTemplate(w, r, "booked-rooms.page.tmpl", &models.TemplateData{
+			Data: map[string]interface{}{"unverified": true, "email": user.Email},
+		})
+		return
+	}
+
+	reservations, err := m.DB.GetReservationsByUser(r.Context(), user.Email)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "You don't have booked rooms")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -540,3 +783,811 @@ func (m *Repository) BookedRooms(w http.ResponseWriter, r *http.Request) {
 		StringMap: stringMap,
 	})
 }
+
+// AdminDashboard renders the admin dashboard
+func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
+	reservations, err := m.DB.AllNewReservations(r.Context())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't get new reservations")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	mailCounts, err := m.DB.CountMailByStatus(r.Context())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't get mail")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	lockouts, err := m.DB.ActiveLockouts(r.Context())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't get lockouts")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	intMap := make(map[string]int)
+	intMap["new_reservations"] = len(reservations)
+	intMap["dead_mail"] = mailCounts[models.MailDead]
+	intMap["lockouts"] = len(lockouts)
+
+	render.RenderTemplate(w, r, "admin-dashboard.page.tmpl", &models.TemplateData{
+		IntMap: intMap,
+	})
+}
+
+// AdminNewReservations renders the list of reservations not processed yet
+func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
+	reservations, err := m.DB.AllNewReservations(r.Context())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't get new reservations")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservations"] = reservations
+
+	render.RenderTemplate(w, r, "admin-new-reservations.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminAllReservations renders the list of all reservations
+func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
+	reservations, err := m.DB.AllReservations(r.Context())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't get reservations")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservations"] = reservations
+
+	render.RenderTemplate(w, r, "admin-all-reservations.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowReservation renders the reservation detail page
+func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
+	src, id, err := reservationFromURI(r.RequestURI)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't find reservation")
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["src"] = src
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+
+	render.RenderTemplate(w, r, "admin-reservations-show.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      forms.New(nil),
+	})
+}
+
+// AdminPostShowReservation handles the post of the reservation detail form
+func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Request) {
+	src, id, err := reservationFromURI(r.RequestURI)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't find reservation")
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+		return
+	}
+
+	res.FirstName = r.Form.Get("first_name")
+	res.LastName = r.Form.Get("last_name")
+	res.Email = r.Form.Get("email")
+	res.Phone = r.Form.Get("phone")
+
+	form := forms.New(r.PostForm)
+
+	form.Required("first_name", "last_name", "email")
+	form.MinLenght("first_name", 3)
+	form.IsEmail("email")
+
+	if !form.Valid() {
+		stringMap := make(map[string]string)
+		stringMap["src"] = src
+
+		data := make(map[string]interface{})
+		data["reservation"] = res
+
+		render.RenderTemplate(w, r, "admin-reservations-show.page.tmpl", &models.TemplateData{
+			StringMap: stringMap,
+			Data:      data,
+			Form:      form,
+		})
+		return
+	}
+
+	err = m.DB.UpdateReservation(r.Context(), res)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't update reservation")
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+}
+
+// AdminProcessReservation marks a reservation as processed
+func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
+	src, id, err := reservationFromURI(r.RequestURI)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.UpdateProcessedForReservation(r.Context(), id, 1)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't mark reservation as processed")
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation marked as processed")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+}
+
+// AdminDeleteReservation deletes a reservation
+func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
+	src, id, err := reservationFromURI(r.RequestURI)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.DeleteReservation(r.Context(), id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't delete reservation")
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+}
+
+// reservationFromURI gets the list source and the reservation id from
+// uris like /admin/reservations/{src}/{id}/show
+func reservationFromURI(uri string) (string, int, error) {
+	exploded := strings.Split(uri, "/")
+	if len(exploded) < 5 {
+		return "", 0, errors.New("invalid uri")
+	}
+
+	id, err := strconv.Atoi(exploded[4])
+	if err != nil {
+		return "", 0, err
+	}
+
+	src := exploded[3]
+	if src != "new" {
+		src = "all"
+	}
+
+	return src, id, nil
+}
+
+// AdminReservationsCalendar renders the month calendar with reservations and owner blocks per room
+func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+
+	if r.URL.Query().Get("y") != "" {
+		year, _ := strconv.Atoi(r.URL.Query().Get("y"))
+		month, _ := strconv.Atoi(r.URL.Query().Get("m"))
+		if month >= 1 && month <= 12 {
+			now = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["now"] = now
+
+	next := now.AddDate(0, 1, 0)
+	last := now.AddDate(0, -1, 0)
+
+	stringMap := make(map[string]string)
+	stringMap["next_month"] = next.Format("01")
+	stringMap["next_month_year"] = next.Format("2006")
+	stringMap["last_month"] = last.Format("01")
+	stringMap["last_month_year"] = last.Format("2006")
+	stringMap["this_month"] = now.Format("01")
+	stringMap["this_month_year"] = now.Format("2006")
+
+	currentYear, currentMonth, _ := now.Date()
+	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, time.UTC)
+	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+
+	intMap := make(map[string]int)
+	intMap["days_in_month"] = lastOfMonth.Day()
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't get rooms")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	data["rooms"] = rooms
+
+	for _, x := range rooms {
+		reservationMap := make(map[string]int)
+		blockMap := make(map[string]int)
+		importedMap := make(map[string]int)
+
+		for d := firstOfMonth; !d.After(lastOfMonth); d = d.AddDate(0, 0, 1) {
+			reservationMap[d.Format("2006-01-02")] = 0
+			blockMap[d.Format("2006-01-02")] = 0
+			importedMap[d.Format("2006-01-02")] = 0
+		}
+
+		restrictions, err := m.DB.GetRestrictionsForRoomByDate(r.Context(), x.ID, firstOfMonth, lastOfMonth)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Can't get restrictions for room")
+			http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+			return
+		}
+
+		for _, y := range restrictions {
+			// restrictions take every night from their start to the day before their end,
+			// only the nights of the month shown are marked
+			start, end := y.StartDate, y.EndDate
+			if start.Before(firstOfMonth) {
+				start = firstOfMonth
+			}
+			if end.After(lastOfMonth.AddDate(0, 0, 1)) {
+				end = lastOfMonth.AddDate(0, 0, 1)
+			}
+
+			nights := blockMap
+			switch {
+			case y.ReservationID > 0:
+				nights = reservationMap
+			case y.ExternalSource != "":
+				// blocks imported from other calendars are changed by importing them again
+				nights = importedMap
+			}
+			id := y.ID
+			if y.ReservationID > 0 {
+				id = y.ReservationID
+			}
+			for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+				nights[d.Format("2006-01-02")] = id
+			}
+		}
+
+		data[fmt.Sprintf("reservation_map_%d", x.ID)] = reservationMap
+		data[fmt.Sprintf("block_map_%d", x.ID)] = blockMap
+		data[fmt.Sprintf("imported_map_%d", x.ID)] = importedMap
+
+		// keep the blocks shown so the post can find out which ones were removed
+		m.App.Session.Put(r.Context(), fmt.Sprintf("block_map_%d", x.ID), blockMap)
+	}
+
+	render.RenderTemplate(w, r, "admin-reservations-calendar.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		IntMap:    intMap,
+	})
+}
+
+// AdminPostReservationsCalendar adds and removes owner blocks submitted from the calendar
+func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, "/admin/reservations-calendar", http.StatusSeeOther)
+		return
+	}
+
+	year, _ := strconv.Atoi(r.Form.Get("y"))
+	month, _ := strconv.Atoi(r.Form.Get("m"))
+	calendarURL := fmt.Sprintf("/admin/reservations-calendar?y=%d&m=%d", year, month)
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't get rooms")
+		http.Redirect(w, r, calendarURL, http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	for _, x := range rooms {
+		// blocks that were shown checked and are not posted anymore have been unchecked,
+		// a block taking several nights is kept while any of them stays checked
+		curMap, ok := m.App.Session.Get(r.Context(), fmt.Sprintf("block_map_%d", x.ID)).(map[string]int)
+		if !ok {
+			continue
+		}
+		kept := make(map[int]bool)
+		for name, value := range curMap {
+			if value > 0 && form.Has(fmt.Sprintf("remove_block_%d_%s", x.ID, name)) {
+				kept[value] = true
+			}
+		}
+		removed := make(map[int]bool)
+		for name, value := range curMap {
+			if value > 0 && !kept[value] && !removed[value] && !form.Has(fmt.Sprintf("remove_block_%d_%s", x.ID, name)) {
+				removed[value] = true
+				if err := m.DB.DeleteBlockByID(r.Context(), value); err != nil {
+					m.App.Session.Put(r.Context(), "error", "Can't remove block")
+					http.Redirect(w, r, calendarURL, http.StatusSeeOther)
+					return
+				}
+			}
+		}
+	}
+
+	for name := range r.PostForm {
+		if !strings.HasPrefix(name, "add_block") {
+			continue
+		}
+
+		// add_block_{roomID}_{date}
+		exploded := strings.Split(name, "_")
+		if len(exploded) != 4 {
+			continue
+		}
+		roomID, err := strconv.Atoi(exploded[2])
+		if err != nil {
+			continue
+		}
+		day, err := time.Parse("2006-01-02", exploded[3])
+		if err != nil {
+			continue
+		}
+
+		if err := m.DB.InsertBlockForRoom(r.Context(), roomID, day); err != nil {
+			m.App.Session.Put(r.Context(), "error", "Can't add block")
+			http.Redirect(w, r, calendarURL, http.StatusSeeOther)
+			return
+		}
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	http.Redirect(w, r, calendarURL, http.StatusSeeOther)
+}
+
+// slugPattern matches lowercase slugs like generals-quarters
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// AdminRooms renders the list of rooms to manage
+func (m *Repository) AdminRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't get rooms")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+
+	render.RenderTemplate(w, r, "admin-rooms.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminRoom renders the form to create a room at /admin/rooms/new or edit one at /admin/rooms/{id}
+func (m *Repository) AdminRoom(w http.ResponseWriter, r *http.Request) {
+	room := models.Room{Capacity: 2, MinNights: 1}
+
+	exploded := strings.Split(r.URL.Path, "/")
+	if len(exploded) < 4 {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	if exploded[3] != "new" {
+		id, err := strconv.Atoi(exploded[3])
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "missing url parameter")
+			http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+			return
+		}
+
+		room, err = m.DB.GetRoomByID(r.Context(), id)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Can't find room")
+			http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+			return
+		}
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["nightly_price"] = render.FormatPrice(room.NightlyPrice)
+	if room.WeekendPrice > 0 {
+		stringMap["weekend_price"] = render.FormatPrice(room.WeekendPrice)
+	}
+	stringMap["photos"] = strings.Join(room.Photos, "\n")
+
+	m.renderAdminRoom(w, r, room, forms.New(nil), stringMap)
+}
+
+// renderAdminRoom renders the room form along with the seasonal rates of the room
+func (m *Repository) renderAdminRoom(w http.ResponseWriter, r *http.Request, room models.Room, form *forms.Form, stringMap map[string]string) {
+	data := make(map[string]interface{})
+	data["room"] = room
+
+	if room.ID > 0 {
+		seasons, err := m.DB.GetSeasonsForRoom(r.Context(), room.ID)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Can't get seasons for room")
+			http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+			return
+		}
+		data["seasons"] = seasons
+
+		if room.ICalToken != "" {
+			data["ical_feed_url"] = m.calendarFeedURL(room)
+		}
+	}
+
+	render.RenderTemplate(w, r, "admin-room.page.tmpl", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// AdminPostRoom handles the post of the room form, creating or updating the room
+func (m *Repository) AdminPostRoom(w http.ResponseWriter, r *http.Request) {
+	exploded := strings.Split(r.URL.Path, "/")
+	if len(exploded) < 4 {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	var room models.Room
+	if exploded[3] != "new" {
+		id, err := strconv.Atoi(exploded[3])
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "missing url parameter")
+			http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+			return
+		}
+		room.ID = id
+	}
+
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	room.RoomName = r.Form.Get("room_name")
+	room.Slug = strings.TrimSpace(r.Form.Get("slug"))
+	room.Description = r.Form.Get("description")
+	room.Photos = nil
+	for _, photo := range strings.Split(r.Form.Get("photos"), "\n") {
+		if photo = strings.TrimSpace(photo); photo != "" {
+			room.Photos = append(room.Photos, photo)
+		}
+	}
+
+	form := forms.New(r.PostForm)
+
+	form.Required("room_name", "slug", "capacity", "nightly_price", "min_nights")
+	form.MinLenght("room_name", 3)
+
+	if form.Has("slug") && !slugPattern.MatchString(room.Slug) {
+		form.Errors.Add("slug", "Use only lowercase letters, numbers and dashes")
+	}
+
+	form.IntRange("capacity", 1, math.MaxInt)
+	room.Capacity, _ = strconv.Atoi(r.Form.Get("capacity"))
+
+	price, err := parsePrice(r.Form.Get("nightly_price"))
+	if form.Has("nightly_price") && err != nil {
+		form.Errors.Add("nightly_price", "Price must be a positive amount like 120.00")
+	}
+	room.NightlyPrice = price
+
+	if form.Has("weekend_price") {
+		price, err = parsePrice(r.Form.Get("weekend_price"))
+		if err != nil {
+			form.Errors.Add("weekend_price", "Price must be a positive amount like 150.00")
+		}
+		room.WeekendPrice = price
+	}
+
+	form.IntRange("min_nights", 1, math.MaxInt)
+	room.MinNights, _ = strconv.Atoi(r.Form.Get("min_nights"))
+
+	if form.Valid() {
+		existing, err := m.DB.GetRoomBySlug(r.Context(), room.Slug)
+		if err == nil && existing.ID != room.ID {
+			form.Errors.Add("slug", "Slug already used by another room")
+		}
+	}
+
+	if !form.Valid() {
+		stringMap := make(map[string]string)
+		stringMap["nightly_price"] = r.Form.Get("nightly_price")
+		stringMap["weekend_price"] = r.Form.Get("weekend_price")
+		stringMap["photos"] = r.Form.Get("photos")
+
+		m.renderAdminRoom(w, r, room, form, stringMap)
+		return
+	}
+
+	if room.ID == 0 {
+		_, err = m.DB.InsertRoom(r.Context(), room)
+	} else {
+		err = m.DB.UpdateRoom(r.Context(), room)
+	}
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't save room")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Room saved")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// AdminDeleteRoom deletes the room at /admin/rooms/{id}/delete
+func (m *Repository) AdminDeleteRoom(w http.ResponseWriter, r *http.Request) {
+	exploded := strings.Split(r.URL.Path, "/")
+	if len(exploded) < 4 {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	id, err := strconv.Atoi(exploded[3])
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.DeleteRoom(r.Context(), id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't delete a room that has reservations or blocks")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Room deleted")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// AdminPostSeason adds a seasonal rate to the room at /admin/rooms/{id}/seasons
+func (m *Repository) AdminPostSeason(w http.ResponseWriter, r *http.Request) {
+	exploded := strings.Split(r.URL.Path, "/")
+	if len(exploded) < 4 {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	roomID, err := strconv.Atoi(exploded[3])
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(r.Context(), roomID)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't find room")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	season := models.Season{
+		RoomID: roomID,
+		Name:   r.Form.Get("season_name"),
+	}
+
+	form := forms.New(r.PostForm)
+
+	form.Required("season_name", "season_start", "season_end", "season_nightly_price")
+
+	form.IsDate("season_start")
+	form.IsDate("season_end")
+	season.StartDate = form.Date("season_start")
+	season.EndDate = form.Date("season_end")
+	if form.Valid() && season.EndDate.Before(season.StartDate) {
+		form.Errors.Add("season_end", "The season must end on or after its first day")
+	}
+
+	season.NightlyPrice, err = parsePrice(r.Form.Get("season_nightly_price"))
+	if form.Has("season_nightly_price") && err != nil {
+		form.Errors.Add("season_nightly_price", "Price must be a positive amount like 120.00")
+	}
+
+	if form.Has("season_weekend_price") {
+		season.WeekendPrice, err = parsePrice(r.Form.Get("season_weekend_price"))
+		if err != nil {
+			form.Errors.Add("season_weekend_price", "Price must be a positive amount like 150.00")
+		}
+	}
+
+	if form.IntRange("season_min_nights", 1, math.MaxInt) {
+		season.MinNights, _ = strconv.Atoi(r.Form.Get("season_min_nights"))
+	}
+
+	if !form.Valid() {
+		stringMap := make(map[string]string)
+		stringMap["nightly_price"] = render.FormatPrice(room.NightlyPrice)
+		if room.WeekendPrice > 0 {
+			stringMap["weekend_price"] = render.FormatPrice(room.WeekendPrice)
+		}
+		stringMap["photos"] = strings.Join(room.Photos, "\n")
+
+		m.renderAdminRoom(w, r, room, form, stringMap)
+		return
+	}
+
+	_, err = m.DB.InsertSeason(r.Context(), season)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't save season")
+		http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", roomID), http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Season saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", roomID), http.StatusSeeOther)
+}
+
+// AdminDeleteSeason deletes the seasonal rate at /admin/rooms/{id}/seasons/{season}/delete
+func (m *Repository) AdminDeleteSeason(w http.ResponseWriter, r *http.Request) {
+	exploded := strings.Split(r.URL.Path, "/")
+	if len(exploded) < 6 {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	roomID, err := strconv.Atoi(exploded[3])
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	id, err := strconv.Atoi(exploded[5])
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", roomID), http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.DeleteSeason(r.Context(), roomID, id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't delete season")
+		http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", roomID), http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Season deleted")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", roomID), http.StatusSeeOther)
+}
+
+// maxPrice is the highest price of a night, in cents
+const maxPrice = 1000000 * 100
+
+// pricePattern matches amounts like 120 or 120.50, with at most two decimals
+var pricePattern = regexp.MustCompile(`^([0-9]{1,9})(?:\.([0-9]{1,2}))?$`)
+
+// parsePrice parses an amount like 120.50 into cents. It is parsed as a decimal, without
+// floating point, and can't go above maxPrice
+func parsePrice(s string) (int, error) {
+	match := pricePattern.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return 0, errors.New("invalid price")
+	}
+	units, _ := strconv.Atoi(match[1])
+	cents, _ := strconv.Atoi((match[2] + "00")[:2])
+
+	price := units*100 + cents
+	if price > maxPrice {
+		return 0, errors.New("invalid price")
+	}
+	return price, nil
+}
+
+// AdminMail renders the mails of the outbox with the status given by ?status=, the failed ones by default
+func (m *Repository) AdminMail(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case models.MailPending, models.MailSending, models.MailSent, models.MailDead:
+	default:
+		status = models.MailDead
+	}
+
+	mails, err := m.DB.GetMailByStatus(r.Context(), status, 100)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't get mail")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	counts, err := m.DB.CountMailByStatus(r.Context())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't get mail")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["mails"] = mails
+
+	stringMap := make(map[string]string)
+	stringMap["status"] = status
+
+	render.RenderTemplate(w, r, "admin-mail.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		IntMap:    counts,
+	})
+}
+
+// AdminResendMail queues the mail at /admin/mail/{id}/resend to be sent again
+func (m *Repository) AdminResendMail(w http.ResponseWriter, r *http.Request) {
+	exploded := strings.Split(r.URL.Path, "/")
+	if len(exploded) < 4 {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/mail", http.StatusSeeOther)
+		return
+	}
+
+	id, err := strconv.Atoi(exploded[3])
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/mail", http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.ResendMail(r.Context(), id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't resend mail")
+		http.Redirect(w, r, "/admin/mail", http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Mail queued to be sent again")
+	http.Redirect(w, r, "/admin/mail", http.StatusSeeOther)
+}
@@ -3,10 +3,12 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -24,8 +26,13 @@ var tests = []struct {
 	{"about", "/about", "GET", http.StatusOK},
 	{"generals-quarters", "/generals-quarters", "GET", http.StatusOK},
 	{"majors-suite", "/majors-suite", "GET", http.StatusOK},
+	{"rooms", "/rooms", "GET", http.StatusOK},
+	{"room", "/rooms/generals-quarters", "GET", http.StatusOK},
+	{"room-not-found", "/rooms/not-a-room", "GET", http.StatusOK},
 	{"get-search-availability", "/search-availability", "GET", http.StatusOK},
 	{"contact", "/contact", "GET", http.StatusOK},
+	{"healthz", "/healthz", "GET", http.StatusOK},
+	{"metrics", "/metrics", "GET", http.StatusOK},
 }
 
 func TestHandlers(t *testing.T) {
@@ -145,7 +152,7 @@ var postReservationTests = []struct {
 			"first_name": {"John"},
 			"last_name":  {"Smith"},
 			"email":      {"john@smith.com"},
-			"phone":      {"555-555-5555"},
+			"phone":      {"+1 555-555-5555"},
 			"room_id":    {"1"},
 		},
 		expectedResponseCode: http.StatusSeeOther,
@@ -163,7 +170,7 @@ var postReservationTests = []struct {
 			"first_name": {"John"},
 			"last_name":  {"Smith"},
 			"email":      {"john@smith.com"},
-			"phone":      {"555-555-5555"},
+			"phone":      {"+1 555-555-5555"},
 			"room_id":    {"1"},
 		},
 		expectedResponseCode: http.StatusTemporaryRedirect,
@@ -191,13 +198,49 @@ var postReservationTests = []struct {
 			"first_name": {"John"},
 			"last_name":  {"Smith"},
 			"email":      {"notanemail"},
-			"phone":      {"555-555-5555"},
+			"phone":      {"+1 555-555-5555"},
 			"room_id":    {"1"},
 		},
 		expectedResponseCode: http.StatusOK,
 		expectedHTML:         `action="/make-reservation"`,
 		expectedLocation:     "",
 	},
+	{
+		name: "invalid-phone",
+		reservation: models.Reservation{
+			RoomID: 1,
+		},
+		postedData: url.Values{
+			"start_date": {"2050-01-01"},
+			"end_date":   {"2050-01-02"},
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"phone":      {"555-555-5555"},
+			"room_id":    {"1"},
+		},
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         "Use an international phone number",
+		expectedLocation:     "",
+	},
+	{
+		name: "error-storing-mail",
+		reservation: models.Reservation{
+			RoomID: 1,
+		},
+		postedData: url.Values{
+			"start_date": {"2050-01-01"},
+			"end_date":   {"2050-01-02"},
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"outbox-error@here.com"},
+			"phone":      {"+1 555-555-5555"},
+			"room_id":    {"1"},
+		},
+		expectedResponseCode: http.StatusTemporaryRedirect,
+		expectedHTML:         "",
+		expectedLocation:     "/",
+	},
 	{
 		name: "error-inserting-reservation",
 		reservation: models.Reservation{
@@ -209,7 +252,7 @@ var postReservationTests = []struct {
 			"first_name": {"John"},
 			"last_name":  {"Smith"},
 			"email":      {"john@smith.com"},
-			"phone":      {"555-555-5555"},
+			"phone":      {"+1 555-555-5555"},
 			"room_id":    {"2"},
 		},
 		expectedResponseCode: http.StatusTemporaryRedirect,
@@ -227,13 +270,31 @@ var postReservationTests = []struct {
 			"first_name": {"John"},
 			"last_name":  {"Smith"},
 			"email":      {"john@smith.com"},
-			"phone":      {"555-555-5555"},
+			"phone":      {"+1 555-555-5555"},
 			"room_id":    {"3"},
 		},
 		expectedResponseCode: http.StatusTemporaryRedirect,
 		expectedHTML:         "",
 		expectedLocation:     "/",
 	},
+	{
+		name: "room-just-taken",
+		reservation: models.Reservation{
+			RoomID: 4,
+		},
+		postedData: url.Values{
+			"start_date": {"2050-01-01"},
+			"end_date":   {"2050-01-02"},
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"phone":      {"+1 555-555-5555"},
+			"room_id":    {"4"},
+		},
+		expectedResponseCode: http.StatusConflict,
+		expectedHTML:         "this room was just booked",
+		expectedLocation:     "",
+	},
 }
 
 func TestRepository_PostReservation(t *testing.T) {
@@ -345,36 +406,57 @@ var postPostAvailability = []struct {
 	name                 string
 	postedData           url.Values
 	expectedResponseCode int
+	expectedHTML         string
 }{
 	{
 		name: "valid-data",
+		postedData: url.Values{
+			"start_date": {"2049-11-30"},
+			"end_date":   {"2049-12-02"},
+		},
+		expectedResponseCode: http.StatusOK,
+	},
+	{
+		name: "zero-nights",
 		postedData: url.Values{
 			"start_date": {"2049-11-30"},
 			"end_date":   {"2049-11-30"},
 		},
 		expectedResponseCode: http.StatusOK,
+		expectedHTML:         "The departure date must be after the arrival date",
 	},
 	{
-		name: "invalid-start-date",
+		name: "missing-start-date",
 		postedData: url.Values{
 			"start_date": nil,
 			"end_date":   {"2050-01-02"},
 		},
-		expectedResponseCode: http.StatusTemporaryRedirect,
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         "This field cannot be blank",
 	},
 	{
 		name: "invalid-end-date",
 		postedData: url.Values{
 			"start_date": {"2050-01-02"},
-			"end_date":   nil,
+			"end_date":   {"2050-01-32"},
 		},
-		expectedResponseCode: http.StatusTemporaryRedirect,
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         "Use a date like 2006-01-02",
+	},
+	{
+		name: "past-date",
+		postedData: url.Values{
+			"start_date": {"2020-01-01"},
+			"end_date":   {"2020-01-03"},
+		},
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         "The arrival date can&#39;t be in the past",
 	},
 	{
 		name: "failed-date",
 		postedData: url.Values{
 			"start_date": {"2060-01-01"},
-			"end_date":   {"2060-01-01"},
+			"end_date":   {"2060-01-02"},
 		},
 		expectedResponseCode: http.StatusTemporaryRedirect,
 	},
@@ -414,6 +496,10 @@ func TestRepository_PostAvailability(t *testing.T) {
 		if rr.Code != e.expectedResponseCode {
 			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedResponseCode)
 		}
+
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected to find %s but did not", e.name, e.expectedHTML)
+		}
 	}
 }
 
@@ -431,11 +517,35 @@ var getChooseRoom = []struct {
 			Room: models.Room{
 				RoomName: "General's Quarters",
 			},
+			StartDate: time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 1, 4, 0, 0, 0, 0, time.UTC),
 		},
 		url:                "/choose-room/1",
 		expectedStatusCode: http.StatusSeeOther,
 		expectedLocation:   "/make-reservation",
 	},
+	{
+		name: "shorter-than-min-stay",
+		reservation: models.Reservation{
+			RoomID:    1,
+			StartDate: time.Date(2049, 12, 24, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2049, 12, 25, 0, 0, 0, 0, time.UTC),
+		},
+		url:                "/choose-room/1",
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/search-availability",
+	},
+	{
+		name: "error-getting-seasons",
+		reservation: models.Reservation{
+			RoomID:    2,
+			StartDate: time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 1, 4, 0, 0, 0, 0, time.UTC),
+		},
+		url:                "/choose-room/2",
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/search-availability",
+	},
 	{
 		name:               "reservation-not-in-session",
 		reservation:        models.Reservation{},
@@ -490,10 +600,16 @@ var getBookRoom = []struct {
 }{
 	{
 		name:                 "valid-data",
-		url:                  "/book-room?id=1&s=2050-01-02&e=2050-01-02",
+		url:                  "/book-room?id=1&s=2050-01-02&e=2050-01-04",
 		expectedResponseCode: http.StatusSeeOther,
 		expectedLocation:     "/make-reservation",
 	},
+	{
+		name:                 "shorter-than-min-stay",
+		url:                  "/book-room?id=1&s=2049-12-24&e=2049-12-25",
+		expectedResponseCode: http.StatusTemporaryRedirect,
+		expectedLocation:     "/",
+	},
 	{
 		name:                 "invalid-id",
 		url:                  "/book-room?id=something&s=2050-01-02&e=2050-01-02",
@@ -503,14 +619,20 @@ var getBookRoom = []struct {
 	{
 		name:                 "invalid-start-date",
 		url:                  "/book-room?id=1&s=2050-01-32&e=2050-01-02",
-		expectedResponseCode: http.StatusTemporaryRedirect,
-		expectedLocation:     "/",
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         "Use a date like 2006-01-02",
 	},
 	{
 		name:                 "invalid-end-date",
 		url:                  "/book-room?id=1&s=2050-01-02&e=2050-01-32",
-		expectedResponseCode: http.StatusTemporaryRedirect,
-		expectedLocation:     "/",
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         "Use a date like 2006-01-02",
+	},
+	{
+		name:                 "reversed-dates",
+		url:                  "/book-room?id=1&s=2050-01-04&e=2050-01-02",
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         "The departure date must be after the arrival date",
 	},
 }
 
@@ -531,6 +653,10 @@ func TestRepository_BookRoom(t *testing.T) {
 			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedResponseCode)
 		}
 
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected to find %s but did not", e.name, e.expectedHTML)
+		}
+
 		if e.expectedLocation != "" {
 			actualLoc, _ := rr.Result().Location()
 			if actualLoc.String() != e.expectedLocation {
@@ -545,37 +671,74 @@ var postAvailabilityJSON = []struct {
 	postedData      url.Values
 	expectedOK      bool
 	expectedMessage string
+	expectedFields  map[string]string
 }{
 	{
 		name: "valid-data",
 		postedData: url.Values{
-			"start_date": {"2049-11-30"},
-			"end_date":   {"2049-11-30"},
-			"room_id":    {"1"},
+			"start_modal": {"2049-11-30"},
+			"end_modal":   {"2049-12-02"},
+			"room_id":     {"1"},
 		},
 		expectedOK: true,
 	},
+	{
+		name: "shorter-than-min-stay",
+		postedData: url.Values{
+			"start_modal": {"2049-12-24"},
+			"end_modal":   {"2049-12-25"},
+			"room_id":     {"1"},
+		},
+		expectedOK:      false,
+		expectedMessage: "The minimum stay for these dates is 3 nights",
+	},
 	{
 		name:            "invalid-form",
 		postedData:      nil,
 		expectedOK:      false,
 		expectedMessage: "Internal server error",
 	},
+	{
+		name: "missing-dates",
+		postedData: url.Values{
+			"room_id": {"1"},
+		},
+		expectedOK:      false,
+		expectedMessage: "This field cannot be blank",
+		expectedFields: map[string]string{
+			"start_modal": "This field cannot be blank",
+			"end_modal":   "This field cannot be blank",
+		},
+	},
+	{
+		name: "past-and-reversed",
+		postedData: url.Values{
+			"start_modal": {"2020-01-03"},
+			"end_modal":   {"2020-01-01"},
+			"room_id":     {"1"},
+		},
+		expectedOK:      false,
+		expectedMessage: "The arrival date can't be in the past",
+		expectedFields: map[string]string{
+			"start_modal": "The arrival date can't be in the past",
+			"end_modal":   "The departure date must be after the arrival date",
+		},
+	},
 	{
 		name: "not-available",
 		postedData: url.Values{
-			"start_date": {"2049-11-30"},
-			"end_date":   {"2049-11-30"},
-			"room_id":    {"2"},
+			"start_modal": {"2049-11-30"},
+			"end_modal":   {"2049-12-02"},
+			"room_id":     {"2"},
 		},
 		expectedOK: false,
 	},
 	{
 		name: "error-database",
 		postedData: url.Values{
-			"start_date": {"2049-11-30"},
-			"end_date":   {"2049-11-30"},
-			"room_id":    {"3"},
+			"start_modal": {"2049-11-30"},
+			"end_modal":   {"2049-12-02"},
+			"room_id":     {"3"},
 		},
 		expectedOK:      false,
 		expectedMessage: "Error connecting to database",
@@ -609,6 +772,14 @@ func TestRepository_AvailabilityJSON(t *testing.T) {
 		if j.OK != e.expectedOK {
 			t.Errorf("%s: expected %v but got %v", e.name, e.expectedOK, j.OK)
 		}
+
+		if e.expectedMessage != "" && j.Message != e.expectedMessage {
+			t.Errorf("%s: expected message %q but got %q", e.name, e.expectedMessage, j.Message)
+		}
+
+		if e.expectedFields != nil && !reflect.DeepEqual(j.Fields, e.expectedFields) {
+			t.Errorf("%s: expected fields %v but got %v", e.name, e.expectedFields, j.Fields)
+		}
 	}
 }
 
@@ -768,6 +939,7 @@ var postSignIn = []struct {
 	expectedResponseCode int
 	expectedLocation     string
 	expectedHTML         string
+	expectedError        string
 }{
 	{
 		name: "valid-form",
@@ -792,6 +964,27 @@ var postSignIn = []struct {
 		},
 		expectedResponseCode: http.StatusTemporaryRedirect,
 		expectedLocation:     "/",
+		expectedError:        "Unauthorized user, check if your email and/or password is correct",
+	},
+	{
+		name: "locked-out",
+		postedData: url.Values{
+			"username_login": {"Locked@here.com"},
+			"password_login": {"12345Q@e"},
+		},
+		expectedResponseCode: http.StatusTemporaryRedirect,
+		expectedLocation:     "/",
+		expectedError:        "Too many failed sign in attempts, try again in 10 minutes",
+	},
+	{
+		name: "failure-before-lockout",
+		postedData: url.Values{
+			"username_login": {"failing@here.com"},
+			"password_login": {"unauthorized"},
+		},
+		expectedResponseCode: http.StatusTemporaryRedirect,
+		expectedLocation:     "/",
+		expectedError:        "Unauthorized user, check if your email and/or password is correct",
 	},
 }
 
@@ -824,6 +1017,12 @@ func TestRepository_PostSignIn(t *testing.T) {
 				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
 			}
 		}
+
+		if e.expectedError != "" {
+			if msg := session.PopString(ctx, "error"); msg != e.expectedError {
+				t.Errorf("failed %s: expected error %q but got %q", e.name, e.expectedError, msg)
+			}
+		}
 	}
 }
 
@@ -901,6 +1100,12 @@ var getBookedRooms = []struct {
 		expectedStatusCode: http.StatusTemporaryRedirect,
 		expectedLocation:   "/",
 	},
+	{
+		name:               "unverified-user",
+		userID:             4,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `action="/verify-email/resend"`,
+	},
 }
 
 func TestBookedRooms(t *testing.T) {
@@ -928,6 +1133,762 @@ func TestBookedRooms(t *testing.T) {
 				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
 			}
 		}
+
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected to find %s but did not", e.name, e.expectedHTML)
+		}
+	}
+}
+
+var getAdminPages = []struct {
+	name               string
+	url                string
+	handler            func(*Repository, http.ResponseWriter, *http.Request)
+	expectedStatusCode int
+	expectedLocation   string
+	expectedHTML       string
+}{
+	{
+		name:               "dashboard",
+		url:                "/admin/dashboard",
+		handler:            (*Repository).AdminDashboard,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "/admin/reservations-new",
+	},
+	{
+		name:               "new-reservations",
+		url:                "/admin/reservations-new",
+		handler:            (*Repository).AdminNewReservations,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "New Reservations",
+	},
+	{
+		name:               "all-reservations",
+		url:                "/admin/reservations-all",
+		handler:            (*Repository).AdminAllReservations,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `<td class="text-danger">Cancelled on`,
+	},
+	{
+		name:               "show-reservation",
+		url:                "/admin/reservations/new/1/show",
+		handler:            (*Repository).AdminShowReservation,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `action="/admin/reservations/new/0/show"`,
+	},
+	{
+		name:               "show-reservation-cancelled",
+		url:                "/admin/reservations/all/7/show",
+		handler:            (*Repository).AdminShowReservation,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "Cancelled by the guest on",
+	},
+	{
+		name:               "show-reservation-malformed-url",
+		url:                "/admin/reservations/new/fish/show",
+		handler:            (*Repository).AdminShowReservation,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/dashboard",
+	},
+	{
+		name:               "show-reservation-not-found",
+		url:                "/admin/reservations/all/2/show",
+		handler:            (*Repository).AdminShowReservation,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/reservations-all",
+	},
+	{
+		name:               "mail",
+		url:                "/admin/mail",
+		handler:            (*Repository).AdminMail,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `action="/admin/mail/1/resend"`,
+	},
+	{
+		name:               "mail-sent",
+		url:                "/admin/mail?status=sent",
+		handler:            (*Repository).AdminMail,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `<a class="nav-link active" href="/admin/mail?status=sent">`,
+	},
+	{
+		name:               "security",
+		url:                "/admin/security",
+		handler:            (*Repository).AdminSecurity,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `action="/admin/lockouts/1/lift"`,
+	},
+	{
+		name:               "rooms",
+		url:                "/admin/rooms",
+		handler:            (*Repository).AdminRooms,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `href="/admin/rooms/1"`,
+	},
+	{
+		name:               "new-room",
+		url:                "/admin/rooms/new",
+		handler:            (*Repository).AdminRoom,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `action="/admin/rooms/new"`,
+	},
+	{
+		name:               "edit-room",
+		url:                "/admin/rooms/1",
+		handler:            (*Repository).AdminRoom,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `action="/admin/rooms/1/delete"`,
+	},
+	{
+		name:               "edit-room-seasons",
+		url:                "/admin/rooms/1",
+		handler:            (*Repository).AdminRoom,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `action="/admin/rooms/1/seasons/1/delete"`,
+	},
+	{
+		name:               "edit-room-seasons-error",
+		url:                "/admin/rooms/2",
+		handler:            (*Repository).AdminRoom,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/rooms",
+	},
+	{
+		name:               "edit-room-malformed-url",
+		url:                "/admin/rooms/fish",
+		handler:            (*Repository).AdminRoom,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/rooms",
+	},
+	{
+		name:               "edit-room-not-found",
+		url:                "/admin/rooms/3",
+		handler:            (*Repository).AdminRoom,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/rooms",
+	},
+}
+
+func TestAdminPages(t *testing.T) {
+	for _, e := range getAdminPages {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		// set the RequestURI on the request so that we can grab the ID from the URL
+		req.RequestURI = e.url
+
+		rr := httptest.NewRecorder()
+
+		e.handler(Repo, rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+
+		if e.expectedHTML != "" {
+			html := rr.Body.String()
+			if !strings.Contains(html, e.expectedHTML) {
+				t.Errorf("failed %s: expected to find %s but did not", e.name, e.expectedHTML)
+			}
+		}
+	}
+}
+
+var postAdminReservation = []struct {
+	name                 string
+	url                  string
+	handler              func(*Repository, http.ResponseWriter, *http.Request)
+	postedData           url.Values
+	expectedResponseCode int
+	expectedLocation     string
+	expectedHTML         string
+}{
+	{
+		name:    "update-valid-data",
+		url:     "/admin/reservations/new/1/show",
+		handler: (*Repository).AdminPostShowReservation,
+		postedData: url.Values{
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"phone":      {"555-555-5555"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/reservations-new",
+	},
+	{
+		name:    "update-invalid-data",
+		url:     "/admin/reservations/all/1/show",
+		handler: (*Repository).AdminPostShowReservation,
+		postedData: url.Values{
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"notanemail"},
+		},
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         `action="/admin/reservations/all/0/show"`,
+	},
+	{
+		name:    "update-database-error",
+		url:     "/admin/reservations/all/1/show",
+		handler: (*Repository).AdminPostShowReservation,
+		postedData: url.Values{
+			"first_name": {"Error"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/reservations-all",
+	},
+	{
+		name:                 "update-not-found",
+		url:                  "/admin/reservations/all/2/show",
+		handler:              (*Repository).AdminPostShowReservation,
+		postedData:           url.Values{},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/reservations-all",
+	},
+	{
+		name:                 "process-reservation",
+		url:                  "/admin/process-reservation/new/1",
+		handler:              (*Repository).AdminProcessReservation,
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/reservations-new",
+	},
+	{
+		name:                 "process-reservation-error",
+		url:                  "/admin/process-reservation/all/3",
+		handler:              (*Repository).AdminProcessReservation,
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/reservations-all",
+	},
+	{
+		name:                 "process-reservation-malformed-url",
+		url:                  "/admin/process-reservation/all",
+		handler:              (*Repository).AdminProcessReservation,
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/dashboard",
+	},
+	{
+		name:                 "delete-reservation",
+		url:                  "/admin/delete-reservation/all/1",
+		handler:              (*Repository).AdminDeleteReservation,
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/reservations-all",
+	},
+	{
+		name:                 "delete-reservation-error",
+		url:                  "/admin/delete-reservation/new/3",
+		handler:              (*Repository).AdminDeleteReservation,
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/reservations-new",
+	},
+	{
+		name:                 "resend-mail",
+		url:                  "/admin/mail/1/resend",
+		handler:              (*Repository).AdminResendMail,
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/mail",
+	},
+	{
+		name:                 "resend-mail-error",
+		url:                  "/admin/mail/2/resend",
+		handler:              (*Repository).AdminResendMail,
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/mail",
+	},
+	{
+		name:                 "lift-lockout",
+		url:                  "/admin/lockouts/1/lift",
+		handler:              (*Repository).AdminLiftLockout,
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/security",
+	},
+	{
+		name:                 "lift-lockout-error",
+		url:                  "/admin/lockouts/2/lift",
+		handler:              (*Repository).AdminLiftLockout,
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/security",
+	},
+}
+
+func TestAdminPostReservation(t *testing.T) {
+	for _, e := range postAdminReservation {
+		var req *http.Request
+		if e.postedData != nil {
+			req, _ = http.NewRequest("POST", e.url, strings.NewReader(e.postedData.Encode()))
+		} else {
+			req, _ = http.NewRequest("POST", e.url, nil)
+		}
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RequestURI = e.url
+
+		rr := httptest.NewRecorder()
+
+		e.handler(Repo, rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedResponseCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+
+		if e.expectedHTML != "" {
+			html := rr.Body.String()
+			if !strings.Contains(html, e.expectedHTML) {
+				t.Errorf("failed %s: expected to find %s but did not", e.name, e.expectedHTML)
+			}
+		}
+	}
+}
+
+var postAdminRoom = []struct {
+	name                 string
+	url                  string
+	handler              func(*Repository, http.ResponseWriter, *http.Request)
+	postedData           url.Values
+	expectedResponseCode int
+	expectedLocation     string
+	expectedHTML         string
+}{
+	{
+		name:    "create-room",
+		url:     "/admin/rooms/new",
+		handler: (*Repository).AdminPostRoom,
+		postedData: url.Values{
+			"room_name":     {"Colonel's Cabin"},
+			"slug":          {"colonels-cabin"},
+			"capacity":      {"4"},
+			"nightly_price": {"180.50"},
+			"weekend_price": {"220"},
+			"min_nights":    {"2"},
+			"photos":        {"/static/images/a.png\n\n/static/images/b.png"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/rooms",
+	},
+	{
+		name:    "update-room",
+		url:     "/admin/rooms/1",
+		handler: (*Repository).AdminPostRoom,
+		postedData: url.Values{
+			"room_name":     {"General's Quarters"},
+			"slug":          {"generals-quarters"},
+			"capacity":      {"2"},
+			"nightly_price": {"120"},
+			"min_nights":    {"1"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/rooms",
+	},
+	{
+		name:    "invalid-data",
+		url:     "/admin/rooms/new",
+		handler: (*Repository).AdminPostRoom,
+		postedData: url.Values{
+			"room_name":     {"Colonel's Cabin"},
+			"slug":          {"Colonel's Cabin"},
+			"capacity":      {"0"},
+			"nightly_price": {"cheap"},
+		},
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         "Use only lowercase letters, numbers and dashes",
+	},
+	{
+		name:    "slug-taken",
+		url:     "/admin/rooms/1",
+		handler: (*Repository).AdminPostRoom,
+		postedData: url.Values{
+			"room_name":     {"General's Quarters"},
+			"slug":          {"majors-suite"},
+			"capacity":      {"2"},
+			"nightly_price": {"120"},
+			"min_nights":    {"1"},
+		},
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         "Slug already used by another room",
+	},
+	{
+		name:    "database-error",
+		url:     "/admin/rooms/new",
+		handler: (*Repository).AdminPostRoom,
+		postedData: url.Values{
+			"room_name":     {"Error"},
+			"slug":          {"error"},
+			"capacity":      {"2"},
+			"nightly_price": {"120"},
+			"min_nights":    {"1"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/rooms",
+	},
+	{
+		name:                 "malformed-url",
+		url:                  "/admin/rooms/fish",
+		handler:              (*Repository).AdminPostRoom,
+		postedData:           url.Values{},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/rooms",
+	},
+	{
+		name:                 "delete-room",
+		url:                  "/admin/rooms/1/delete",
+		handler:              (*Repository).AdminDeleteRoom,
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/rooms",
+	},
+	{
+		name:                 "delete-room-error",
+		url:                  "/admin/rooms/2/delete",
+		handler:              (*Repository).AdminDeleteRoom,
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/rooms",
+	},
+	{
+		name:    "add-season",
+		url:     "/admin/rooms/1/seasons",
+		handler: (*Repository).AdminPostSeason,
+		postedData: url.Values{
+			"season_name":          {"Summer"},
+			"season_start":         {"2050-07-01"},
+			"season_end":           {"2050-08-31"},
+			"season_nightly_price": {"200"},
+			"season_min_nights":    {"3"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/rooms/1",
+	},
+	{
+		name:    "add-season-invalid-data",
+		url:     "/admin/rooms/1/seasons",
+		handler: (*Repository).AdminPostSeason,
+		postedData: url.Values{
+			"season_name":          {"Summer"},
+			"season_start":         {"2050-08-31"},
+			"season_end":           {"2050-07-01"},
+			"season_nightly_price": {"200"},
+		},
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         "The season must end on or after its first day",
+	},
+	{
+		name:    "add-season-database-error",
+		url:     "/admin/rooms/1/seasons",
+		handler: (*Repository).AdminPostSeason,
+		postedData: url.Values{
+			"season_name":          {"Error"},
+			"season_start":         {"2050-07-01"},
+			"season_end":           {"2050-08-31"},
+			"season_nightly_price": {"200"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/rooms/1",
+	},
+	{
+		name:                 "add-season-room-not-found",
+		url:                  "/admin/rooms/3/seasons",
+		handler:              (*Repository).AdminPostSeason,
+		postedData:           url.Values{},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/rooms",
+	},
+	{
+		name:                 "delete-season",
+		url:                  "/admin/rooms/1/seasons/1/delete",
+		handler:              (*Repository).AdminDeleteSeason,
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/rooms/1",
+	},
+	{
+		name:                 "delete-season-error",
+		url:                  "/admin/rooms/1/seasons/2/delete",
+		handler:              (*Repository).AdminDeleteSeason,
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/rooms/1",
+	},
+}
+
+func TestAdminPostRoom(t *testing.T) {
+	for _, e := range postAdminRoom {
+		var req *http.Request
+		if e.postedData != nil {
+			req, _ = http.NewRequest("POST", e.url, strings.NewReader(e.postedData.Encode()))
+		} else {
+			req, _ = http.NewRequest("POST", e.url, nil)
+		}
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		e.handler(Repo, rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedResponseCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+
+		if e.expectedHTML != "" {
+			html := rr.Body.String()
+			if !strings.Contains(html, e.expectedHTML) {
+				t.Errorf("failed %s: expected to find %s but did not", e.name, e.expectedHTML)
+			}
+		}
+	}
+}
+
+func TestParsePrice(t *testing.T) {
+	for in, want := range map[string]int{"120": 12000, "120.5": 12050, " 99.99 ": 9999, "0": 0, "0.07": 7, "1000000": 100000000, "19.9": 1990} {
+		got, err := parsePrice(in)
+		if err != nil || got != want {
+			t.Errorf("parsePrice(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"", "cheap", "-1", "NaN", "Inf", "+Inf", "-Inf", "1e300", "1e3", "0x10", "12.345", "1000000.01", "999999999", ".5", "5.", "+5", "1,5"} {
+		if _, err := parsePrice(in); err == nil {
+			t.Errorf("parsePrice(%q) should fail", in)
+		}
+	}
+}
+
+var getReservationsCalendar = []struct {
+	name               string
+	url                string
+	expectedStatusCode int
+	expectedHTML       string
+}{
+	{
+		name:               "current-month",
+		url:                "/admin/reservations-calendar",
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `name="remove_block_1_`,
+	},
+	{
+		name:               "given-month",
+		url:                "/admin/reservations-calendar?y=2050&m=01",
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `name="remove_block_1_2050-01-04"`,
+	},
+	{
+		name:               "given-month-with-reservation",
+		url:                "/admin/reservations-calendar?y=2050&m=01",
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `name="add_block_1_2050-01-03"`,
+	},
+}
+
+func TestAdminReservationsCalendar(t *testing.T) {
+	for _, e := range getReservationsCalendar {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminReservationsCalendar)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedHTML != "" {
+			html := rr.Body.String()
+			if !strings.Contains(html, e.expectedHTML) {
+				t.Errorf("failed %s: expected to find %s but did not", e.name, e.expectedHTML)
+			}
+		}
+
+		if _, ok := session.Get(ctx, "block_map_1").(map[string]int); !ok {
+			t.Errorf("failed %s: expected block map in session", e.name)
+		}
+	}
+}
+
+var postReservationsCalendar = []struct {
+	name             string
+	postedData       url.Values
+	blockMap         map[string]int
+	expectedLocation string
+	expectedError    bool
+}{
+	{
+		name: "add-and-keep-blocks",
+		postedData: url.Values{
+			"y":                           {"2050"},
+			"m":                           {"1"},
+			"add_block_1_2050-01-02":      {"1"},
+			"remove_block_1_2050-01-04":   {"2"},
+			"add_block_1_not-a-date":      {"1"},
+			"add_block_fish_2050-01-02":   {"1"},
+			"something_else_1_2050-01-02": {"1"},
+		},
+		blockMap: map[string]int{
+			"2050-01-04": 2,
+		},
+		expectedLocation: "/admin/reservations-calendar?y=2050&m=1",
+	},
+	{
+		name: "remove-block",
+		postedData: url.Values{
+			"y": {"2050"},
+			"m": {"1"},
+		},
+		blockMap: map[string]int{
+			"2050-01-04": 2,
+		},
+		expectedLocation: "/admin/reservations-calendar?y=2050&m=1",
+	},
+	{
+		name: "error-removing-block",
+		postedData: url.Values{
+			"y": {"2050"},
+			"m": {"1"},
+		},
+		blockMap: map[string]int{
+			"2050-01-04": 3,
+		},
+		expectedLocation: "/admin/reservations-calendar?y=2050&m=1",
+		expectedError:    true,
+	},
+	{
+		name: "keep-block-of-several-nights",
+		postedData: url.Values{
+			"y":                         {"2050"},
+			"m":                         {"1"},
+			"remove_block_1_2050-01-04": {"3"},
+		},
+		blockMap: map[string]int{
+			"2050-01-04": 3,
+			"2050-01-05": 3,
+		},
+		expectedLocation: "/admin/reservations-calendar?y=2050&m=1",
+	},
+	{
+		name: "error-adding-block",
+		postedData: url.Values{
+			"y":                      {"2050"},
+			"m":                      {"1"},
+			"add_block_2_2050-01-02": {"1"},
+		},
+		expectedLocation: "/admin/reservations-calendar?y=2050&m=1",
+		expectedError:    true,
+	},
+}
+
+func TestAdminReservationsCalendar_ImportedBlock(t *testing.T) {
+	// the imported block 3 takes 2050-01-31 and 2050-02-01
+	req, _ := http.NewRequest("GET", "/admin/reservations-calendar?y=2050&m=01", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	Repo.AdminReservationsCalendar(rr, req)
+
+	if !strings.Contains(rr.Body.String(), `<input type="checkbox" checked disabled title="Imported from another calendar">`) {
+		t.Error("expected the imported block to be shown read-only")
+	}
+	if strings.Contains(rr.Body.String(), `name="remove_block_1_2050-01-31"`) {
+		t.Error("expected the imported block not to be removable")
+	}
+	blockMap, _ := session.Get(ctx, "block_map_1").(map[string]int)
+	for day, id := range blockMap {
+		if !strings.HasPrefix(day, "2050-01-") {
+			t.Errorf("expected the nights of the month shown only but got %s", day)
+		}
+		if id == 3 {
+			t.Errorf("expected the imported block out of the removable ones but got it on %s", day)
+		}
+	}
+
+	// saving the month leaves the imported block alone, deleting block 3 fails in the tests
+	req, _ = http.NewRequest("POST", "/admin/reservations-calendar", strings.NewReader(url.Values{"y": {"2050"}, "m": {"1"}}.Encode()))
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+
+	Repo.AdminPostReservationsCalendar(rr, req)
+
+	if msg := session.PopString(ctx, "error"); msg != "" {
+		t.Errorf("expected the imported block to be kept but got error %q", msg)
+	}
+}
+
+func TestAdminPostReservationsCalendar(t *testing.T) {
+	for _, e := range postReservationsCalendar {
+		req, _ := http.NewRequest("POST", "/admin/reservations-calendar", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		if e.blockMap != nil {
+			session.Put(ctx, "block_map_1", e.blockMap)
+		}
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostReservationsCalendar)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, http.StatusSeeOther)
+		}
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+		}
+
+		if hasError := session.Exists(ctx, "error"); hasError != e.expectedError {
+			t.Errorf("failed %s: expected error in session to be %v but was %v", e.name, e.expectedError, hasError)
+		}
+	}
+}
+
+func TestRepository_CancelledContext(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/make-reservation", nil)
+	ctx := getCtx(req)
+	session.Put(ctx, "reservation", models.Reservation{RoomID: 1})
+
+	// the client went away before the handler queried the database
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.Reservation)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusTemporaryRedirect {
+		t.Errorf("cancelled context returned wrong response code: got %d, wanted %d", rr.Code, http.StatusTemporaryRedirect)
+	}
+
+	if _, err := Repo.DB.GetRoomByID(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled from repository but got %v", err)
 	}
 }
 
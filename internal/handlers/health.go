@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/logging"
+	"github.com/marcelofranco/webapp-go-demo/internal/metrics"
+)
+
+// Healthz tells the process is alive
+func (m *Repository) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte("ok\n"))
+}
+
+// Readyz tells the load balancer if this instance can serve requests: it is not
+// shutting down, the database answers, the templates are loaded and mail is sent
+func (m *Repository) Readyz(w http.ResponseWriter, r *http.Request) {
+	var problems []string
+
+	if !m.App.Ready() {
+		problems = append(problems, "shutting down")
+	}
+	if err := m.DB.Ping(r.Context()); err != nil {
+		// the error can tell about the database, so it only goes to the logs
+		logging.FromContext(r.Context()).Error("readiness check: database unavailable", "error", err)
+		problems = append(problems, "database: unavailable")
+	}
+	if len(m.App.TemplateCache) == 0 {
+		problems = append(problems, "templates: not loaded")
+	}
+	if m.App.MailQueue == nil || !m.App.MailQueue.Running() {
+		problems = append(problems, "mail: queue not running")
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if len(problems) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(strings.Join(problems, "\n") + "\n"))
+		return
+	}
+
+	w.Write([]byte("ok\n"))
+}
+
+// Metrics writes the metrics of the app in the Prometheus text format
+func (m *Repository) Metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	metrics.Write(w)
+
+	stats := m.DB.Stats()
+	metrics.WriteMetric(w, "db_connections_max_open", "gauge", "Maximum number of open connections to the database.",
+		metrics.Sample{Value: float64(stats.MaxOpenConnections)})
+	metrics.WriteMetric(w, "db_connections", "gauge", "Connections to the database, by state.",
+		metrics.Sample{Labels: []string{"state", "in_use"}, Value: float64(stats.InUse)},
+		metrics.Sample{Labels: []string{"state", "idle"}, Value: float64(stats.Idle)})
+	metrics.WriteMetric(w, "db_wait_count_total", "counter", "Times a query waited for a free connection.",
+		metrics.Sample{Value: float64(stats.WaitCount)})
+	metrics.WriteMetric(w, "db_wait_duration_seconds_total", "counter", "Time spent waiting for a free connection.",
+		metrics.Sample{Value: stats.WaitDuration.Seconds()})
+
+	counts, err := m.DB.CountMailByStatus(r.Context())
+	if err != nil {
+		return
+	}
+	statuses := make([]string, 0, len(counts))
+	for status := range counts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+
+	var samples []metrics.Sample
+	for _, status := range statuses {
+		samples = append(samples, metrics.Sample{Labels: []string{"status", status}, Value: float64(counts[status])})
+	}
+	metrics.WriteMetric(w, "mail_outbox_messages", "gauge", "Mails in the outbox, by status.", samples...)
+}
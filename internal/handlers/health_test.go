@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/metrics"
+)
+
+func TestRepository_Readyz(t *testing.T) {
+	defer app.SetReady(false)
+
+	tests := []struct {
+		name               string
+		ready              bool
+		templates          bool
+		expectedStatusCode int
+		expectedBody       string
+		dbDown             bool
+	}{
+		{"ready", true, true, http.StatusOK, "ok", false},
+		{"shutting-down", false, true, http.StatusServiceUnavailable, "shutting down", false},
+		{"no-templates", true, false, http.StatusServiceUnavailable, "templates", false},
+		{"database-down", true, true, http.StatusServiceUnavailable, "database: unavailable", true},
+	}
+
+	tc := app.TemplateCache
+	defer func() { app.TemplateCache = tc }()
+
+	for _, e := range tests {
+		app.SetReady(e.ready)
+		app.TemplateCache = tc
+		if !e.templates {
+			app.TemplateCache = nil
+		}
+
+		req, _ := http.NewRequest("GET", "/readyz", nil)
+		if e.dbDown {
+			// the test database fails to answer a cancelled context
+			ctx, cancel := context.WithCancel(req.Context())
+			cancel()
+			req = req.WithContext(ctx)
+		}
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.Readyz).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if !strings.Contains(rr.Body.String(), e.expectedBody) {
+			t.Errorf("%s: expected %q in the body but got %q", e.name, e.expectedBody, rr.Body.String())
+		}
+		if strings.Contains(rr.Body.String(), "context canceled") {
+			t.Errorf("%s: expected the database error to stay out of the body but got %q", e.name, rr.Body.String())
+		}
+	}
+}
+
+func TestRepository_Metrics(t *testing.T) {
+	metrics.ReservationsCreated.Inc()
+
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.Metrics).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, rr.Code)
+	}
+
+	for _, want := range []string{
+		"# TYPE reservations_created_total counter",
+		`db_connections{state="in_use"} 1`,
+		"db_connections_max_open 10",
+		`mail_outbox_messages{status="dead"} 1`,
+		`mail_outbox_messages{status="sent"} 10`,
+	} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("expected %q in\n%s", want, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/ical"
+	"github.com/marcelofranco/webapp-go-demo/internal/logging"
+	"github.com/marcelofranco/webapp-go-demo/internal/models"
+	"github.com/marcelofranco/webapp-go-demo/internal/tokens"
+)
+
+// maxCalendarSize is the largest calendar file or feed which can be imported
+const maxCalendarSize = 5 << 20
+
+// errCalendarURL is returned for a calendar url which isn't http or https
+var errCalendarURL = errors.New("the url must start with http:// or https://")
+
+// errCalendarAddress is returned for a calendar url leading to this host or its network
+var errCalendarAddress = errors.New("the url leads to a private address")
+
+// calendarClient fetches the calendars imported from a url. It only connects to public
+// addresses, redirects included, so that a url can't reach the services next to the app
+var calendarClient = &http.Client{
+	Timeout: 20 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: publicAddressOnly,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+// publicAddressOnly refuses to connect to loopback, private, link-local, multicast and
+// unspecified addresses. It runs once the host is resolved, for every address tried
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	addr := addrPort.Addr().Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return errCalendarAddress
+	}
+	return nil
+}
+
+// calendarFeedURL returns the url of the calendar feed of a room
+func (m *Repository) calendarFeedURL(room models.Room) string {
+	return fmt.Sprintf("%s/ical/%s.ics", strings.TrimSuffix(m.App.BaseURL, "/"), room.ICalToken)
+}
+
+// RoomCalendar serves the calendar feed of the room at /ical/{token}.ics, with the nights
+// it is booked or blocked. The token in the url is what keeps it private. Blocks imported
+// from other calendars are left out, so that they don't come back to the calendar they
+// came from as events of their own
+func (m *Repository) RoomCalendar(w http.ResponseWriter, r *http.Request) {
+	exploded := strings.Split(r.URL.Path, "/")
+	if len(exploded) < 3 || !strings.HasSuffix(exploded[2], ".ics") {
+		http.NotFound(w, r)
+		return
+	}
+
+	room, err := m.DB.GetRoomByICalToken(r.Context(), strings.TrimSuffix(exploded[2], ".ics"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// the recent past too, as other sites may still show it
+	start := time.Now().AddDate(0, -1, 0)
+	restrictions, err := m.DB.GetRestrictionsForRoomByDate(r.Context(), room.ID, start, start.AddDate(2, 1, 0))
+	if err != nil {
+		logging.FromContext(r.Context()).Error("can't get restrictions for calendar", "room_id", room.ID, "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	host := "localhost"
+	if u, err := url.Parse(m.App.BaseURL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+
+	cal := ical.Calendar{
+		ProdID: "-//webapp-go-demo//Room calendar//EN",
+		Name:   room.RoomName,
+	}
+	for _, x := range restrictions {
+		if x.ExternalSource != "" {
+			continue
+		}
+		// nothing about the guests, the feed only tells when the room is taken
+		summary := "Blocked"
+		if x.ReservationID > 0 {
+			summary = "Booked"
+		}
+		cal.Events = append(cal.Events, ical.Event{
+			UID:     fmt.Sprintf("restriction-%d@%s", x.ID, host),
+			Summary: summary,
+			Start:   x.StartDate,
+			End:     x.EndDate,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s.ics"`, room.Slug))
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := ical.Write(w, cal); err != nil {
+		logging.FromContext(r.Context()).Error("can't write calendar", "room_id", room.ID, "error", err)
+	}
+}
+
+// AdminPostRoomCalendarToken gives the room at /admin/rooms/{id}/ical-token a new calendar
+// feed url. The previous one stops working
+func (m *Repository) AdminPostRoomCalendarToken(w http.ResponseWriter, r *http.Request) {
+	exploded := strings.Split(r.URL.Path, "/")
+	if len(exploded) < 4 {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	roomID, err := strconv.Atoi(exploded[3])
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+	roomURL := fmt.Sprintf("/admin/rooms/%d", roomID)
+
+	// only the token itself is used, it has to be shown again to copy the url
+	token, _, err := tokens.New()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't make a calendar url")
+		http.Redirect(w, r, roomURL, http.StatusSeeOther)
+		return
+	}
+
+	if err := m.DB.SetRoomICalToken(r.Context(), roomID, token); err != nil {
+		logging.FromContext(r.Context()).Error("can't set calendar token", "room_id", roomID, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Can't make a calendar url")
+		http.Redirect(w, r, roomURL, http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "New calendar url made, the previous one no longer works")
+	http.Redirect(w, r, roomURL, http.StatusSeeOther)
+}
+
+// AdminPostRoomCalendarImport imports the calendar uploaded or found at a url as blocks of the
+// room at /admin/rooms/{id}/ical-import. Importing the same calendar again adds, moves and
+// removes the blocks to match its events
+func (m *Repository) AdminPostRoomCalendarImport(w http.ResponseWriter, r *http.Request) {
+	exploded := strings.Split(r.URL.Path, "/")
+	if len(exploded) < 4 {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	roomID, err := strconv.Atoi(exploded[3])
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+	roomURL := fmt.Sprintf("/admin/rooms/%d", roomID)
+
+	if err := r.ParseMultipartForm(maxCalendarSize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, roomURL, http.StatusSeeOther)
+		return
+	}
+
+	var events []ical.Event
+	var source, importURL string
+
+	file, header, err := r.FormFile("ical_file")
+	if err == nil {
+		defer file.Close()
+		// events of files with the same name are the same calendar exported again
+		source = "file:" + header.Filename
+		events, err = ical.Parse(io.LimitReader(file, maxCalendarSize))
+	} else {
+		importURL = strings.TrimSpace(r.Form.Get("ical_url"))
+		if importURL == "" {
+			m.App.Session.Put(r.Context(), "error", "Choose a calendar file or give the url of a calendar")
+			http.Redirect(w, r, roomURL, http.StatusSeeOther)
+			return
+		}
+		source = importURL
+		events, err = fetchCalendar(r.Context(), importURL)
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("can't read calendar", "room_id", roomID, "source", source, "error", err)
+		// the error itself may tell about the network of the app, so only ours are shown
+		msg := "Can't read the calendar, check the file or the url"
+		if errors.Is(err, errCalendarURL) || errors.Is(err, errCalendarAddress) {
+			msg = fmt.Sprintf("Can't read the calendar: %s", err)
+		}
+		m.App.Session.Put(r.Context(), "error", msg)
+		http.Redirect(w, r, roomURL, http.StatusSeeOther)
+		return
+	}
+
+	blocks := make([]models.ExternalBlock, 0, len(events))
+	for _, e := range events {
+		blocks = append(blocks, models.ExternalBlock{UID: e.UID, StartDate: e.Start, EndDate: e.End})
+	}
+
+	sync, err := m.DB.SyncExternalBlocks(r.Context(), roomID, source, blocks)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("can't import calendar", "room_id", roomID, "source", source, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Can't import the calendar")
+		http.Redirect(w, r, roomURL, http.StatusSeeOther)
+		return
+	}
+
+	if importURL != "" {
+		if err := m.DB.SetRoomICalImportURL(r.Context(), roomID, importURL); err != nil {
+			logging.FromContext(r.Context()).Error("can't keep calendar url", "room_id", roomID, "error", err)
+		}
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Calendar imported: %d blocks added, %d moved and %d removed",
+		sync.Added, sync.Moved, sync.Removed))
+	if len(sync.Conflicts) > 0 {
+		var dates []string
+		for _, b := range sync.Conflicts {
+			dates = append(dates, fmt.Sprintf("%s to %s", b.StartDate.Format("2006-01-02"), b.EndDate.Format("2006-01-02")))
+		}
+		m.App.Session.Put(r.Context(), "warning", fmt.Sprintf("These events overlap a reservation or a block and were left out: %s",
+			strings.Join(dates, ", ")))
+	}
+	http.Redirect(w, r, roomURL, http.StatusSeeOther)
+}
+
+// fetchCalendar gets and parses the calendar at rawURL
+func fetchCalendar(ctx context.Context, rawURL string) ([]ical.Event, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errCalendarURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/calendar")
+
+	resp, err := calendarClient.Do(req)
+	if err != nil {
+		if errors.Is(err, errCalendarAddress) {
+			return nil, errCalendarAddress
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the server answered %s", resp.Status)
+	}
+
+	return ical.Parse(io.LimitReader(resp.Body, maxCalendarSize))
+}
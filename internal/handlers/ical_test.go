@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const importedCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:booked-elsewhere\r\n" +
+	"DTSTART;VALUE=DATE:20500103\r\n" +
+	"DTEND;VALUE=DATE:20500106\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:conflict\r\n" +
+	"DTSTART;VALUE=DATE:20500110\r\n" +
+	"DTEND;VALUE=DATE:20500112\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestRoomCalendar(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/ical/feed-token.ics", nil)
+	req = req.WithContext(getCtx(req))
+	rr := httptest.NewRecorder()
+
+	Repo.RoomCalendar(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+		t.Errorf("expected a calendar but got %s", ct)
+	}
+	for _, expected := range []string{"BEGIN:VCALENDAR", "X-WR-CALNAME:General's Quarters", "SUMMARY:Booked", "SUMMARY:Blocked"} {
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("expected to find %s but did not", expected)
+		}
+	}
+	if strings.Contains(rr.Body.String(), "restriction-3@") {
+		t.Error("expected the block imported from another calendar to be left out")
+	}
+
+	for _, path := range []string{"/ical/other-token.ics", "/ical/feed-token", "/ical"} {
+		req, _ = http.NewRequest("GET", path, nil)
+		req = req.WithContext(getCtx(req))
+		rr = httptest.NewRecorder()
+
+		Repo.RoomCalendar(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status %d but got %d", path, http.StatusNotFound, rr.Code)
+		}
+	}
+}
+
+func TestAdminPostRoomCalendarToken(t *testing.T) {
+	tests := []struct {
+		name             string
+		url              string
+		expectedLocation string
+		expectedFlash    string
+		expectedError    string
+	}{
+		{"new-token", "/admin/rooms/1/ical-token", "/admin/rooms/1", "New calendar url made, the previous one no longer works", ""},
+		{"error", "/admin/rooms/2/ical-token", "/admin/rooms/2", "", "Can't make a calendar url"},
+		{"invalid-id", "/admin/rooms/x/ical-token", "/admin/rooms", "", "missing url parameter"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", e.url, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		Repo.AdminPostRoomCalendarToken(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected status %d but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+		if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+			t.Errorf("%s: expected location %s but got %s", e.name, e.expectedLocation, loc)
+		}
+		if flash := session.PopString(ctx, "flash"); flash != e.expectedFlash {
+			t.Errorf("%s: expected flash %q but got %q", e.name, e.expectedFlash, flash)
+		}
+		if msg := session.PopString(ctx, "error"); msg != e.expectedError {
+			t.Errorf("%s: expected error %q but got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+func TestAdminPostRoomCalendarImport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/calendar.ics" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar")
+		w.Write([]byte(importedCalendar))
+	}))
+	defer server.Close()
+
+	// the test server listens on the loopback address, which only its own client reaches
+	client := calendarClient
+	defer func() { calendarClient = client }()
+
+	tests := []struct {
+		name            string
+		url             string
+		calendarURL     string
+		allowLoopback   bool
+		file            string
+		expectedFlash   string
+		expectedWarning bool
+		expectedError   string
+	}{
+		{
+			name:            "file",
+			url:             "/admin/rooms/1/ical-import",
+			file:            importedCalendar,
+			expectedFlash:   "Calendar imported: 1 blocks added, 0 moved and 0 removed",
+			expectedWarning: true,
+		},
+		{
+			name:            "url",
+			url:             "/admin/rooms/1/ical-import",
+			calendarURL:     server.URL + "/calendar.ics",
+			allowLoopback:   true,
+			expectedFlash:   "Calendar imported: 1 blocks added, 0 moved and 0 removed",
+			expectedWarning: true,
+		},
+		{
+			name:          "url-not-found",
+			url:           "/admin/rooms/1/ical-import",
+			calendarURL:   server.URL + "/missing.ics",
+			allowLoopback: true,
+			expectedError: "Can't read the calendar, check the file or the url",
+		},
+		{
+			name:          "url-loopback",
+			url:           "/admin/rooms/1/ical-import",
+			calendarURL:   server.URL + "/calendar.ics",
+			expectedError: "Can't read the calendar: the url leads to a private address",
+		},
+		{
+			name:          "url-metadata",
+			url:           "/admin/rooms/1/ical-import",
+			calendarURL:   "http://169.254.169.254/latest/meta-data/",
+			expectedError: "Can't read the calendar: the url leads to a private address",
+		},
+		{
+			name:          "url-scheme",
+			url:           "/admin/rooms/1/ical-import",
+			calendarURL:   "file:///etc/passwd",
+			expectedError: "Can't read the calendar: the url must start with http:// or https://",
+		},
+		{
+			name:          "not-a-calendar",
+			url:           "/admin/rooms/1/ical-import",
+			file:          "<html></html>",
+			expectedError: "Can't read the calendar, check the file or the url",
+		},
+		{
+			name:          "nothing",
+			url:           "/admin/rooms/1/ical-import",
+			expectedError: "Choose a calendar file or give the url of a calendar",
+		},
+		{
+			name:          "sync-error",
+			url:           "/admin/rooms/2/ical-import",
+			file:          importedCalendar,
+			expectedError: "Can't import the calendar",
+		},
+	}
+
+	for _, e := range tests {
+		calendarClient = client
+		if e.allowLoopback {
+			calendarClient = server.Client()
+		}
+
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("ical_url", e.calendarURL)
+		if e.file != "" {
+			fw, _ := mw.CreateFormFile("ical_file", "other-site.ics")
+			fw.Write([]byte(e.file))
+		}
+		mw.Close()
+
+		req, _ := http.NewRequest("POST", e.url, &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		Repo.AdminPostRoomCalendarImport(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected status %d but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+		if flash := session.PopString(ctx, "flash"); flash != e.expectedFlash {
+			t.Errorf("%s: expected flash %q but got %q", e.name, e.expectedFlash, flash)
+		}
+		if warning := session.PopString(ctx, "warning"); (warning != "") != e.expectedWarning {
+			t.Errorf("%s: expected a warning %t but got %q", e.name, e.expectedWarning, warning)
+		}
+		if msg := session.PopString(ctx, "error"); msg != e.expectedError {
+			t.Errorf("%s: expected error %q but got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+func TestPublicAddressOnly(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"10.1.2.3:80", false},
+		{"172.16.0.1:80", false},
+		{"192.168.1.1:80", false},
+		{"169.254.169.254:80", false},
+		{"[fe80::1]:80", false},
+		{"[fd00::1]:80", false},
+		{"0.0.0.0:80", false},
+		{"224.0.0.1:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+	}
+
+	for _, e := range tests {
+		err := publicAddressOnly("tcp", e.address, nil)
+		if (err == nil) != e.allowed {
+			t.Errorf("%s: expected allowed %t but got %v", e.address, e.allowed, err)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/forms"
+	"github.com/marcelofranco/webapp-go-demo/internal/i18n"
+	"github.com/marcelofranco/webapp-go-demo/internal/logging"
+	"github.com/marcelofranco/webapp-go-demo/internal/models"
+	"github.com/marcelofranco/webapp-go-demo/internal/render"
+	"github.com/marcelofranco/webapp-go-demo/internal/repository"
+	"github.com/marcelofranco/webapp-go-demo/internal/tokens"
+)
+
+// passwordResetTTL is how long a password reset link can be used
+const passwordResetTTL = time.Hour
+
+// ForgotPassword renders the page asking for the address to send a password reset link to
+func (m *Repository) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	render.RenderTemplate(w, r, "forgot-password.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// PostForgotPassword mails a password reset link to the user with the given address. An
+// address which is not verified gets the verification link instead, as it may not be the
+// one of the owner of the account. The answer is the same whether there is such a user or
+// not, so that it doesn't tell which addresses are registered
+func (m *Repository) PostForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("email")
+	form.IsEmail("email")
+
+	if !form.Valid() {
+		render.RenderTemplate(w, r, "forgot-password.page.tmpl", &models.TemplateData{
+			Form: form,
+		})
+		return
+	}
+
+	user, err := m.DB.GetUserByEmail(r.Context(), form.Get("email"))
+	if err == nil && !user.Verified() {
+		if err := m.sendVerification(r.Context(), user); err != nil {
+			logging.FromContext(r.Context()).Error("can't send verification", "user_id", user.ID, "error", err)
+		}
+	} else if err == nil {
+		if err := m.sendPasswordReset(r, user); err != nil {
+			logging.FromContext(r.Context()).Error("can't create password reset", "user_id", user.ID, "error", err)
+			m.App.Session.Put(r.Context(), "error", "Can't send the reset link, try again later")
+			http.Redirect(w, r, "/forgot-password", http.StatusSeeOther)
+			return
+		}
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "If this address is registered, a link to reset the password was sent to it.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// sendPasswordReset stores a new password reset token for the user and mails the link using it
+func (m *Repository) sendPasswordReset(r *http.Request, user models.User) error {
+	token, hash, err := tokens.New()
+	if err != nil {
+		return err
+	}
+
+	err = m.DB.CreatePasswordReset(r.Context(), user.ID, hash, time.Now().Add(passwordResetTTL))
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", strings.TrimSuffix(m.App.BaseURL, "/"), url.QueryEscape(token))
+
+	// users who never chose a language get the one they asked for the link in
+	locale := user.Locale
+	if locale == "" {
+		locale = i18n.FromContext(r.Context())
+	}
+
+	return m.queueMail(r.Context(), models.MailData{
+		From:     m.App.MailFrom,
+		To:       user.Email,
+		Subject:  "Reset your password",
+		Template: "password-reset.mail.tmpl",
+		Data:     models.LinkMailData{User: user, Link: link},
+		Locale:   locale,
+	})
+}
+
+// ResetPassword renders the page to choose a new password with the token of a reset link
+func (m *Repository) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	_, err := m.DB.PasswordResetUserID(r.Context(), tokens.Hash(token))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", resetTokenMessage(err))
+		http.Redirect(w, r, "/forgot-password", http.StatusSeeOther)
+		return
+	}
+
+	render.RenderTemplate(w, r, "reset-password.page.tmpl", &models.TemplateData{
+		Form:      forms.New(nil),
+		StringMap: map[string]string{"token": token},
+	})
+}
+
+// PostResetPassword sets the new password, uses up the token and signs the user out everywhere
+func (m *Repository) PostResetPassword(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	token := r.Form.Get("token")
+
+	form := forms.New(r.PostForm)
+	form.Required("password", "password_confirm")
+	form.MinLenght("password", 8)
+	form.ValidPassword("password")
+	form.Equal("password_confirm", "password")
+
+	if !form.Valid() {
+		render.RenderTemplate(w, r, "reset-password.page.tmpl", &models.TemplateData{
+			Form:      form,
+			StringMap: map[string]string{"token": token},
+		})
+		return
+	}
+
+	_, err := m.DB.ResetPassword(r.Context(), tokens.Hash(token), form.Get("password"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", resetTokenMessage(err))
+		http.Redirect(w, r, "/forgot-password", http.StatusSeeOther)
+		return
+	}
+
+	_ = m.App.Session.RenewToken(r.Context())
+	m.App.Session.Remove(r.Context(), "user_id")
+	m.App.Session.Remove(r.Context(), "access_level")
+	m.App.Session.Put(r.Context(), "flash", "Your password was changed, you can log in now.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// resetTokenMessage explains why a password reset token can't be used
+func resetTokenMessage(err error) string {
+	if errors.Is(err, repository.ErrInvalidToken) {
+		return "This link is invalid or has expired, ask for a new one"
+	}
+	return "Can't reset the password, try again later"
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var passwordTests = []struct {
+	name               string
+	method             string
+	url                string
+	postedData         url.Values
+	handler            func(*Repository, http.ResponseWriter, *http.Request)
+	expectedStatusCode int
+	expectedLocation   string
+	expectedHTML       string
+}{
+	{
+		name:               "forgot-password",
+		method:             "GET",
+		url:                "/forgot-password",
+		handler:            (*Repository).ForgotPassword,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `action="/forgot-password"`,
+	},
+	{
+		name:               "forgot-password-known-email",
+		method:             "POST",
+		url:                "/forgot-password",
+		postedData:         url.Values{"email": {"john@smith.com"}},
+		handler:            (*Repository).PostForgotPassword,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/",
+	},
+	{
+		name:               "forgot-password-unknown-email",
+		method:             "POST",
+		url:                "/forgot-password",
+		postedData:         url.Values{"email": {"test@here.com"}},
+		handler:            (*Repository).PostForgotPassword,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/",
+	},
+	{
+		name:               "forgot-password-unverified-email",
+		method:             "POST",
+		url:                "/forgot-password",
+		postedData:         url.Values{"email": {"unverified@here.com"}},
+		handler:            (*Repository).PostForgotPassword,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/",
+	},
+	{
+		name:               "forgot-password-outbox-error",
+		method:             "POST",
+		url:                "/forgot-password",
+		postedData:         url.Values{"email": {"outbox-error@here.com"}},
+		handler:            (*Repository).PostForgotPassword,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/forgot-password",
+	},
+	{
+		name:               "forgot-password-invalid-email",
+		method:             "POST",
+		url:                "/forgot-password",
+		postedData:         url.Values{"email": {"john"}},
+		handler:            (*Repository).PostForgotPassword,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "Invalid email address",
+	},
+	{
+		name:               "reset-password",
+		method:             "GET",
+		url:                "/reset-password?token=valid-token",
+		handler:            (*Repository).ResetPassword,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `name="token" value="valid-token"`,
+	},
+	{
+		name:               "reset-password-invalid-token",
+		method:             "GET",
+		url:                "/reset-password?token=used-token",
+		handler:            (*Repository).ResetPassword,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/forgot-password",
+	},
+	{
+		name:   "post-reset-password",
+		method: "POST",
+		url:    "/reset-password",
+		postedData: url.Values{
+			"token":            {"valid-token"},
+			"password":         {"N3w-password"},
+			"password_confirm": {"N3w-password"},
+		},
+		handler:            (*Repository).PostResetPassword,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/",
+	},
+	{
+		name:   "post-reset-password-weak",
+		method: "POST",
+		url:    "/reset-password",
+		postedData: url.Values{
+			"token":            {"valid-token"},
+			"password":         {"password"},
+			"password_confirm": {"password"},
+		},
+		handler:            (*Repository).PostResetPassword,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "Needs to have at least 1 uppercase letter",
+	},
+	{
+		name:   "post-reset-password-mismatch",
+		method: "POST",
+		url:    "/reset-password",
+		postedData: url.Values{
+			"token":            {"valid-token"},
+			"password":         {"N3w-password"},
+			"password_confirm": {"N3w-passwort"},
+		},
+		handler:            (*Repository).PostResetPassword,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "The values don&#39;t match",
+	},
+	{
+		name:   "post-reset-password-invalid-token",
+		method: "POST",
+		url:    "/reset-password",
+		postedData: url.Values{
+			"token":            {"used-token"},
+			"password":         {"N3w-password"},
+			"password_confirm": {"N3w-password"},
+		},
+		handler:            (*Repository).PostResetPassword,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/forgot-password",
+	},
+}
+
+func TestPasswordReset(t *testing.T) {
+	for _, e := range passwordTests {
+		var req *http.Request
+		if e.postedData != nil {
+			req, _ = http.NewRequest(e.method, e.url, strings.NewReader(e.postedData.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req, _ = http.NewRequest(e.method, e.url, nil)
+		}
+		req = req.WithContext(getCtx(req))
+		rr := httptest.NewRecorder()
+
+		e.handler(Repo, rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc == nil || actualLoc.String() != e.expectedLocation {
+				t.Errorf("%s: expected location %s but got %v", e.name, e.expectedLocation, actualLoc)
+			}
+		}
+
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("%s: expected to find %s but did not", e.name, e.expectedHTML)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/forms"
+	"github.com/marcelofranco/webapp-go-demo/internal/i18n"
+	"github.com/marcelofranco/webapp-go-demo/internal/logging"
+	"github.com/marcelofranco/webapp-go-demo/internal/models"
+	"github.com/marcelofranco/webapp-go-demo/internal/render"
+)
+
+// sessionUser returns the logged in user, or puts an error in the session when there is none
+func (m *Repository) sessionUser(r *http.Request) (models.User, bool) {
+	userID, ok := m.App.Session.Get(r.Context(), "user_id").(int)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Can't get user from session")
+		return models.User{}, false
+	}
+
+	user, err := m.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't find user")
+		return models.User{}, false
+	}
+
+	return user, true
+}
+
+// renderProfile renders the profile page, with the details of user in its form
+func renderProfile(w http.ResponseWriter, r *http.Request, user models.User, form *forms.Form) {
+	render.RenderTemplate(w, r, "profile.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: map[string]interface{}{"user": user, "locales": i18n.Supported()},
+	})
+}
+
+// Profile renders the page where users edit their details and change their password
+func (m *Repository) Profile(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.sessionUser(r)
+	if !ok {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	// users who never chose a language read the site in the one it is shown in
+	if user.Locale == "" {
+		user.Locale = i18n.FromContext(r.Context())
+	}
+
+	renderProfile(w, r, user, forms.New(nil))
+}
+
+// PostProfile saves the details of the logged in user. Changing the email address takes the
+// current password, the previous address is told about it and the new one has to be verified again
+func (m *Repository) PostProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.sessionUser(r)
+	if !ok {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+		return
+	}
+
+	oldEmail := user.Email
+	user.FirstName = r.Form.Get("first_name")
+	user.LastName = r.Form.Get("last_name")
+	user.Email = r.Form.Get("email")
+	if locale := r.Form.Get("locale"); locale != "" {
+		user.Locale = locale
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email")
+	form.MinLenght("first_name", 3)
+	form.IsEmail("email")
+
+	if user.Locale != "" && !i18n.IsSupported(user.Locale) {
+		form.Errors.Add("locale", "Choose one of the languages of the list")
+	}
+
+	emailChanged := user.Email != oldEmail
+	if emailChanged {
+		form.Required("current_password")
+	}
+	if form.Valid() && emailChanged {
+		if other, err := m.DB.GetUserByEmail(r.Context(), user.Email); err == nil && other.ID != user.ID {
+			form.Errors.Add("email", "Email already registered")
+		}
+	}
+	if form.Valid() && emailChanged {
+		m.checkPassword(r, form, "current_password", models.User{ID: user.ID, Email: oldEmail})
+	}
+
+	if !form.Valid() {
+		renderProfile(w, r, user, form)
+		return
+	}
+
+	if err := m.DB.UpdateUser(r.Context(), user); err != nil {
+		logging.FromContext(r.Context()).Error("can't update user", "user_id", user.ID, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Can't save your profile, try again later")
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+		return
+	}
+
+	if emailChanged {
+		// a notice the user can't read anymore is not a reason to keep the new address unverified
+		if err := m.sendEmailChanged(r.Context(), user, oldEmail); err != nil {
+			logging.FromContext(r.Context()).Error("can't send email change notice", "user_id", user.ID, "error", err)
+		}
+		if err := m.sendVerification(r.Context(), user); err != nil {
+			logging.FromContext(r.Context()).Error("can't send verification", "user_id", user.ID, "error", err)
+			m.App.Session.Put(r.Context(), "warning", "Your profile was saved, but we couldn't mail the link to verify the new address. Ask for a new one.")
+		} else {
+			m.App.Session.Put(r.Context(), "flash", i18n.T(user.Locale,
+				"Your profile was saved. Open the link we mailed to %s to verify the new address.", user.Email))
+		}
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Your profile was saved.")
+	}
+	if user.Locale != "" {
+		m.App.Session.Put(r.Context(), "locale", user.Locale)
+	}
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
+
+// sendEmailChanged mails the previous address of the user that it was changed, so that the
+// owner of the account learns about a change made by someone else
+func (m *Repository) sendEmailChanged(ctx context.Context, user models.User, previous string) error {
+	return m.queueMail(ctx, models.MailData{
+		From:     m.App.MailFrom,
+		To:       previous,
+		Subject:  "Your email address was changed",
+		Template: "email-changed.mail.tmpl",
+		Data:     models.EmailChangeMailData{User: user, Previous: previous},
+		Locale:   user.Locale,
+	})
+}
+
+// PostChangePassword sets a new password for the logged in user, who has to give the current one.
+// Other sessions of the user are signed out
+func (m *Repository) PostChangePassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.sessionUser(r)
+	if !ok {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("current_password", "password", "password_confirm")
+	form.MinLenght("password", 8)
+	form.ValidPassword("password")
+	form.Equal("password_confirm", "password")
+
+	if form.Valid() {
+		m.checkPassword(r, form, "current_password", user)
+	}
+
+	if !form.Valid() {
+		renderProfile(w, r, user, form)
+		return
+	}
+
+	sessionVersion, err := m.DB.UpdatePassword(r.Context(), user.ID, form.Get("password"))
+	if err != nil {
+		logging.FromContext(r.Context()).Error("can't update password", "user_id", user.ID, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Can't change your password, try again later")
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+		return
+	}
+
+	// the other sessions are signed out by the new version, this one stays
+	_ = m.App.Session.RenewToken(r.Context())
+	m.App.Session.Put(r.Context(), "session_version", sessionVersion)
+	m.App.Session.Put(r.Context(), "flash", "Your password was changed, your other sessions were signed out.")
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var profileTests = []struct {
+	name               string
+	method             string
+	url                string
+	userID             int
+	postedData         url.Values
+	handler            func(*Repository, http.ResponseWriter, *http.Request)
+	expectedStatusCode int
+	expectedHTML       string
+	expectedFlash      string
+}{
+	{
+		name:               "profile",
+		method:             "GET",
+		url:                "/profile",
+		userID:             1,
+		handler:            (*Repository).Profile,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       `value="john@smith.com"`,
+	},
+	{
+		name:               "profile-not-logged-in",
+		method:             "GET",
+		url:                "/profile",
+		handler:            (*Repository).Profile,
+		expectedStatusCode: http.StatusSeeOther,
+	},
+	{
+		name:   "post-profile",
+		method: "POST",
+		url:    "/profile",
+		userID: 1,
+		postedData: url.Values{
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+		},
+		handler:            (*Repository).PostProfile,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedFlash:      "Your profile was saved.",
+	},
+	{
+		name:   "post-profile-new-email",
+		method: "POST",
+		url:    "/profile",
+		userID: 1,
+		postedData: url.Values{
+			"first_name":       {"John"},
+			"last_name":        {"Smith"},
+			"email":            {"test@here.com"},
+			"current_password": {"0ld-password"},
+		},
+		handler:            (*Repository).PostProfile,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedFlash:      "Your profile was saved. Open the link we mailed to test@here.com to verify the new address.",
+	},
+	{
+		name:   "post-profile-new-email-without-password",
+		method: "POST",
+		url:    "/profile",
+		userID: 1,
+		postedData: url.Values{
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"test@here.com"},
+		},
+		handler:            (*Repository).PostProfile,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "This field cannot be blank",
+	},
+	{
+		name:   "post-profile-new-email-wrong-password",
+		method: "POST",
+		url:    "/profile",
+		userID: 1,
+		postedData: url.Values{
+			"first_name":       {"John"},
+			"last_name":        {"Smith"},
+			"email":            {"test@here.com"},
+			"current_password": {"unauthorized"},
+		},
+		handler:            (*Repository).PostProfile,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "The current password is not correct",
+	},
+	{
+		name:   "post-profile-email-taken",
+		method: "POST",
+		url:    "/profile",
+		userID: 1,
+		postedData: url.Values{
+			"first_name":       {"John"},
+			"last_name":        {"Smith"},
+			"email":            {"jane@smith.com"},
+			"current_password": {"0ld-password"},
+		},
+		handler:            (*Repository).PostProfile,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "Email already registered",
+	},
+	{
+		name:   "post-profile-invalid",
+		method: "POST",
+		url:    "/profile",
+		userID: 1,
+		postedData: url.Values{
+			"first_name": {"J"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+		},
+		handler:            (*Repository).PostProfile,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "This field must be at least 3 characters long",
+	},
+	{
+		name:   "post-profile-error",
+		method: "POST",
+		url:    "/profile",
+		userID: 1,
+		postedData: url.Values{
+			"first_name": {"Error"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+		},
+		handler:            (*Repository).PostProfile,
+		expectedStatusCode: http.StatusSeeOther,
+	},
+	{
+		name:   "change-password",
+		method: "POST",
+		url:    "/profile/password",
+		userID: 1,
+		postedData: url.Values{
+			"current_password": {"0ld-password"},
+			"password":         {"N3w-password"},
+			"password_confirm": {"N3w-password"},
+		},
+		handler:            (*Repository).PostChangePassword,
+		expectedStatusCode: http.StatusSeeOther,
+		expectedFlash:      "Your password was changed, your other sessions were signed out.",
+	},
+	{
+		name:   "change-password-wrong-current",
+		method: "POST",
+		url:    "/profile/password",
+		userID: 1,
+		postedData: url.Values{
+			"current_password": {"unauthorized"},
+			"password":         {"N3w-password"},
+			"password_confirm": {"N3w-password"},
+		},
+		handler:            (*Repository).PostChangePassword,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "The current password is not correct",
+	},
+	{
+		name:   "change-password-locked-out",
+		method: "POST",
+		url:    "/profile/password",
+		userID: 5,
+		postedData: url.Values{
+			"current_password": {"0ld-password"},
+			"password":         {"N3w-password"},
+			"password_confirm": {"N3w-password"},
+		},
+		handler:            (*Repository).PostChangePassword,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "Too many failed sign in attempts, try again in",
+	},
+	{
+		name:   "change-password-mismatch",
+		method: "POST",
+		url:    "/profile/password",
+		userID: 1,
+		postedData: url.Values{
+			"current_password": {"0ld-password"},
+			"password":         {"N3w-password"},
+			"password_confirm": {"N3w-passwort"},
+		},
+		handler:            (*Repository).PostChangePassword,
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "The values don&#39;t match",
+	},
+}
+
+func TestProfile(t *testing.T) {
+	for _, e := range profileTests {
+		var req *http.Request
+		if e.postedData != nil {
+			req, _ = http.NewRequest(e.method, e.url, strings.NewReader(e.postedData.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req, _ = http.NewRequest(e.method, e.url, nil)
+		}
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		if e.userID > 0 {
+			session.Put(ctx, "user_id", e.userID)
+		}
+		rr := httptest.NewRecorder()
+
+		e.handler(Repo, rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("%s: expected to find %s but did not", e.name, e.expectedHTML)
+		}
+		if e.expectedFlash != "" {
+			if flash := session.PopString(ctx, "flash"); flash != e.expectedFlash {
+				t.Errorf("%s: expected flash %q but got %q", e.name, e.expectedFlash, flash)
+			}
+		}
+	}
+}
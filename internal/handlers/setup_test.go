@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"context"
 	"encoding/gob"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -17,18 +19,32 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/justinas/nosurf"
 	"github.com/marcelofranco/webapp-go-demo/internal/config"
+	"github.com/marcelofranco/webapp-go-demo/internal/helpers"
+	"github.com/marcelofranco/webapp-go-demo/internal/i18n"
+	"github.com/marcelofranco/webapp-go-demo/internal/mailer"
 	"github.com/marcelofranco/webapp-go-demo/internal/models"
 	"github.com/marcelofranco/webapp-go-demo/internal/render"
+	"github.com/marcelofranco/webapp-go-demo/internal/repository/dbrepo"
 )
 
 var functions = template.FuncMap{
 	"humanDate": render.HumanDate,
+	"iterate":   render.Iterate,
+	"add":       render.Add,
+	"price":     render.FormatPrice,
+	"T": func(text string, args ...interface{}) string {
+		return i18n.T(i18n.DefaultLocale, text, args...)
+	},
+	"date": func(t time.Time) string {
+		return i18n.FormatDate(i18n.DefaultLocale, t)
+	},
+	"locales":      i18n.Supported,
+	"languageName": i18n.Name,
 }
 var app config.AppConfig
 var session *scs.SessionManager
 var pathToTemplates = "./../../templates"
-var infoLog *log.Logger
-var errorLog *log.Logger
+var pathToMailTemplates = "./../../email-templates"
 
 func TestMain(m *testing.M) {
 	gob.Register(models.Reservation{})
@@ -36,14 +52,18 @@ func TestMain(m *testing.M) {
 	gob.Register(models.Room{})
 	gob.Register(models.Restriction{})
 	gob.Register(models.RoomRestriction{})
+	gob.Register(map[string]int{})
 
 	app.InProduction = false
+	app.SigningKey = "test-signing-key-of-32-characters"
+	app.SigninMaxFailures = 3
+	app.SigninIPMaxFailures = 20
+	app.SigninLockout = 15 * time.Minute
+	// the test data books stays decades ahead, so there is no maximum stay nor horizon
+	app.BookingMinNights = 1
+	app.BookingSameDayCutoff = 18 * time.Hour
 
-	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	app.InfoLog = infoLog
-
-	errorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-	app.ErrorLog = errorLog
+	app.Logger = slog.New(slog.NewTextHandler(os.Stdout, nil))
 
 	session = scs.New()
 	session.Lifetime = 24 * time.Hour
@@ -52,11 +72,12 @@ func TestMain(m *testing.M) {
 	session.Cookie.Secure = app.InProduction
 	app.Session = session
 
-	mailChan := make(chan models.MailData)
-	app.MailChan = mailChan
-	defer close(mailChan)
-
-	listenForMail()
+	// the queue only needs to run for the readiness check
+	app.MailQueue = mailer.New(dbrepo.NewTestingsRepo(&app), func(models.MailData) error { return nil })
+	go app.MailQueue.Run(context.Background())
+	for !app.MailQueue.Running() {
+		time.Sleep(time.Millisecond)
+	}
 
 	tc, err := CreateTestTemplateCache()
 	if err != nil {
@@ -64,23 +85,22 @@ func TestMain(m *testing.M) {
 	}
 
 	app.TemplateCache = tc
+
+	mtc, err := CreateTestMailTemplateCache()
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.MailTemplateCache = mtc
 	app.UseCache = true
 
 	repo := NewTestRepo(&app)
 	NewHandlers(repo)
 	render.NewTemplates(&app)
+	helpers.NewHelpers(&app)
 
 	os.Exit(m.Run())
 }
 
-func listenForMail() {
-	go func() {
-		for {
-			_ = <-app.MailChan
-		}
-	}()
-}
-
 func getRoutes() http.Handler {
 	mux := chi.NewRouter()
 
@@ -88,10 +108,16 @@ func getRoutes() http.Handler {
 	// mux.Use(NoSurf)
 	mux.Use(SessionLoad)
 
+	mux.Get("/healthz", Repo.Healthz)
+	mux.Get("/readyz", Repo.Readyz)
+	mux.Get("/metrics", Repo.Metrics)
+
 	mux.Get("/", Repo.Home)
 	mux.Get("/about", Repo.About)
-	mux.Get("/generals-quarters", Repo.Generals)
-	mux.Get("/majors-suite", Repo.Majors)
+	mux.Get("/rooms", Repo.Rooms)
+	mux.Get("/rooms/{slug}", Repo.Room)
+	mux.Handle("/generals-quarters", http.RedirectHandler("/rooms/generals-quarters", http.StatusMovedPermanently))
+	mux.Handle("/majors-suite", http.RedirectHandler("/rooms/majors-suite", http.StatusMovedPermanently))
 
 	mux.Get("/search-availability", Repo.Availability)
 	mux.Post("/search-availability", Repo.PostAvailability)
@@ -160,3 +186,31 @@ func CreateTestTemplateCache() (map[string]*template.Template, error) {
 
 	return myCache, nil
 }
+
+// CreateTestMailTemplateCache parses the mail templates with their layouts, so that the mails
+// handlers store in the outbox can be rendered
+func CreateTestMailTemplateCache() (map[string]*template.Template, error) {
+	myCache := map[string]*template.Template{}
+
+	mails, err := filepath.Glob(fmt.Sprintf("%s/*.mail.tmpl", pathToMailTemplates))
+	if err != nil {
+		return myCache, err
+	}
+
+	for _, mail := range mails {
+		mailName := filepath.Base(mail)
+		ts, err := template.New(mailName).Funcs(functions).ParseFiles(mail)
+		if err != nil {
+			return myCache, err
+		}
+
+		ts, err = ts.ParseGlob(fmt.Sprintf("%s/*.layout.tmpl", pathToMailTemplates))
+		if err != nil {
+			return myCache, err
+		}
+
+		myCache[mailName] = ts
+	}
+
+	return myCache, nil
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/i18n"
+	"github.com/marcelofranco/webapp-go-demo/internal/logging"
+	"github.com/marcelofranco/webapp-go-demo/internal/models"
+	"github.com/marcelofranco/webapp-go-demo/internal/repository"
+	"github.com/marcelofranco/webapp-go-demo/internal/tokens"
+)
+
+// emailVerificationTTL is how long an email verification link can be used
+const emailVerificationTTL = 48 * time.Hour
+
+// verificationMessage returns what the signature of a verification link is made of. The
+// address is part of it, so that the link stops working when the user changes it
+func verificationMessage(userID int, email string, expires int64) string {
+	return fmt.Sprintf("verify-email:%d:%s:%d", userID, email, expires)
+}
+
+// sendVerification mails the user a signed link to verify the email address, in the language of the user
+func (m *Repository) sendVerification(ctx context.Context, user models.User) error {
+	expires := time.Now().Add(emailVerificationTTL).Unix()
+	signature := tokens.Sign([]byte(m.App.SigningKey), verificationMessage(user.ID, user.Email, expires))
+
+	link := fmt.Sprintf("%s/verify-email?id=%d&expires=%d&signature=%s",
+		strings.TrimSuffix(m.App.BaseURL, "/"), user.ID, expires, signature)
+
+	return m.queueMail(ctx, models.MailData{
+		From:     m.App.MailFrom,
+		To:       user.Email,
+		Subject:  "Verify your email address",
+		Template: "verify-email.mail.tmpl",
+		Data:     models.LinkMailData{User: user, Link: link},
+		Locale:   user.Locale,
+	})
+}
+
+// VerifyEmail checks the signed link mailed to a user and marks the address as verified
+func (m *Repository) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	userID, err := strconv.Atoi(query.Get("id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "This link is invalid")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "This link is invalid")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	user, err := m.DB.GetUserByID(r.Context(), userID)
+	if err != nil || !tokens.Verify([]byte(m.App.SigningKey), verificationMessage(user.ID, user.Email, expires), query.Get("signature")) {
+		m.App.Session.Put(r.Context(), "error", "This link is invalid")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if time.Now().Unix() > expires {
+		m.App.Session.Put(r.Context(), "error", "This link has expired, sign in to get a new one")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.VerifyEmail(r.Context(), user.ID, user.Email)
+	if errors.Is(err, repository.ErrInvalidToken) {
+		m.App.Session.Put(r.Context(), "error", "This link is invalid")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("can't verify email", "user_id", user.ID, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Can't verify the address, try again later")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Your email address is verified.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// PostResendVerification mails the logged in user a new verification link
+func (m *Repository) PostResendVerification(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.sessionUser(r)
+	if !ok {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if user.Verified() {
+		m.App.Session.Put(r.Context(), "flash", "Your email address is already verified.")
+	} else if err := m.sendVerification(r.Context(), user); err != nil {
+		logging.FromContext(r.Context()).Error("can't send verification", "user_id", user.ID, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Can't send the link, try again later")
+	} else {
+		m.App.Session.Put(r.Context(), "flash", i18n.T(i18n.FromContext(r.Context()), "A new verification link was sent to %s.", user.Email))
+	}
+	http.Redirect(w, r, "/booked-rooms", http.StatusSeeOther)
+}
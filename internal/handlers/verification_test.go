@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/tokens"
+)
+
+// verificationLink returns the path of a verification link signed with the key of the tests
+func verificationLink(userID int, email string, expires time.Time) string {
+	signature := tokens.Sign([]byte(app.SigningKey), verificationMessage(userID, email, expires.Unix()))
+	return fmt.Sprintf("/verify-email?id=%d&expires=%d&signature=%s", userID, expires.Unix(), signature)
+}
+
+func TestRepository_VerifyEmail(t *testing.T) {
+	tomorrow := time.Now().Add(24 * time.Hour)
+
+	tests := []struct {
+		name      string
+		url       string
+		wantFlash string
+		wantError string
+	}{
+		{"valid", verificationLink(4, "unverified@here.com", tomorrow), "Your email address is verified.", ""},
+		{"expired", verificationLink(4, "unverified@here.com", time.Now().Add(-time.Hour)), "", "This link has expired, sign in to get a new one"},
+		{"changed-email", verificationLink(4, "old@here.com", tomorrow), "", "This link is invalid"},
+		{"tampered", verificationLink(4, "unverified@here.com", tomorrow) + "x", "", "This link is invalid"},
+		{"unknown-user", verificationLink(2, "", tomorrow), "", "This link is invalid"},
+		{"invalid-id", "/verify-email?id=x", "", "This link is invalid"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		Repo.VerifyEmail(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected status %d but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+		if flash := session.PopString(ctx, "flash"); flash != e.wantFlash {
+			t.Errorf("%s: expected flash %q but got %q", e.name, e.wantFlash, flash)
+		}
+		if msg := session.PopString(ctx, "error"); msg != e.wantError {
+			t.Errorf("%s: expected error %q but got %q", e.name, e.wantError, msg)
+		}
+	}
+}
+
+func TestRepository_PostResendVerification(t *testing.T) {
+	tests := []struct {
+		name      string
+		userID    int
+		wantFlash string
+		wantLoc   string
+	}{
+		{"unverified", 4, "A new verification link was sent to unverified@here.com.", "/booked-rooms"},
+		{"verified", 1, "Your email address is already verified.", "/booked-rooms"},
+		{"not-logged-in", 0, "", "/"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/verify-email/resend", nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		if e.userID > 0 {
+			session.Put(ctx, "user_id", e.userID)
+		}
+		rr := httptest.NewRecorder()
+
+		Repo.PostResendVerification(rr, req)
+
+		if loc := rr.Header().Get("Location"); loc != e.wantLoc {
+			t.Errorf("%s: expected location %s but got %s", e.name, e.wantLoc, loc)
+		}
+		if flash := session.PopString(ctx, "flash"); flash != e.wantFlash {
+			t.Errorf("%s: expected flash %q but got %q", e.name, e.wantFlash, flash)
+		}
+	}
+}
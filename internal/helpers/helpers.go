@@ -1,11 +1,14 @@
 package helpers
 
 import (
-	"fmt"
+	"encoding/json"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"strings"
 
 	"github.com/marcelofranco/webapp-go-demo/internal/config"
+	"github.com/marcelofranco/webapp-go-demo/internal/logging"
 )
 
 var app *config.AppConfig
@@ -15,14 +18,15 @@ func NewHelpers(a *config.AppConfig) {
 	app = a
 }
 
-func ClientError(w http.ResponseWriter, status int) {
-	app.InfoLog.Printf("Client error with a status of %d\n", status)
+// ClientError answers with an error status caused by the request
+func ClientError(w http.ResponseWriter, r *http.Request, status int) {
+	logging.FromContext(r.Context()).Info("client error", "status", status)
 	http.Error(w, http.StatusText(status), status)
 }
 
-func ServerError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	app.ErrorLog.Println(trace)
+// ServerError logs err with the stack and answers 500
+func ServerError(w http.ResponseWriter, r *http.Request, err error) {
+	logging.FromContext(r.Context()).Error(err.Error(), "stack", string(debug.Stack()))
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
@@ -30,3 +34,67 @@ func IsAuthenticated(r *http.Request) bool {
 	exists := app.Session.Exists(r.Context(), "user_id")
 	return exists
 }
+
+// AccessLevel returns the access level of the logged in user
+func AccessLevel(r *http.Request) int {
+	return app.Session.GetInt(r.Context(), "access_level")
+}
+
+// HasRole checks if the logged in user has at least the given access level
+func HasRole(r *http.Request, accessLevel int) bool {
+	return IsAuthenticated(r) && AccessLevel(r) >= accessLevel
+}
+
+// ClientIP returns the IP address of the client. With trust-proxy-headers on, it is the one
+// the load balancer added last to X-Forwarded-For, as the ones before come from the client
+func ClientIP(r *http.Request) string {
+	if app.TrustProxyHeaders {
+		if forwarded := strings.Join(r.Header.Values("X-Forwarded-For"), ","); forwarded != "" {
+			addrs := strings.Split(forwarded, ",")
+			return strings.TrimSpace(addrs[len(addrs)-1])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// APIError is the error object returned by the JSON API
+type APIError struct {
+	Status  int               `json:"status"`
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// WriteJSON writes v as a JSON response with the given status
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	out, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// WriteAPIError writes an error object of the JSON API, with the errors of each field when given
+func WriteAPIError(w http.ResponseWriter, status int, message string, fields map[string]string) {
+	resp := struct {
+		Error APIError `json:"error"`
+	}{
+		Error: APIError{
+			Status:  status,
+			Code:    strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_")),
+			Message: message,
+			Fields:  fields,
+		},
+	}
+
+	WriteJSON(w, status, resp)
+}
@@ -0,0 +1,39 @@
+package helpers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/config"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		forwarded  []string
+		want       string
+	}{
+		{"remote-addr", false, nil, "192.0.2.1"},
+		{"ignored-header", false, []string{"203.0.113.9"}, "192.0.2.1"},
+		{"proxy", true, []string{"203.0.113.9"}, "203.0.113.9"},
+		{"spoofed", true, []string{"10.0.0.1, 198.51.100.7", "203.0.113.9"}, "203.0.113.9"},
+		{"no-header", true, nil, "192.0.2.1"},
+	}
+
+	for _, e := range tests {
+		var a config.AppConfig
+		a.TrustProxyHeaders = e.trustProxy
+		NewHelpers(&a)
+
+		req, _ := http.NewRequest("POST", "/signin", nil)
+		req.RemoteAddr = "192.0.2.1:51234"
+		for _, f := range e.forwarded {
+			req.Header.Add("X-Forwarded-For", f)
+		}
+
+		if got := ClientIP(req); got != e.want {
+			t.Errorf("%s: expected %s but got %s", e.name, e.want, got)
+		}
+	}
+}
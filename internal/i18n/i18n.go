@@ -0,0 +1,142 @@
+// Package i18n translates the texts shown to guests. The catalogs under locales map the
+// English texts to their translation, so English needs no catalog and a text missing
+// from a catalog is shown in English
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLocale is the language of the texts in the code and templates
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var catalogFiles embed.FS
+
+// catalogs holds the translations of each locale but the default one
+var catalogs = map[string]map[string]string{}
+
+// names are the names of the locales in their own language, for the language switcher
+var names = map[string]string{
+	"en": "English",
+	"es": "Español",
+	"pt": "Português",
+}
+
+// dateLayouts are the layouts of the dates shown in each locale
+var dateLayouts = map[string]string{
+	"en": "Jan 2, 2006",
+	"es": "02/01/2006",
+	"pt": "02/01/2006",
+}
+
+type ctxKey struct{}
+
+func init() {
+	files, err := catalogFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, f := range files {
+		b, err := catalogFiles.ReadFile(path.Join("locales", f.Name()))
+		if err != nil {
+			panic(err)
+		}
+
+		catalog := map[string]string{}
+		if err := json.Unmarshal(b, &catalog); err != nil {
+			panic(fmt.Sprintf("can't read catalog %s: %s", f.Name(), err))
+		}
+		catalogs[strings.TrimSuffix(f.Name(), ".json")] = catalog
+	}
+}
+
+// Supported returns the locales there is a catalog for, the default one first
+func Supported() []string {
+	locales := []string{DefaultLocale}
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales[1:])
+	return locales
+}
+
+// IsSupported tells if locale is one of the supported locales
+func IsSupported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok || locale == DefaultLocale
+}
+
+// Name returns the name of locale in its own language
+func Name(locale string) string {
+	if name, ok := names[locale]; ok {
+		return name
+	}
+	return locale
+}
+
+// T returns the translation of text to locale, formatted with args like fmt.Sprintf.
+// Texts without a translation are returned in English
+func T(locale, text string, args ...interface{}) string {
+	if translation, ok := catalogs[locale][text]; ok && translation != "" {
+		text = translation
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// FormatDate formats t the way dates are written in locale
+func FormatDate(locale string, t time.Time) string {
+	layout, ok := dateLayouts[locale]
+	if !ok {
+		layout = dateLayouts[DefaultLocale]
+	}
+	return t.Format(layout)
+}
+
+// Match returns the supported locale preferred by an Accept-Language header, like
+// "pt-BR,pt;q=0.9,en;q=0.8", or the default locale when none of them is supported
+func Match(acceptLanguage string) string {
+	best, bestQ := DefaultLocale, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		// regional variants like pt-BR use the catalog of their language
+		base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if IsSupported(base) && q > bestQ {
+			best, bestQ = base, q
+		}
+	}
+	return best
+}
+
+// WithLocale returns a copy of ctx carrying locale, which FromContext returns
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, locale)
+}
+
+// FromContext returns the locale of the request ctx belongs to, or the default locale
+func FromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(ctxKey{}).(string); ok {
+		return locale
+	}
+	return DefaultLocale
+}
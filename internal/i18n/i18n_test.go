@@ -0,0 +1,232 @@
+package i18n
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSupported(t *testing.T) {
+	expected := []string{"en", "es", "pt"}
+	if got := Supported(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v but got %v", expected, got)
+	}
+
+	for _, locale := range []string{"", "de", "EN", "pt-BR"} {
+		if IsSupported(locale) {
+			t.Errorf("%q: expected it not to be supported", locale)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		expected       string
+	}{
+		{"", "en"},
+		{"pt-BR,pt;q=0.9,en;q=0.8", "pt"},
+		{"de-DE,de;q=0.9,es;q=0.5", "es"},
+		{"en;q=0.4, ES;q=0.7", "es"},
+		{"fr, de", "en"},
+		{"es;q=abc,pt;q=0.1", "pt"},
+		{"*", "en"},
+	}
+
+	for _, e := range tests {
+		if got := Match(e.acceptLanguage); got != e.expected {
+			t.Errorf("%q: expected %s but got %s", e.acceptLanguage, e.expected, got)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	tests := []struct {
+		locale   string
+		text     string
+		args     []interface{}
+		expected string
+	}{
+		{"en", "Rooms", nil, "Rooms"},
+		{"pt", "Rooms", nil, "Quartos"},
+		{"es", "Rooms", nil, "Habitaciones"},
+		{"de", "Rooms", nil, "Rooms"},
+		{"pt", "This field must be at least %d characters long", []interface{}{3}, "Este campo deve ter pelo menos 3 caracteres"},
+		{"en", "This field must be at least %d characters long", []interface{}{3}, "This field must be at least 3 characters long"},
+		{"pt", "Not in any catalog", nil, "Not in any catalog"},
+		// texts without arguments are not formatted
+		{"en", "100% sure", nil, "100% sure"},
+	}
+
+	for _, e := range tests {
+		if got := T(e.locale, e.text, e.args...); got != e.expected {
+			t.Errorf("%s %q: expected %q but got %q", e.locale, e.text, e.expected, got)
+		}
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	date := time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC)
+
+	tests := map[string]string{
+		"en": "Jan 3, 2050",
+		"pt": "03/01/2050",
+		"es": "03/01/2050",
+		"de": "Jan 3, 2050",
+	}
+
+	for locale, expected := range tests {
+		if got := FormatDate(locale, date); got != expected {
+			t.Errorf("%s: expected %s but got %s", locale, expected, got)
+		}
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != DefaultLocale {
+		t.Errorf("expected the default locale but got %s", got)
+	}
+	if got := FromContext(WithLocale(context.Background(), "pt")); got != "pt" {
+		t.Errorf("expected pt but got %s", got)
+	}
+}
+
+var (
+	templateText = regexp.MustCompile(`\{\{T "((?:[^"\\]|\\.)*)"`)
+	formatVerb   = regexp.MustCompile(`%[a-z]`)
+)
+
+// TestCatalogs checks every catalog translates the texts of the templates, keeping their arguments
+func TestCatalogs(t *testing.T) {
+	var files []string
+	for _, pattern := range []string{"../../templates/*.tmpl", "../../email-templates/*.tmpl"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		t.Fatal("expected templates but found none")
+	}
+
+	texts := map[string]string{}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range templateText.FindAllStringSubmatch(string(b), -1) {
+			text, err := strconv.Unquote(`"` + m[1] + `"`)
+			if err != nil {
+				t.Fatalf("%s: %s", file, err)
+			}
+			texts[text] = filepath.Base(file)
+		}
+	}
+
+	for locale, catalog := range catalogs {
+		for text, file := range texts {
+			if _, ok := catalog[text]; !ok {
+				t.Errorf("%s: no translation of %q of %s", locale, text, file)
+			}
+		}
+		for text, translation := range catalog {
+			if !reflect.DeepEqual(formatVerb.FindAllString(text, -1), formatVerb.FindAllString(translation, -1)) {
+				t.Errorf("%s: the translation of %q does not keep its arguments", locale, text)
+			}
+		}
+	}
+}
+
+// sessionMessages returns the texts the functions of a Go file put in the session as an error,
+// flash or warning message, given as a literal or as the text of a call to T. The functions of
+// the administration area, which is only in English, are left out
+func sessionMessages(t *testing.T, file string) map[string]string {
+	f, err := parser.ParseFile(token.NewFileSet(), file, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	texts := map[string]string{}
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || strings.Contains(strings.ToLower(fn.Name.Name), "admin") {
+			continue
+		}
+		ast.Inspect(fn, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) != 3 {
+				return true
+			}
+			if sel, ok := call.Fun.(*ast.SelectorExpr); !ok || sel.Sel.Name != "Put" {
+				return true
+			}
+			key, ok := call.Args[1].(*ast.BasicLit)
+			if !ok || (key.Value != `"error"` && key.Value != `"flash"` && key.Value != `"warning"`) {
+				return true
+			}
+
+			text := call.Args[2]
+			if c, ok := text.(*ast.CallExpr); ok && len(c.Args) >= 2 {
+				text = c.Args[1]
+			}
+			if lit, ok := text.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				s, err := strconv.Unquote(lit.Value)
+				if err != nil {
+					t.Fatalf("%s: %s", file, err)
+				}
+				texts[s] = filepath.Base(file) + " " + fn.Name.Name
+			}
+			return true
+		})
+	}
+	return texts
+}
+
+// TestCatalogs_SessionMessages checks every catalog translates the messages the handlers and
+// middlewares of the site put in the session
+func TestCatalogs_SessionMessages(t *testing.T) {
+	var files []string
+	for _, pattern := range []string{"../handlers/*.go", "../../cmd/web/*.go"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range matches {
+			if !strings.HasSuffix(file, "_test.go") {
+				files = append(files, file)
+			}
+		}
+	}
+	if len(files) == 0 {
+		t.Fatal("expected handlers but found none")
+	}
+
+	texts := map[string]string{}
+	for _, file := range files {
+		for text, where := range sessionMessages(t, file) {
+			texts[text] = where
+		}
+	}
+	if len(texts) == 0 {
+		t.Fatal("expected session messages but found none")
+	}
+
+	for locale, catalog := range catalogs {
+		for text, where := range texts {
+			if _, ok := catalog[text]; !ok {
+				t.Errorf("%s: no translation of %q of %s", locale, text, where)
+			}
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrNotCalendar is returned when parsing something which is not an iCalendar file
+var ErrNotCalendar = errors.New("not an iCalendar file")
+
+// dateLayout is the layout of the DATE values, which all-day events use
+const dateLayout = "20060102"
+
+// maxLineLength is the length in octets after which lines are folded
+const maxLineLength = 75
+
+// Event is an all-day event, from the day of Start to the day before End
+type Event struct {
+	UID     string
+	Summary string
+	Status  string
+	Start   time.Time
+	End     time.Time
+	Stamp   time.Time // when the event was last changed, now when zero
+}
+
+// Calendar is what Write puts in an iCalendar file
+type Calendar struct {
+	ProdID string
+	Name   string
+	Events []Event
+}
+
+// Write writes cal as an iCalendar file
+func Write(w io.Writer, cal Calendar) error {
+	bw := bufio.NewWriter(w)
+
+	writeLine(bw, "BEGIN:VCALENDAR")
+	writeLine(bw, "VERSION:2.0")
+	writeLine(bw, "PRODID:"+escapeText(cal.ProdID))
+	writeLine(bw, "CALSCALE:GREGORIAN")
+	writeLine(bw, "METHOD:PUBLISH")
+	if cal.Name != "" {
+		writeLine(bw, "X-WR-CALNAME:"+escapeText(cal.Name))
+	}
+
+	for _, e := range cal.Events {
+		stamp := e.Stamp
+		if stamp.IsZero() {
+			stamp = time.Now()
+		}
+
+		writeLine(bw, "BEGIN:VEVENT")
+		writeLine(bw, "UID:"+escapeText(e.UID))
+		writeLine(bw, "DTSTAMP:"+stamp.UTC().Format("20060102T150405Z"))
+		writeLine(bw, "DTSTART;VALUE=DATE:"+e.Start.Format(dateLayout))
+		writeLine(bw, "DTEND;VALUE=DATE:"+e.End.Format(dateLayout))
+		if e.Summary != "" {
+			writeLine(bw, "SUMMARY:"+escapeText(e.Summary))
+		}
+		if e.Status != "" {
+			writeLine(bw, "STATUS:"+e.Status)
+		}
+		writeLine(bw, "TRANSP:OPAQUE")
+		writeLine(bw, "END:VEVENT")
+	}
+
+	writeLine(bw, "END:VCALENDAR")
+	return bw.Flush()
+}
+
+// writeLine writes a content line ended by CRLF, folded to lines of at most 75 octets
+// without cutting a character in two
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// the space starting a continuation line counts in its length
+		limit = maxLineLength - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+// escapeText escapes a TEXT value
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// unescapeText reverses escapeText
+func unescapeText(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(s)
+}
+
+// Parse reads the events of an iCalendar file. Dates with a time keep only their day, as
+// stays take whole nights. Cancelled events are left out, and recurring events only
+// count for their first occurrence
+func Parse(r io.Reader) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var event *Event
+	var recurrenceID string
+	inCalendar := false
+	// components nested in an event, like alarms, have properties of their own
+	depth := 0
+
+	for i, line := range lines {
+		name, value, ok := splitLine(line)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VCALENDAR"):
+			inCalendar = true
+		case !inCalendar:
+			return nil, ErrNotCalendar
+		case name == "BEGIN" && event == nil && strings.EqualFold(value, "VEVENT"):
+			event = &Event{}
+			recurrenceID = ""
+		case name == "BEGIN" && event != nil:
+			depth++
+		case name == "END" && event != nil && depth > 0:
+			depth--
+		case name == "END" && event != nil:
+			if err := finishEvent(event, recurrenceID); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			if !strings.EqualFold(event.Status, "CANCELLED") {
+				events = append(events, *event)
+			}
+			event = nil
+		case event == nil || depth > 0:
+		case name == "UID":
+			event.UID = value
+		case name == "SUMMARY":
+			event.Summary = unescapeText(value)
+		case name == "STATUS":
+			event.Status = strings.ToUpper(value)
+		case name == "RECURRENCE-ID":
+			recurrenceID = value
+		case name == "DTSTART" || name == "DTEND":
+			day, err := parseDate(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			if name == "DTSTART" {
+				event.Start = day
+			} else {
+				event.End = day
+			}
+		}
+	}
+
+	if !inCalendar {
+		return nil, ErrNotCalendar
+	}
+
+	return events, nil
+}
+
+// finishEvent checks the dates of an event once all its properties are read. An event
+// without an end takes one day, and one without an id gets an id made of its dates
+func finishEvent(e *Event, recurrenceID string) error {
+	if e.Start.IsZero() {
+		return errors.New("event without a start date")
+	}
+	if !e.End.After(e.Start) {
+		e.End = e.Start.AddDate(0, 0, 1)
+	}
+
+	if e.UID == "" {
+		e.UID = fmt.Sprintf("%s-%s", e.Start.Format(dateLayout), e.End.Format(dateLayout))
+	}
+	if recurrenceID != "" {
+		// an occurrence changed apart from its recurring event shares its id
+		e.UID += "/" + recurrenceID
+	}
+	return nil
+}
+
+// unfold reads the content lines of r, joining the lines folded over several ones
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) == 0 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+// splitLine splits a content line like DTSTART;VALUE=DATE:20240101 into its name and its
+// value, leaving out the parameters
+func splitLine(line string) (string, string, bool) {
+	// the value starts after the first colon which is not quoted in a parameter
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", "", false
+	}
+
+	name, _, _ := strings.Cut(line[:colon], ";")
+	return strings.ToUpper(name), line[colon+1:], true
+}
+
+// parseDate parses a DATE or a DATE-TIME value into the day it falls on, in the time
+// zone it is written in
+func parseDate(value string) (time.Time, error) {
+	if len(value) > len(dateLayout) {
+		if _, err := time.Parse("20060102T150405", strings.TrimSuffix(value, "Z")); err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q", value)
+		}
+		value = value[:len(dateLayout)]
+	}
+
+	day, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	return day, nil
+}
@@ -0,0 +1,159 @@
+package ical
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	d, _ := time.Parse("2006-01-02", s)
+	return d
+}
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	err := Write(&buf, Calendar{
+		ProdID: "-//Test//EN",
+		Name:   "General's Quarters",
+		Events: []Event{
+			{
+				UID:     "restriction-1@example.com",
+				Summary: "Blocked; closed, for works",
+				Start:   date("2050-01-03"),
+				End:     date("2050-01-05"),
+				Stamp:   time.Date(2050, 1, 1, 10, 0, 0, 0, time.UTC),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, expected := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"UID:restriction-1@example.com\r\n",
+		"DTSTAMP:20500101T100000Z\r\n",
+		"DTSTART;VALUE=DATE:20500103\r\n",
+		"DTEND;VALUE=DATE:20500105\r\n",
+		`SUMMARY:Blocked\; closed\, for works` + "\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in\n%s", expected, out)
+		}
+	}
+}
+
+func TestWrite_Folding(t *testing.T) {
+	var buf bytes.Buffer
+	name := strings.Repeat("é", 100)
+	if err := Write(&buf, Calendar{Name: name}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > maxLineLength {
+			t.Errorf("expected lines of at most %d octets but got %d", maxLineLength, len(line))
+		}
+	}
+
+	// writing and parsing again gives the same event
+	buf.Reset()
+	summary := strings.Repeat("Closed for works, ", 10)
+	err := Write(&buf, Calendar{Events: []Event{{UID: "1", Summary: summary, Start: date("2050-01-03"), End: date("2050-01-04")}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Summary != summary {
+		t.Errorf("expected the summary back but got %+v", events)
+	}
+}
+
+const feed = "\ufeffBEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Other site//EN\r\n" +
+	"BEGIN:VTIMEZONE\r\n" +
+	"TZID:Europe/Paris\r\n" +
+	"BEGIN:STANDARD\r\n" +
+	"DTSTART:19701025T030000\r\n" +
+	"END:STANDARD\r\n" +
+	"END:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:all-day@other\r\n" +
+	"DTSTART;VALUE=DATE:20500103\r\n" +
+	"DTEND;VALUE=DATE:20500106\r\n" +
+	"SUMMARY:Reserved\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"TRIGGER:-PT15M\r\n" +
+	"DTSTART:20000101T000000\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:with-time\r\n" +
+	" @other\r\n" +
+	"DTSTART;TZID=\"Europe/Paris\":20500110T150000\r\n" +
+	"DTEND;TZID=Europe/Paris:20500112T110000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART:20500120T120000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:cancelled@other\r\n" +
+	"DTSTART;VALUE=DATE:20500201\r\n" +
+	"DTEND;VALUE=DATE:20500202\r\n" +
+	"STATUS:CANCELLED\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse(t *testing.T) {
+	events, err := Parse(strings.NewReader(feed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Event{
+		{UID: "all-day@other", Summary: "Reserved", Start: date("2050-01-03"), End: date("2050-01-06")},
+		{UID: "with-time@other", Start: date("2050-01-10"), End: date("2050-01-12")},
+		{UID: "20500120-20500121", Start: date("2050-01-20"), End: date("2050-01-21")},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events but got %d: %+v", len(expected), len(events), events)
+	}
+	for i, e := range expected {
+		if events[i] != e {
+			t.Errorf("expected %+v but got %+v", e, events[i])
+		}
+	}
+}
+
+var parseErrorTests = []struct {
+	name          string
+	input         string
+	expectedError error
+}{
+	{"empty", "", ErrNotCalendar},
+	{"html", "<html><body>Not found</body></html>", ErrNotCalendar},
+	{"no-start", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:1\nEND:VEVENT\nEND:VCALENDAR\n", nil},
+	{"invalid-date", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:2050-01-03\nEND:VEVENT\nEND:VCALENDAR\n", nil},
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, e := range parseErrorTests {
+		_, err := Parse(strings.NewReader(e.input))
+		if err == nil {
+			t.Errorf("%s: expected an error but got none", e.name)
+			continue
+		}
+		if e.expectedError != nil && !errors.Is(err, e.expectedError) {
+			t.Errorf("%s: expected error %v but got %v", e.name, e.expectedError, err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/models"
+)
+
+// Store is the part of the repository the queue sends mail from
+type Store interface {
+	ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMail, error)
+	MarkMailSent(ctx context.Context, id int) error
+	MarkMailFailed(ctx context.Context, id int, lastError string, nextAttemptAt time.Time, dead bool) error
+}
+
+// SendFunc delivers one mail
+type SendFunc func(models.MailData) error
+
+// Queue sends the mail of the outbox with a pool of workers, retrying failed
+// mails with an exponential backoff until MaxAttempts, when they are marked as dead
+type Queue struct {
+	Workers      int
+	MaxAttempts  int
+	PollInterval time.Duration
+	Lease        time.Duration
+	Logger       *slog.Logger
+
+	store Store
+	send  SendFunc
+	wake  chan struct{}
+
+	running int32
+}
+
+// New returns a queue with the default settings
+func New(store Store, send SendFunc) *Queue {
+	return &Queue{
+		Workers:      4,
+		MaxAttempts:  8,
+		PollInterval: 10 * time.Second,
+		Lease:        5 * time.Minute,
+		Logger:       slog.Default(),
+		store:        store,
+		send:         send,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Backoff returns how long to wait before the next attempt after the given failed attempt:
+// one minute after the first, doubling after each one, up to an hour
+func Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt > 7 {
+		return time.Hour
+	}
+	return time.Minute << (attempt - 1)
+}
+
+// Notify wakes the queue up to send new mail without waiting for the next poll
+func (q *Queue) Notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Running tells if Run is sending the mail of the outbox
+func (q *Queue) Running() bool {
+	return atomic.LoadInt32(&q.running) == 1
+}
+
+// Run sends mail from the outbox until ctx is done, then waits for the mails being sent
+func (q *Queue) Run(ctx context.Context) {
+	atomic.StoreInt32(&q.running, 1)
+	defer atomic.StoreInt32(&q.running, 0)
+
+	jobs := make(chan models.OutboxMail)
+
+	var wg sync.WaitGroup
+	for i := 0; i < q.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for mail := range jobs {
+				q.deliver(mail)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(q.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		q.dispatch(ctx, jobs)
+
+		select {
+		case <-ctx.Done():
+			close(jobs)
+			wg.Wait()
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// dispatch hands the mails due for sending to the workers
+func (q *Queue) dispatch(ctx context.Context, jobs chan<- models.OutboxMail) {
+	for {
+		mails, err := q.store.ClaimMail(ctx, q.Workers, q.Lease)
+		if err != nil {
+			if ctx.Err() == nil {
+				q.Logger.Error("can't claim mail", "error", err)
+			}
+			return
+		}
+
+		for _, mail := range mails {
+			select {
+			case jobs <- mail:
+			case <-ctx.Done():
+				// the mails not handed over are claimed again once their lease is over
+				return
+			}
+		}
+
+		if len(mails) < q.Workers {
+			return
+		}
+	}
+}
+
+// deliver sends one mail and records the outcome, which is not cancelled
+// with the queue so that a mail sent during shutdown is not sent twice
+func (q *Queue) deliver(mail models.OutboxMail) {
+	ctx := context.Background()
+
+	err := q.send(mail.Mail)
+	if err == nil {
+		q.Logger.Info("mail sent", "mail_id", mail.ID, "to", mail.Mail.To)
+		if err := q.store.MarkMailSent(ctx, mail.ID); err != nil {
+			q.Logger.Error("mail was sent but can't be marked as sent", "mail_id", mail.ID, "error", err)
+		}
+		return
+	}
+
+	dead := mail.Attempts >= q.MaxAttempts
+	if dead {
+		q.Logger.Error("giving up on mail", "mail_id", mail.ID, "to", mail.Mail.To, "attempts", mail.Attempts, "error", err)
+	} else {
+		q.Logger.Warn("mail failed", "mail_id", mail.ID, "to", mail.Mail.To, "attempt", mail.Attempts, "error", err)
+	}
+
+	err = q.store.MarkMailFailed(ctx, mail.ID, err.Error(), time.Now().Add(Backoff(mail.Attempts)), dead)
+	if err != nil {
+		q.Logger.Error("can't record the failure of mail", "mail_id", mail.ID, "error", err)
+	}
+}
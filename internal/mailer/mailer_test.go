@@ -0,0 +1,147 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/models"
+)
+
+// memoryStore is an outbox kept in memory
+type memoryStore struct {
+	sync.Mutex
+	mails map[int]*models.OutboxMail
+	done  chan struct{}
+}
+
+func newMemoryStore(mails ...models.OutboxMail) *memoryStore {
+	s := &memoryStore{
+		mails: make(map[int]*models.OutboxMail),
+		done:  make(chan struct{}, len(mails)),
+	}
+	for i := range mails {
+		s.mails[mails[i].ID] = &mails[i]
+	}
+	return s
+}
+
+func (s *memoryStore) ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMail, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var claimed []models.OutboxMail
+	for _, m := range s.mails {
+		if len(claimed) == limit {
+			break
+		}
+		if m.Status == models.MailPending && !m.NextAttemptAt.After(time.Now()) {
+			m.Status = models.MailSending
+			m.Attempts++
+			claimed = append(claimed, *m)
+		}
+	}
+	return claimed, nil
+}
+
+func (s *memoryStore) MarkMailSent(ctx context.Context, id int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.mails[id].Status = models.MailSent
+	s.done <- struct{}{}
+	return nil
+}
+
+func (s *memoryStore) MarkMailFailed(ctx context.Context, id int, lastError string, nextAttemptAt time.Time, dead bool) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m := s.mails[id]
+	m.LastError = lastError
+	m.NextAttemptAt = nextAttemptAt
+	m.Status = models.MailPending
+	if dead {
+		m.Status = models.MailDead
+	}
+	s.done <- struct{}{}
+	return nil
+}
+
+func TestBackoff(t *testing.T) {
+	tests := map[int]time.Duration{
+		0:  time.Minute,
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		4:  8 * time.Minute,
+		7:  64 * time.Minute,
+		8:  time.Hour,
+		30: time.Hour,
+	}
+
+	for attempt, want := range tests {
+		if got := Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+func TestQueue_Run(t *testing.T) {
+	store := newMemoryStore(
+		models.OutboxMail{ID: 1, Status: models.MailPending, Mail: models.MailData{To: "ok@here.com"}},
+		models.OutboxMail{ID: 2, Status: models.MailPending, Mail: models.MailData{To: "fail@here.com"}},
+		models.OutboxMail{ID: 3, Status: models.MailPending, Attempts: 7, Mail: models.MailData{To: "fail@here.com"}},
+	)
+
+	q := New(store, func(m models.MailData) error {
+		if m.To == "fail@here.com" {
+			return errors.New("mailbox unavailable")
+		}
+		return nil
+	})
+	q.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(finished)
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-store.done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the queue")
+		}
+	}
+	if !q.Running() {
+		t.Error("expected the queue to be running")
+	}
+	cancel()
+	<-finished
+
+	if q.Running() {
+		t.Error("expected the queue to be stopped")
+	}
+
+	if s := store.mails[1].Status; s != models.MailSent {
+		t.Errorf("expected mail 1 to be sent but it is %s", s)
+	}
+
+	retried := store.mails[2]
+	if retried.Status != models.MailPending || retried.LastError != "mailbox unavailable" {
+		t.Errorf("expected mail 2 to be retried but it is %s with error %q", retried.Status, retried.LastError)
+	}
+	if !retried.NextAttemptAt.After(time.Now()) {
+		t.Error("expected mail 2 to be retried later")
+	}
+
+	if s := store.mails[3].Status; s != models.MailDead {
+		t.Errorf("expected mail 3 to be dead after its last attempt but it is %s", s)
+	}
+}
@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counter counts events since the app started
+type Counter struct {
+	name  string
+	help  string
+	value uint64
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+// Value returns the count
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+var (
+	ReservationsCreated  = &Counter{name: "reservations_created_total", help: "Reservations booked by guests, on the site or the API."}
+	AvailabilitySearches = &Counter{name: "availability_searches_total", help: "Searches for free rooms."}
+	MailSent             = &Counter{name: "mail_sent_total", help: "Mails accepted by the SMTP server."}
+	MailFailed           = &Counter{name: "mail_failed_total", help: "Attempts to send a mail which failed."}
+
+	counters = []*Counter{ReservationsCreated, AvailabilitySearches, MailSent, MailFailed}
+)
+
+// durationBuckets are the upper bounds of the request duration histogram, in seconds
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type routeKey struct {
+	method string
+	route  string
+}
+
+// routeStats are the requests served by one route
+type routeStats struct {
+	statuses map[int]uint64
+	buckets  []uint64 // count of the durations up to each of durationBuckets
+	count    uint64
+	sum      float64
+}
+
+var (
+	mu     sync.Mutex
+	routes = make(map[routeKey]*routeStats)
+)
+
+// ObserveRequest records a served request under the pattern of its route,
+// like /rooms/{slug}, so that the number of series stays bounded
+func ObserveRequest(method, route string, status int, d time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	key := routeKey{method, route}
+	stats, ok := routes[key]
+	if !ok {
+		stats = &routeStats{
+			statuses: make(map[int]uint64),
+			buckets:  make([]uint64, len(durationBuckets)),
+		}
+		routes[key] = stats
+	}
+
+	seconds := d.Seconds()
+	stats.statuses[status]++
+	stats.count++
+	stats.sum += seconds
+	for i, le := range durationBuckets {
+		if seconds <= le {
+			stats.buckets[i]++
+		}
+	}
+}
+
+// Sample is one value of a metric, with its labels given as name, value pairs
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// WriteMetric writes a metric of the given kind, counter or gauge, in the Prometheus text format
+func WriteMetric(w io.Writer, name, kind, help string, samples ...Sample) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", name, labels(s.Labels...), formatValue(s.Value))
+	}
+}
+
+// Write writes the counters and the request metrics in the Prometheus text format
+func Write(w io.Writer) {
+	for _, c := range counters {
+		WriteMetric(w, c.name, "counter", c.help, Sample{Value: float64(c.Value())})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	keys := make([]routeKey, 0, len(routes))
+	for key := range routes {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].method < keys[j].method
+	})
+
+	var requests []Sample
+	for _, key := range keys {
+		stats := routes[key]
+		statuses := make([]int, 0, len(stats.statuses))
+		for status := range stats.statuses {
+			statuses = append(statuses, status)
+		}
+		sort.Ints(statuses)
+		for _, status := range statuses {
+			requests = append(requests, Sample{
+				Labels: []string{"method", key.method, "route", key.route, "status", strconv.Itoa(status)},
+				Value:  float64(stats.statuses[status]),
+			})
+		}
+	}
+	WriteMetric(w, "http_requests_total", "counter", "Requests served, by route and status.", requests...)
+
+	fmt.Fprint(w, "# HELP http_request_duration_seconds Time taken to serve requests, by route.\n")
+	fmt.Fprint(w, "# TYPE http_request_duration_seconds histogram\n")
+	for _, key := range keys {
+		stats := routes[key]
+		for i, le := range durationBuckets {
+			fmt.Fprintf(w, "http_request_duration_seconds_bucket%s %d\n",
+				labels("method", key.method, "route", key.route, "le", formatValue(le)), stats.buckets[i])
+		}
+		fmt.Fprintf(w, "http_request_duration_seconds_bucket%s %d\n",
+			labels("method", key.method, "route", key.route, "le", "+Inf"), stats.count)
+		fmt.Fprintf(w, "http_request_duration_seconds_sum%s %s\n",
+			labels("method", key.method, "route", key.route), formatValue(stats.sum))
+		fmt.Fprintf(w, "http_request_duration_seconds_count%s %d\n",
+			labels("method", key.method, "route", key.route), stats.count)
+	}
+}
+
+// labels formats name, value pairs as {name="value",...}
+func labels(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", pairs[i], pairs[i+1])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
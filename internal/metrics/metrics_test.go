@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	MailSent.Inc()
+	MailSent.Inc()
+	ObserveRequest("GET", "/rooms/{slug}", 200, 20*time.Millisecond)
+	ObserveRequest("GET", "/rooms/{slug}", 200, 2*time.Second)
+	ObserveRequest("GET", "/rooms/{slug}", 404, time.Millisecond)
+
+	var b strings.Builder
+	Write(&b)
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE mail_sent_total counter\nmail_sent_total 2\n",
+		`http_requests_total{method="GET",route="/rooms/{slug}",status="200"} 2`,
+		`http_requests_total{method="GET",route="/rooms/{slug}",status="404"} 1`,
+		`http_request_duration_seconds_bucket{method="GET",route="/rooms/{slug}",le="0.005"} 1`,
+		`http_request_duration_seconds_bucket{method="GET",route="/rooms/{slug}",le="0.025"} 2`,
+		`http_request_duration_seconds_bucket{method="GET",route="/rooms/{slug}",le="2.5"} 3`,
+		`http_request_duration_seconds_bucket{method="GET",route="/rooms/{slug}",le="+Inf"} 3`,
+		`http_request_duration_seconds_count{method="GET",route="/rooms/{slug}"} 3`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteMetric(t *testing.T) {
+	var b strings.Builder
+	WriteMetric(&b, "db_connections", "gauge", "Connections.",
+		Sample{Labels: []string{"state", "idle"}, Value: 2},
+		Sample{Labels: []string{"state", "in_use"}, Value: 0.5})
+
+	want := "# HELP db_connections Connections.\n# TYPE db_connections gauge\n" +
+		"db_connections{state=\"idle\"} 2\ndb_connections{state=\"in_use\"} 0.5\n"
+	if b.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, b.String())
+	}
+}
@@ -0,0 +1,89 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatal("expected embedded migrations but found none")
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("expected migration version %d but got %d", i+1, m.Version)
+		}
+	}
+}
+
+var loadTests = []struct {
+	name          string
+	files         fstest.MapFS
+	expectedError bool
+	expectedOrder []int
+}{
+	{
+		name: "sorted-by-version",
+		files: fstest.MapFS{
+			"sql/0002_second.up.sql":   {Data: []byte("select 2")},
+			"sql/0002_second.down.sql": {Data: []byte("select -2")},
+			"sql/0001_first.up.sql":    {Data: []byte("select 1")},
+			"sql/0001_first.down.sql":  {Data: []byte("select -1")},
+		},
+		expectedOrder: []int{1, 2},
+	},
+	{
+		name: "missing-down",
+		files: fstest.MapFS{
+			"sql/0001_first.up.sql": {Data: []byte("select 1")},
+		},
+		expectedError: true,
+	},
+	{
+		name: "invalid-name",
+		files: fstest.MapFS{
+			"sql/first.sql": {Data: []byte("select 1")},
+		},
+		expectedError: true,
+	},
+	{
+		name: "different-names",
+		files: fstest.MapFS{
+			"sql/0001_first.up.sql":   {Data: []byte("select 1")},
+			"sql/0001_other.down.sql": {Data: []byte("select -1")},
+		},
+		expectedError: true,
+	},
+}
+
+func TestLoadFiles(t *testing.T) {
+	for _, e := range loadTests {
+		migrations, err := load(e.files, "sql")
+		if e.expectedError {
+			if err == nil {
+				t.Errorf("%s: expected error but got none", e.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", e.name, err)
+			continue
+		}
+
+		if len(migrations) != len(e.expectedOrder) {
+			t.Errorf("%s: expected %d migrations but got %d", e.name, len(e.expectedOrder), len(migrations))
+			continue
+		}
+		for i, v := range e.expectedOrder {
+			if migrations[i].Version != v {
+				t.Errorf("%s: expected version %d at %d but got %d", e.name, v, i, migrations[i].Version)
+			}
+		}
+	}
+}
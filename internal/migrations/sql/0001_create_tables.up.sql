@@ -0,0 +1,58 @@
+-- Tables used to be created by GORM AutoMigrate, so "if not exists" lets
+-- databases created that way adopt the versioned migrations as they are.
+
+create table if not exists users (
+    id bigserial primary key,
+    created_at timestamptz not null default now(),
+    updated_at timestamptz not null default now(),
+    deleted_at timestamptz,
+    name text not null default '',
+    first_name text not null default '',
+    last_name text not null default '',
+    email text not null,
+    password text not null,
+    access_level bigint not null default 0
+);
+
+create table if not exists rooms (
+    id bigserial primary key,
+    created_at timestamptz not null default now(),
+    updated_at timestamptz not null default now(),
+    deleted_at timestamptz,
+    room_name text not null
+);
+
+create table if not exists restrictions (
+    id bigserial primary key,
+    created_at timestamptz not null default now(),
+    updated_at timestamptz not null default now(),
+    deleted_at timestamptz,
+    restriction_name text not null
+);
+
+create table if not exists reservations (
+    id bigserial primary key,
+    created_at timestamptz not null default now(),
+    updated_at timestamptz not null default now(),
+    deleted_at timestamptz,
+    first_name text not null default '',
+    last_name text not null default '',
+    email text not null default '',
+    phone text not null default '',
+    start_date timestamptz not null,
+    end_date timestamptz not null,
+    room_id bigint not null references rooms (id),
+    processed bigint not null default 0
+);
+
+create table if not exists room_restrictions (
+    id bigserial primary key,
+    created_at timestamptz not null default now(),
+    updated_at timestamptz not null default now(),
+    deleted_at timestamptz,
+    start_date timestamptz not null,
+    end_date timestamptz not null,
+    room_id bigint not null references rooms (id),
+    reservation_id bigint references reservations (id),
+    restriction_id bigint not null references restrictions (id)
+);
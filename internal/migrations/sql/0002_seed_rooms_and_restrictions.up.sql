@@ -0,0 +1,12 @@
+-- restriction ids are referenced from the code: 1 is a reservation, 2 an owner block
+insert into restrictions (id, restriction_name)
+values (1, 'Reservation'), (2, 'Owner Block')
+on conflict (id) do nothing;
+
+select setval(pg_get_serial_sequence('restrictions', 'id'), (select max(id) from restrictions));
+
+insert into rooms (id, room_name)
+values (1, 'General''s Quarters'), (2, 'Major''s Suite')
+on conflict (id) do nothing;
+
+select setval(pg_get_serial_sequence('rooms', 'id'), (select max(id) from rooms));
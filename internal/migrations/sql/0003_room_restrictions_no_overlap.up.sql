@@ -0,0 +1,12 @@
+-- a room can never hold two overlapping restrictions, whoever inserts them
+create extension if not exists btree_gist;
+
+do $$
+begin
+    if not exists (select 1 from pg_constraint where conname = 'room_restrictions_no_overlap') then
+        alter table room_restrictions add constraint room_restrictions_no_overlap
+        exclude using gist (room_id with =, tstzrange(start_date, end_date) with &&)
+        where (deleted_at is null);
+    end if;
+end
+$$;
@@ -0,0 +1,4 @@
+drop index if exists room_restrictions_reservation_id_idx;
+drop index if exists reservations_processed_idx;
+drop index if exists reservations_email_idx;
+drop index if exists users_email_idx;
@@ -0,0 +1,4 @@
+create unique index if not exists users_email_idx on users (email);
+create index if not exists reservations_email_idx on reservations (email);
+create index if not exists reservations_processed_idx on reservations (processed);
+create index if not exists room_restrictions_reservation_id_idx on room_restrictions (reservation_id);
@@ -0,0 +1,9 @@
+drop table if exists room_photos;
+
+drop index if exists rooms_slug_idx;
+
+alter table rooms
+    drop column if exists nightly_price,
+    drop column if exists capacity,
+    drop column if exists description,
+    drop column if exists slug;
@@ -0,0 +1,40 @@
+alter table rooms
+    add column if not exists slug text,
+    add column if not exists description text not null default '',
+    add column if not exists capacity integer not null default 2,
+    add column if not exists nightly_price bigint not null default 0;
+
+update rooms set slug = 'room-' || id where slug is null;
+
+update rooms set
+    slug = 'generals-quarters',
+    capacity = 2,
+    nightly_price = 12000,
+    description = 'Your home away from home, set on the majestic waters of the Atlantic Ocean, this will be a vacation to remember.'
+where id = 1 and room_name = 'General''s Quarters';
+
+update rooms set
+    slug = 'majors-suite',
+    capacity = 3,
+    nightly_price = 15000,
+    description = 'Your home away from home, set on the majestic waters of the Atlantic Ocean, this will be a vacation to remember.'
+where id = 2 and room_name = 'Major''s Suite';
+
+alter table rooms alter column slug set not null;
+
+create unique index if not exists rooms_slug_idx on rooms (slug);
+
+create table if not exists room_photos (
+    id bigserial primary key,
+    room_id bigint not null references rooms (id) on delete cascade,
+    path text not null,
+    position integer not null default 0
+);
+
+create index if not exists room_photos_room_id_idx on room_photos (room_id, position);
+
+insert into room_photos (room_id, path)
+select id, '/static/images/generals-quarters.png' from rooms where slug = 'generals-quarters';
+
+insert into room_photos (room_id, path)
+select id, '/static/images/marjors-suite.png' from rooms where slug = 'majors-suite';
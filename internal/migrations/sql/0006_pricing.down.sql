@@ -0,0 +1,8 @@
+alter table reservations
+    drop column if exists total_price;
+
+drop table if exists room_seasons;
+
+alter table rooms
+    drop column if exists min_nights,
+    drop column if exists weekend_price;
@@ -0,0 +1,22 @@
+alter table rooms
+    add column if not exists weekend_price bigint not null default 0,
+    add column if not exists min_nights integer not null default 1;
+
+create table if not exists room_seasons (
+    id bigserial primary key,
+    room_id bigint not null references rooms (id) on delete cascade,
+    name text not null,
+    start_date date not null,
+    end_date date not null,
+    nightly_price bigint not null,
+    weekend_price bigint not null default 0,
+    min_nights integer not null default 0,
+    created_at timestamptz not null default now(),
+    updated_at timestamptz not null default now(),
+    check (end_date >= start_date)
+);
+
+create index if not exists room_seasons_room_id_idx on room_seasons (room_id, start_date);
+
+alter table reservations
+    add column if not exists total_price bigint not null default 0;
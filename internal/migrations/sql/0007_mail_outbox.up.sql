@@ -0,0 +1,17 @@
+create table if not exists mail_outbox (
+    id bigserial primary key,
+    from_address text not null,
+    to_address text not null,
+    subject text not null,
+    content text not null,
+    template text not null default '',
+    status text not null default 'pending' check (status in ('pending', 'sending', 'sent', 'dead')),
+    attempts integer not null default 0,
+    next_attempt_at timestamptz not null default now(),
+    last_error text not null default '',
+    sent_at timestamptz,
+    created_at timestamptz not null default now(),
+    updated_at timestamptz not null default now()
+);
+
+create index if not exists mail_outbox_status_next_attempt_at_idx on mail_outbox (status, next_attempt_at);
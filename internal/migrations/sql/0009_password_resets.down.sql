@@ -0,0 +1,3 @@
+drop table if exists password_resets;
+
+alter table users drop column if exists session_version;
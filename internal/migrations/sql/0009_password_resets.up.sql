@@ -0,0 +1,13 @@
+-- bumped to sign the user out everywhere, when the password is reset for example
+alter table users add column if not exists session_version integer not null default 0;
+
+create table if not exists password_resets (
+    id bigserial primary key,
+    user_id bigint not null references users (id) on delete cascade,
+    token_hash bytea not null unique,
+    expires_at timestamptz not null,
+    used_at timestamptz,
+    created_at timestamptz not null default now()
+);
+
+create index if not exists password_resets_user_id_idx on password_resets (user_id);
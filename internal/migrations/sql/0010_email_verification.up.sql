@@ -0,0 +1,5 @@
+-- null until the user opens the link mailed at sign up
+alter table users add column if not exists verified_at timestamptz;
+
+-- staff accounts are made by the owners, the guests who signed up before have to verify
+update users set verified_at = created_at where access_level > 0 and verified_at is null;
@@ -0,0 +1,3 @@
+alter table reservations drop column if exists cancelled_at;
+alter table reservations drop column if exists access_token_hash;
+alter table reservations drop column if exists confirmation_code;
@@ -0,0 +1,5 @@
+-- what guests without an account use to find their reservation again, the link
+-- mailed to them carries a token of which only the hash is kept
+alter table reservations add column if not exists confirmation_code text unique;
+alter table reservations add column if not exists access_token_hash bytea unique;
+alter table reservations add column if not exists cancelled_at timestamptz;
@@ -0,0 +1,2 @@
+drop table if exists auth_lockouts;
+drop table if exists auth_events;
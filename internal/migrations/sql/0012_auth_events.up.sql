@@ -0,0 +1,26 @@
+-- audit log of sign ins, sign outs and lockouts
+create table if not exists auth_events (
+    id bigserial primary key,
+    created_at timestamptz not null default now(),
+    event text not null,
+    email text not null default '',
+    user_id bigint references users (id) on delete set null,
+    ip text not null default '',
+    detail text not null default ''
+);
+
+create index if not exists auth_events_created_at_idx on auth_events (created_at);
+create index if not exists auth_events_email_idx on auth_events (email, event, created_at);
+create index if not exists auth_events_ip_idx on auth_events (ip, event, created_at);
+
+create table if not exists auth_lockouts (
+    id bigserial primary key,
+    created_at timestamptz not null default now(),
+    kind text not null check (kind in ('email', 'ip')),
+    key text not null,
+    locked_until timestamptz not null,
+    lifted_at timestamptz,
+    lifted_by bigint references users (id) on delete set null
+);
+
+create index if not exists auth_lockouts_key_idx on auth_lockouts (kind, key, locked_until);
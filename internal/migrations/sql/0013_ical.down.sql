@@ -0,0 +1,5 @@
+drop index if exists room_restrictions_external_idx;
+alter table room_restrictions drop column if exists external_uid;
+alter table room_restrictions drop column if exists external_source;
+alter table rooms drop column if exists ical_import_url;
+alter table rooms drop column if exists ical_token;
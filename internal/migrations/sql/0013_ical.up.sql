@@ -0,0 +1,12 @@
+-- the secret token in the url of the calendar feed of each room, kept as is so that
+-- the owner can copy the url again, and the url of the calendar imported as blocks
+alter table rooms add column if not exists ical_token text unique;
+alter table rooms add column if not exists ical_import_url text not null default '';
+
+-- blocks imported from another calendar keep the event they come from, so that
+-- importing the calendar again moves or removes them
+alter table room_restrictions add column if not exists external_source text;
+alter table room_restrictions add column if not exists external_uid text;
+
+create unique index if not exists room_restrictions_external_idx
+    on room_restrictions (room_id, external_source, external_uid);
@@ -0,0 +1 @@
+alter table mail_outbox drop column if exists text_content;
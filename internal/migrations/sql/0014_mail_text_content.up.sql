@@ -0,0 +1,2 @@
+-- the plain text version of the mail, sent along with its html
+alter table mail_outbox add column if not exists text_content text not null default '';
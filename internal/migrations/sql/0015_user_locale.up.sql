@@ -0,0 +1,2 @@
+-- the language the user reads the site and the mails in, the default one when empty
+alter table users add column if not exists locale text not null default '';
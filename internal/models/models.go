@@ -2,54 +2,145 @@ package models
 
 import (
 	"time"
+)
 
-	"gorm.io/gorm"
+// Access levels a user can have, stored in User.AccessLevel
+const (
+	AccessLevelGuest = 0
+	AccessLevelStaff = 1
+	AccessLevelOwner = 2
 )
 
+// RoleName returns the name of the role for an access level
+func RoleName(accessLevel int) string {
+	switch {
+	case accessLevel >= AccessLevelOwner:
+		return "owner"
+	case accessLevel == AccessLevelStaff:
+		return "staff"
+	default:
+		return "guest"
+	}
+}
+
 type User struct {
-	gorm.Model
+	ID          int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
 	Name        string
 	FirstName   string
 	LastName    string
 	Email       string
 	Password    string
 	AccessLevel int
+	// SessionVersion changes to sign the user out of every session
+	SessionVersion int
+	// VerifiedAt is when the user proved to own the email address, zero until then
+	VerifiedAt time.Time
+	// Locale is the language the user chose for the site and the mails, empty for the default one
+	Locale string
+}
+
+// Verified tells if the user proved to own the email address
+func (u User) Verified() bool {
+	return !u.VerifiedAt.IsZero()
 }
 
+// Room holds a room of the catalogue
 type Room struct {
-	gorm.Model
-	RoomName string
+	ID            int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	RoomName      string
+	Slug          string
+	Description   string
+	Capacity      int
+	NightlyPrice  int // in cents
+	WeekendPrice  int // in cents, 0 charges the nightly price
+	MinNights     int
+	Photos        []string
+	ICalToken     string // secret part of the url of the calendar feed, empty when there is none
+	ICalImportURL string // calendar last imported as blocks from a url
+}
+
+// Season overrides the rates of a room from StartDate to EndDate, both included
+type Season struct {
+	ID           int
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	RoomID       int
+	Name         string
+	StartDate    time.Time
+	EndDate      time.Time
+	NightlyPrice int // in cents
+	WeekendPrice int // in cents, 0 charges the nightly price
+	MinNights    int // 0 keeps the minimum stay of the room
 }
 
 type Restriction struct {
-	gorm.Model
+	ID              int
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
 	RestrictionName string
 }
 
 // Reservation holds reservation data
 type Reservation struct {
-	gorm.Model
-	FirstName string
-	LastName  string
-	Email     string
-	Phone     string
-	StartDate time.Time
-	EndDate   time.Time
-	RoomID    int
-	Room      Room
-	Processed int
+	ID         int
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	FirstName  string
+	LastName   string
+	Email      string
+	Phone      string
+	StartDate  time.Time
+	EndDate    time.Time
+	RoomID     int
+	Room       Room
+	Processed  int
+	TotalPrice int // in cents
+	// ConfirmationCode and the email address let guests find the reservation without an account
+	ConfirmationCode string
+	// AccessTokenHash is the hash of the token in the link mailed to the guest
+	AccessTokenHash []byte
+	// CancelledAt is when the guest cancelled, zero for a reservation which stands
+	CancelledAt time.Time
+}
+
+// Cancelled tells if the guest cancelled the reservation
+func (r Reservation) Cancelled() bool {
+	return !r.CancelledAt.IsZero()
 }
 
 type RoomRestriction struct {
-	gorm.Model
+	ID            int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
 	StartDate     time.Time
 	EndDate       time.Time
 	RoomID        int
 	ReservationID int
 	RestrictionID int
-	Room          Room
-	Reservation   Reservation
-	Restriction   Restriction
+	// ExternalSource is the calendar an owner block was imported from, empty for the ones made here
+	ExternalSource string
+	Room           Room
+	Reservation    Reservation
+	Restriction    Restriction
+}
+
+// ExternalBlock is an event of another calendar, imported as an owner block of a room
+type ExternalBlock struct {
+	UID       string
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+// CalendarSync tells what importing a calendar changed in the blocks of a room
+type CalendarSync struct {
+	Added     int
+	Moved     int
+	Removed   int
+	Conflicts []ExternalBlock // events overlapping a reservation or another block, left out
 }
 
 // MailData holds email message
@@ -57,6 +148,90 @@ type MailData struct {
 	From     string
 	To       string
 	Subject  string
-	Content  string
-	Template string
+	Template string      // mail template, like verify-email.mail.tmpl
+	Data     interface{} // what the template shows, one of the mail data types
+	Locale   string      // language of the mail, the default one when empty
+	// rendered from the template when the mail is queued
+	Content     string
+	TextContent string
+}
+
+// ReservationMailData is the data of the mails about a reservation
+type ReservationMailData struct {
+	Reservation Reservation
+	Previous    Reservation // the reservation before the guest changed or cancelled it
+	Change      string      // what the guest did: changed or cancelled
+	Link        string      // where the guest manages the reservation
+}
+
+// LinkMailData is the data of the mails sending users a link to open
+type LinkMailData struct {
+	User User
+	Link string
+}
+
+// EmailChangeMailData is the data of the mail telling users their address was changed, sent
+// to the previous one
+type EmailChangeMailData struct {
+	User     User
+	Previous string
+}
+
+// Statuses of a mail in the outbox
+const (
+	MailPending = "pending"
+	MailSending = "sending"
+	MailSent    = "sent"
+	MailDead    = "dead"
+)
+
+// OutboxMail holds a mail of the outbox along with its delivery state
+type OutboxMail struct {
+	ID            int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Mail          MailData
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	SentAt        time.Time
+}
+
+// Events recorded in the auth log
+const (
+	AuthSigninSuccess = "signin_success"
+	AuthSigninFailure = "signin_failure"
+	AuthSigninLocked  = "signin_locked"
+	AuthLockout       = "lockout"
+	AuthLockoutLifted = "lockout_lifted"
+	AuthLogout        = "logout"
+)
+
+// AuthEvent is an entry of the auth log
+type AuthEvent struct {
+	ID        int
+	CreatedAt time.Time
+	Event     string
+	Email     string
+	UserID    int
+	IP        string
+	Detail    string
+}
+
+// What a lockout applies to
+const (
+	LockoutEmail = "email"
+	LockoutIP    = "ip"
+)
+
+// Lockout stops sign ins to an account or from an IP address until LockedUntil
+type Lockout struct {
+	ID          int
+	CreatedAt   time.Time
+	Kind        string
+	Key         string
+	LockedUntil time.Time
+	LiftedAt    time.Time
+	LiftedBy    int
 }
@@ -14,4 +14,7 @@ type TemplateData struct {
 	Error           string
 	Form            *forms.Form
 	IsAuthenticated int
+	AccessLevel     int
+	Role            string
+	Locale          string
 }
@@ -0,0 +1,106 @@
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/models"
+)
+
+// ErrInvalidRange is returned when the departure is not after the arrival
+var ErrInvalidRange = errors.New("the departure date must be after the arrival date")
+
+// MinStayError is returned when a stay is shorter than the minimum number of nights
+type MinStayError struct {
+	MinNights int
+}
+
+func (e MinStayError) Error() string {
+	return fmt.Sprintf("the minimum stay for these dates is %d nights", e.MinNights)
+}
+
+// Night holds the price of one night of a stay
+type Night struct {
+	Date   time.Time
+	Price  int // in cents
+	Season string
+}
+
+// Quote holds the price of a stay in a room
+type Quote struct {
+	RoomID    int
+	Nights    []Night
+	MinNights int
+	Total     int // in cents
+}
+
+// MeetsMinStay reports if the stay is as long as the minimum stay
+func (q Quote) MeetsMinStay() bool {
+	return len(q.Nights) >= q.MinNights
+}
+
+// Calculate prices every night from start to end, departure excluded. Seasons override the
+// room rates on the nights they cover, Friday and Saturday nights use the weekend rate when
+// there is one, and the minimum stay is the one of the season the stay starts in.
+// When the stay is too short the quote is returned along with a MinStayError.
+func Calculate(room models.Room, seasons []models.Season, start, end time.Time) (Quote, error) {
+	start, end = day(start), day(end)
+	if !end.After(start) {
+		return Quote{}, ErrInvalidRange
+	}
+
+	q := Quote{
+		RoomID:    room.ID,
+		MinNights: room.MinNights,
+	}
+	if s, ok := seasonFor(seasons, start); ok && s.MinNights > 0 {
+		q.MinNights = s.MinNights
+	}
+	if q.MinNights < 1 {
+		q.MinNights = 1
+	}
+
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		night := Night{
+			Date:  d,
+			Price: rate(room.NightlyPrice, room.WeekendPrice, d),
+		}
+		if s, ok := seasonFor(seasons, d); ok {
+			night.Price = rate(s.NightlyPrice, s.WeekendPrice, d)
+			night.Season = s.Name
+		}
+
+		q.Nights = append(q.Nights, night)
+		q.Total += night.Price
+	}
+
+	if !q.MeetsMinStay() {
+		return q, MinStayError{MinNights: q.MinNights}
+	}
+
+	return q, nil
+}
+
+// rate returns the weekend price on Friday and Saturday nights, when set, and the nightly price otherwise
+func rate(nightly, weekend int, d time.Time) int {
+	if weekend > 0 && (d.Weekday() == time.Friday || d.Weekday() == time.Saturday) {
+		return weekend
+	}
+	return nightly
+}
+
+// seasonFor returns the season covering the night of d, the first one listed wins
+func seasonFor(seasons []models.Season, d time.Time) (models.Season, bool) {
+	for _, s := range seasons {
+		if !d.Before(day(s.StartDate)) && !d.After(day(s.EndDate)) {
+			return s, true
+		}
+	}
+	return models.Season{}, false
+}
+
+// day drops the time of day from t
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
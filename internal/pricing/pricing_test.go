@@ -0,0 +1,80 @@
+package pricing
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/models"
+)
+
+var room = models.Room{
+	ID:           1,
+	NightlyPrice: 10000,
+	WeekendPrice: 15000,
+	MinNights:    1,
+}
+
+var seasons = []models.Season{
+	{
+		Name:         "Summer",
+		StartDate:    date("2050-07-01"),
+		EndDate:      date("2050-08-31"),
+		NightlyPrice: 20000,
+		MinNights:    3,
+	},
+}
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+var calculateTests = []struct {
+	name          string
+	start         string
+	end           string
+	expectedTotal int
+	expectedErr   error
+}{
+	// 2050-01-03 is a Monday
+	{"weekdays", "2050-01-03", "2050-01-05", 20000, nil},
+	{"weekend", "2050-01-06", "2050-01-09", 10000 + 15000 + 15000, nil},
+	{"season", "2050-07-04", "2050-07-07", 60000, nil},
+	{"into-season", "2050-06-29", "2050-07-02", 10000 + 10000 + 20000, nil},
+	{"season-min-stay", "2050-08-30", "2050-09-01", 40000, MinStayError{MinNights: 3}},
+	{"zero-nights", "2050-01-03", "2050-01-03", 0, ErrInvalidRange},
+	{"reversed", "2050-01-05", "2050-01-03", 0, ErrInvalidRange},
+}
+
+func TestCalculate(t *testing.T) {
+	for _, e := range calculateTests {
+		q, err := Calculate(room, seasons, date(e.start), date(e.end))
+		if !errors.Is(err, e.expectedErr) {
+			t.Errorf("%s: expected error %v but got %v", e.name, e.expectedErr, err)
+		}
+
+		if q.Total != e.expectedTotal {
+			t.Errorf("%s: expected total %d but got %d", e.name, e.expectedTotal, q.Total)
+		}
+	}
+}
+
+func TestCalculate_Nights(t *testing.T) {
+	q, err := Calculate(room, seasons, date("2050-06-30"), date("2050-07-02"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(q.Nights) != 2 {
+		t.Fatalf("expected 2 nights but got %d", len(q.Nights))
+	}
+
+	if q.Nights[0].Season != "" || q.Nights[1].Season != "Summer" {
+		t.Errorf("expected only the second night in season but got %q and %q", q.Nights[0].Season, q.Nights[1].Season)
+	}
+
+	if q.MinNights != 1 {
+		t.Errorf("expected the minimum stay of the room but got %d", q.MinNights)
+	}
+}
@@ -0,0 +1,132 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/i18n"
+	"github.com/marcelofranco/webapp-go-demo/internal/models"
+)
+
+var pathToMailTemplates = "./email-templates"
+
+// RenderMail renders the HTML contents of a mail from its template and data in the language
+// of the mail, along with a plain text version of them. A mail without a template or with one that does not
+// exist is an error, so that it is never sent empty
+func RenderMail(mail models.MailData) (models.MailData, error) {
+	if mail.Template == "" {
+		return mail, fmt.Errorf("mail %q has no template", mail.Subject)
+	}
+
+	var mc map[string]*template.Template
+	if app.UseCache {
+		mc = app.MailTemplateCache
+	} else {
+		var err error
+		mc, err = CreateMailTemplateCache()
+		if err != nil {
+			return mail, err
+		}
+	}
+
+	t, ok := mc[mail.Template]
+	if !ok {
+		return mail, fmt.Errorf("could not find mail template %s", mail.Template)
+	}
+
+	locale := mail.Locale
+	if !i18n.IsSupported(locale) {
+		locale = i18n.DefaultLocale
+	}
+	t, err := localize(t, locale)
+	if err != nil {
+		return mail, fmt.Errorf("can't localize mail template %s: %w", mail.Template, err)
+	}
+	mail.Subject = i18n.T(locale, mail.Subject)
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, mail.Data); err != nil {
+		return mail, fmt.Errorf("can't render mail template %s: %w", mail.Template, err)
+	}
+	mail.Content = buf.String()
+
+	// the plain text is made of the content alone, without the layout around it
+	buf.Reset()
+	if err := t.ExecuteTemplate(&buf, "content", mail.Data); err != nil {
+		return mail, fmt.Errorf("can't render mail template %s: %w", mail.Template, err)
+	}
+	mail.TextContent = htmlToText(buf.String())
+
+	return mail, nil
+}
+
+var (
+	linkTag     = regexp.MustCompile(`(?is)<a\s[^>]*href="([^"]*)"[^>]*>(.*?)</a>`)
+	breakTag    = regexp.MustCompile(`(?i)(<br\s*/?>|</(p|div|h[1-6]|li|tr)>)[ \t]*\n?`)
+	anyTag      = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankLines  = regexp.MustCompile(`\n{3,}`)
+	spaceInLine = regexp.MustCompile(`[ \t]+`)
+)
+
+// htmlToText turns the HTML of a mail into plain text: line breaks and the ends of blocks
+// start new lines, links show their url and the other tags are left out
+func htmlToText(s string) string {
+	s = linkTag.ReplaceAllStringFunc(s, func(a string) string {
+		m := linkTag.FindStringSubmatch(a)
+		href, text := m[1], strings.TrimSpace(anyTag.ReplaceAllString(m[2], ""))
+		if text == "" || text == href {
+			return href
+		}
+		return fmt.Sprintf("%s (%s)", text, href)
+	})
+	s = breakTag.ReplaceAllString(s, "\n")
+	s = anyTag.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(spaceInLine.ReplaceAllString(line, " "))
+	}
+	s = strings.Join(lines, "\n")
+
+	return strings.TrimSpace(blankLines.ReplaceAllString(s, "\n\n")) + "\n"
+}
+
+// CreateMailTemplateCache parses the mail templates with their layouts, like CreateTemplateCache does for pages
+func CreateMailTemplateCache() (map[string]*template.Template, error) {
+	myCache := map[string]*template.Template{}
+
+	matches, err := filepath.Glob(fmt.Sprintf("%s/*.layout.tmpl", pathToMailTemplates))
+	if err != nil {
+		return myCache, err
+	}
+
+	mails, err := filepath.Glob(fmt.Sprintf("%s/*.mail.tmpl", pathToMailTemplates))
+	if err != nil {
+		return myCache, err
+	}
+
+	for _, mail := range mails {
+		mailName := filepath.Base(mail)
+		ts, err := template.New(mailName).Funcs(functions).ParseFiles(mail)
+		if err != nil {
+			return myCache, err
+		}
+
+		if len(matches) > 0 {
+			ts, err = ts.ParseGlob(fmt.Sprintf("%s/*.layout.tmpl", pathToMailTemplates))
+			if err != nil {
+				return myCache, err
+			}
+		}
+
+		myCache[mailName] = ts
+	}
+
+	return myCache, nil
+}
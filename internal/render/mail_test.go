@@ -0,0 +1,134 @@
+package render
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marcelofranco/webapp-go-demo/internal/models"
+)
+
+func TestCreateMailTemplateCache(t *testing.T) {
+	pathToMailTemplates = "./../../email-templates"
+
+	mc, err := CreateMailTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mc) == 0 {
+		t.Error("expected mail templates but found none")
+	}
+}
+
+func TestRenderMail(t *testing.T) {
+	pathToMailTemplates = "./../../email-templates"
+	mc, err := CreateMailTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.MailTemplateCache = mc
+	app.UseCache = true
+
+	reservation := models.Reservation{
+		FirstName:        "<b>John</b>",
+		LastName:         "Smith",
+		Email:            "john@smith.com",
+		ConfirmationCode: "ABCD2345",
+		StartDate:        time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		EndDate:          time.Date(2050, 1, 5, 0, 0, 0, 0, time.UTC),
+		TotalPrice:       24000,
+		Room:             models.Room{RoomName: "General's Quarters"},
+	}
+	user := models.User{FirstName: "<b>John</b>", Email: "john@smith.com"}
+	link := "https://example.com/verify-email?id=1&expires=2&signature=abc"
+
+	tests := []struct {
+		template     string
+		data         interface{}
+		expectedText []string
+	}{
+		{"reservation-confirmation.mail.tmpl", models.ReservationMailData{Reservation: reservation, Link: link},
+			[]string{"Dear, <b>John</b>:", "from Jan 3, 2050 to Jan 5, 2050", "Total: $240.00", link}},
+		{"reservation-owner.mail.tmpl", models.ReservationMailData{Reservation: reservation},
+			[]string{"room General's Quarters was reserved"}},
+		{"reservation-change.mail.tmpl", models.ReservationMailData{Reservation: reservation, Previous: reservation, Change: "cancelled"},
+			[]string{"Your reservation ABCD2345 was cancelled.", "The room is free again"}},
+		{"reservation-change-owner.mail.tmpl", models.ReservationMailData{Reservation: reservation, Previous: reservation, Change: "changed"},
+			[]string{"changed reservation ABCD2345", "The stay now goes from 2050-01-03 to 2050-01-05"}},
+		{"password-reset.mail.tmpl", models.LinkMailData{User: user, Link: link}, []string{link}},
+		{"verify-email.mail.tmpl", models.LinkMailData{User: user, Link: link}, []string{link}},
+		{"email-changed.mail.tmpl", models.EmailChangeMailData{User: user, Previous: "old@smith.com"},
+			[]string{"changed from old@smith.com to john@smith.com"}},
+	}
+
+	for _, e := range tests {
+		mail, err := RenderMail(models.MailData{Template: e.template, Data: e.data})
+		if err != nil {
+			t.Errorf("%s: %s", e.template, err)
+			continue
+		}
+
+		if !strings.Contains(mail.Content, "<html") {
+			t.Errorf("%s: expected the layout around the content", e.template)
+		}
+		if strings.Contains(mail.Content, "<b>John</b>") {
+			t.Errorf("%s: expected the guest input to be escaped", e.template)
+		}
+		if strings.Contains(mail.TextContent, "<strong>") || strings.Contains(mail.TextContent, "<style") {
+			t.Errorf("%s: expected plain text but got %s", e.template, mail.TextContent)
+		}
+		for _, text := range e.expectedText {
+			if !strings.Contains(mail.TextContent, text) {
+				t.Errorf("%s: expected %q in the plain text but got\n%s", e.template, text, mail.TextContent)
+			}
+		}
+	}
+
+	// guests get the mails in their language, the subject too
+	mail, err := RenderMail(models.MailData{
+		Subject:  "Reservation confirmation",
+		Template: "reservation-confirmation.mail.tmpl",
+		Data:     models.ReservationMailData{Reservation: reservation, Link: link},
+		Locale:   "pt",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mail.Subject != "Confirmação da reserva" {
+		t.Errorf("expected the subject in Portuguese but got %q", mail.Subject)
+	}
+	for _, text := range []string{"Prezado(a), <b>John</b>:", "de 03/01/2050 a 05/01/2050", link} {
+		if !strings.Contains(mail.TextContent, text) {
+			t.Errorf("expected %q in the Portuguese mail but got\n%s", text, mail.TextContent)
+		}
+	}
+
+	// a mail must never go out empty
+	for _, name := range []string{"", "non-existent.mail.tmpl"} {
+		if _, err := RenderMail(models.MailData{Template: name}); err == nil {
+			t.Errorf("%q: expected an error but got none", name)
+		}
+	}
+	_, err = RenderMail(models.MailData{Template: "verify-email.mail.tmpl", Data: models.ReservationMailData{}})
+	if err == nil {
+		t.Error("expected an error for the wrong data but got none")
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		html     string
+		expected string
+	}{
+		{"<strong>Hello</strong><br>\n  Dear, John:<br/>Bye", "Hello\nDear, John:\nBye\n"},
+		{`Open <a href="https://a.com/?x=1&amp;y=2">https://a.com/?x=1&amp;y=2</a> now`, "Open https://a.com/?x=1&y=2 now\n"},
+		{`<a href="https://a.com">our site</a>`, "our site (https://a.com)\n"},
+		{"<p>One</p>\n\n\n\n<p>Two &amp; three</p>", "One\n\nTwo & three\n"},
+	}
+
+	for _, e := range tests {
+		if got := htmlToText(e.html); got != e.expected {
+			t.Errorf("expected %q but got %q", e.expected, got)
+		}
+	}
+}
@@ -5,18 +5,26 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
-	"log"
 	"net/http"
 	"path/filepath"
 	"time"
 
 	"github.com/justinas/nosurf"
 	"github.com/marcelofranco/webapp-go-demo/internal/config"
+	"github.com/marcelofranco/webapp-go-demo/internal/i18n"
+	"github.com/marcelofranco/webapp-go-demo/internal/logging"
 	"github.com/marcelofranco/webapp-go-demo/internal/models"
 )
 
 var functions = template.FuncMap{
-	"humanDate": HumanDate,
+	"humanDate":    HumanDate,
+	"iterate":      Iterate,
+	"add":          Add,
+	"price":        FormatPrice,
+	"T":            localeFuncs(i18n.DefaultLocale)["T"],
+	"date":         localeFuncs(i18n.DefaultLocale)["date"],
+	"locales":      i18n.Supported,
+	"languageName": i18n.Name,
 }
 
 var app *config.AppConfig
@@ -34,14 +42,60 @@ func HumanDate(t time.Time) string {
 	return t.Format("2006-01-02")
 }
 
+// localeFuncs returns the template functions which translate texts and format dates in locale.
+// Templates are parsed with those of the default locale, and pages and mails are rendered
+// with those of their own
+func localeFuncs(locale string) template.FuncMap {
+	return template.FuncMap{
+		"T": func(text string, args ...interface{}) string {
+			return i18n.T(locale, text, args...)
+		},
+		"date": func(t time.Time) string {
+			return i18n.FormatDate(locale, t)
+		},
+	}
+}
+
+// localize returns a copy of t rendering texts and dates in locale. The templates of the
+// cache are shared by the requests and are never executed, as they can't be cloned after
+func localize(t *template.Template, locale string) (*template.Template, error) {
+	lt, err := t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return lt.Funcs(localeFuncs(locale)), nil
+}
+
+// Iterate returns a slice of ints, starting at 0, going to count
+func Iterate(count int) []int {
+	var items []int
+	for i := 0; i < count; i++ {
+		items = append(items, i)
+	}
+	return items
+}
+
+// Add returns the sum of two ints
+func Add(a, b int) int {
+	return a + b
+}
+
+// FormatPrice formats a price in cents like 120.00
+func FormatPrice(cents int) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
+
 func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateData {
-	td.Flash = app.Session.PopString(r.Context(), "flash")
-	td.Error = app.Session.PopString(r.Context(), "error")
-	td.Warning = app.Session.PopString(r.Context(), "warning")
+	td.Locale = i18n.FromContext(r.Context())
+	td.Flash = i18n.T(td.Locale, app.Session.PopString(r.Context(), "flash"))
+	td.Error = i18n.T(td.Locale, app.Session.PopString(r.Context(), "error"))
+	td.Warning = i18n.T(td.Locale, app.Session.PopString(r.Context(), "warning"))
 	td.CSRFToken = nosurf.Token(r)
 	if app.Session.Exists(r.Context(), "user_id") {
 		td.IsAuthenticated = 1
 	}
+	td.AccessLevel = app.Session.GetInt(r.Context(), "access_level")
+	td.Role = models.RoleName(td.AccessLevel)
 	return td
 }
 
@@ -58,22 +112,32 @@ func RenderTemplate(w http.ResponseWriter, r *http.Request, tmpl string, td *mod
 
 	t, tmplFound := tc[tmpl]
 	if !tmplFound {
-		log.Printf("Could not find template %s\n", tmpl)
+		logging.FromContext(r.Context()).Error("could not find template", "template", tmpl)
 		return errors.New("could not find template")
 	}
 
 	buf := new(bytes.Buffer)
 
 	td = AddDefaultData(td, r)
+	if td.Form != nil {
+		td.Form.Localize(td.Locale)
+	}
+
+	t, err = localize(t, td.Locale)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("can't localize template", "template", tmpl, "error", err)
+		return err
+	}
+
 	err = t.Execute(buf, td)
 	if err != nil {
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("can't execute template", "template", tmpl, "error", err)
 		return err
 	}
 
 	_, err = buf.WriteTo(w)
 	if err != nil {
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("can't write page", "template", tmpl, "error", err)
 		return err
 	}
 
@@ -1,9 +1,14 @@
 package render
 
 import (
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/marcelofranco/webapp-go-demo/internal/forms"
+	"github.com/marcelofranco/webapp-go-demo/internal/i18n"
 	"github.com/marcelofranco/webapp-go-demo/internal/models"
 )
 
@@ -23,6 +28,29 @@ func TestAddDefaultData(t *testing.T) {
 	}
 }
 
+func TestAddDefaultData_Role(t *testing.T) {
+	var td models.TemplateData
+
+	r, err := getSession()
+	if err != nil {
+		t.Error(err)
+	}
+
+	session.Put(r.Context(), "user_id", 1)
+	session.Put(r.Context(), "access_level", models.AccessLevelStaff)
+
+	result := AddDefaultData(&td, r)
+	if result.IsAuthenticated != 1 {
+		t.Error("user should be authenticated")
+	}
+	if result.AccessLevel != models.AccessLevelStaff {
+		t.Errorf("expected access level %d but got %d", models.AccessLevelStaff, result.AccessLevel)
+	}
+	if result.Role != "staff" {
+		t.Errorf("expected role staff but got %s", result.Role)
+	}
+}
+
 func TestRenderTemplate(t *testing.T) {
 	pathToTemplates = "./../../templates"
 	tc, err := CreateTemplateCache()
@@ -57,6 +85,48 @@ func TestRenderTemplate(t *testing.T) {
 
 }
 
+func TestRenderTemplate_Locale(t *testing.T) {
+	pathToTemplates = "./../../templates"
+	tc, err := CreateTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.TemplateCache = tc
+	app.UseCache = true
+
+	// the cached templates are shared by the requests in every language
+	for _, locale := range []string{"pt", "en", "es", "pt"} {
+		r, err := getSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = r.WithContext(i18n.WithLocale(r.Context(), locale))
+		session.Put(r.Context(), "flash", "Your profile was saved.")
+
+		form := forms.New(nil)
+		form.Errors.Add("confirmation_code", "This field cannot be blank")
+
+		rr := httptest.NewRecorder()
+		err = RenderTemplate(rr, r, "find-reservation.page.tmpl", &models.TemplateData{Form: form})
+		if err != nil {
+			t.Fatalf("%s: %s", locale, err)
+		}
+
+		body := rr.Body.String()
+		expected := []string{
+			fmt.Sprintf(`<html lang="%s">`, locale),
+			i18n.T(locale, "Find your reservation"),
+			i18n.T(locale, "This field cannot be blank"),
+			i18n.T(locale, "Your profile was saved."),
+		}
+		for _, text := range expected {
+			if !strings.Contains(body, text) {
+				t.Errorf("%s: expected to find %q but did not", locale, text)
+			}
+		}
+	}
+}
+
 func TestNewTemplates(t *testing.T) {
 	NewTemplates(app)
 }
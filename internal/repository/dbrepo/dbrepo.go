@@ -1,7 +1,9 @@
 package dbrepo
 
 import (
+	"context"
 	"database/sql"
+	"time"
 
 	"github.com/marcelofranco/webapp-go-demo/internal/config"
 	"github.com/marcelofranco/webapp-go-demo/internal/repository"
@@ -29,3 +31,16 @@ func NewTestingsRepo(a *config.AppConfig) repository.DatabaseRepo {
 		App: a,
 	}
 }
+
+// defaultTimeout bounds every query when the app config does not set DBTimeout
+const defaultTimeout = 3 * time.Second
+
+// withTimeout derives the query context from the caller context, so a query is
+// cancelled with the request that issued it and never runs past the configured timeout
+func (m *postgresDBRepo) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := defaultTimeout
+	if m.App != nil && m.App.DBTimeout > 0 {
+		timeout = m.App.DBTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
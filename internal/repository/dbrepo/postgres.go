@@ -2,29 +2,46 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
-	"log"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/marcelofranco/webapp-go-demo/internal/logging"
 	"github.com/marcelofranco/webapp-go-demo/internal/models"
+	"github.com/marcelofranco/webapp-go-demo/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func (m *postgresDBRepo) AllUsers() bool {
+// Ping checks the database answers
+func (m *postgresDBRepo) Ping(ctx context.Context) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	return m.DB.PingContext(ctx)
+}
+
+// Stats returns the statistics of the connection pool
+func (m *postgresDBRepo) Stats() sql.DBStats {
+	return m.DB.Stats()
+}
+
+func (m *postgresDBRepo) AllUsers(ctx context.Context) bool {
 	return true
 }
 
 // InsertReservation inserts a reservation into the database
-func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var newID int
 
 	stmt := `insert into reservations (first_name, last_name, email, phone, start_date,
-			end_date, room_id, created_at, updated_at) 
-			values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+			end_date, room_id, total_price, created_at, updated_at) 
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id`
 
 	err := m.DB.QueryRowContext(ctx, stmt,
 		res.FirstName,
@@ -34,6 +51,7 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 		res.StartDate,
 		res.EndDate,
 		res.RoomID,
+		res.TotalPrice,
 		time.Now(),
 		time.Now(),
 	).Scan(&newID)
@@ -46,8 +64,8 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 }
 
 // InsertRoomRestriction inserts a room restriction into the database
-func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	stmt := `insert into room_restrictions (start_date, end_date, room_id, reservation_id,	
@@ -71,9 +89,113 @@ func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
 	return nil
 }
 
+// BookReservation checks availability and inserts the reservation and its room restriction
+// in a single transaction, returning repository.ErrRoomNotAvailable when the dates are taken
+func (m *postgresDBRepo) BookReservation(ctx context.Context, res models.Reservation, mails []models.MailData) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// lock the room so concurrent bookings for it wait until this one is done
+	var roomID int
+	err = tx.QueryRowContext(ctx, "select id from rooms where id = $1 for update", res.RoomID).Scan(&roomID)
+	if err != nil {
+		return 0, err
+	}
+
+	var numRows int
+	query := `
+		select
+			count(id)
+		from
+			room_restrictions
+		where
+			room_id = $1
+			and $2 < end_date and $3 > start_date
+			and deleted_at is null;`
+
+	err = tx.QueryRowContext(ctx, query, res.RoomID, res.StartDate, res.EndDate).Scan(&numRows)
+	if err != nil {
+		return 0, err
+	}
+	if numRows > 0 {
+		return 0, repository.ErrRoomNotAvailable
+	}
+
+	var newID int
+	stmt := `insert into reservations (first_name, last_name, email, phone, start_date,
+			end_date, room_id, total_price, confirmation_code, access_token_hash, created_at, updated_at) 
+			values ($1, $2, $3, $4, $5, $6, $7, $8, nullif($9, ''), $10, $11, $12) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		res.FirstName,
+		res.LastName,
+		res.Email,
+		res.Phone,
+		res.StartDate,
+		res.EndDate,
+		res.RoomID,
+		res.TotalPrice,
+		res.ConfirmationCode,
+		res.AccessTokenHash,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `insert into room_restrictions (start_date, end_date, room_id, reservation_id,	
+			created_at, updated_at, restriction_id) 
+			values
+			($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err = tx.ExecContext(ctx, stmt,
+		res.StartDate,
+		res.EndDate,
+		res.RoomID,
+		newID,
+		time.Now(),
+		time.Now(),
+		1,
+	)
+	if err != nil {
+		if isExclusionViolation(err) {
+			return 0, repository.ErrRoomNotAvailable
+		}
+		return 0, err
+	}
+
+	for _, mail := range mails {
+		if _, err = insertMail(ctx, tx, mail); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		if isExclusionViolation(err) {
+			return 0, repository.ErrRoomNotAvailable
+		}
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// isExclusionViolation checks if err was raised by the room_restrictions no overlap constraint
+func isExclusionViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23P01"
+}
+
 // SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID, and false if no availability
-func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var numRows int
@@ -100,31 +222,37 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time,
 }
 
 // SearchAvailabilityForAllRooms returns a slice of available rooms, if any, for given date range
-func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var rooms []models.Room
 
 	query := `
 		select
-			r.id, r.room_name
+			r.id, r.room_name, r.slug, r.nightly_price, r.weekend_price, r.min_nights
 		from
 			rooms r
 		where r.id not in 
-		(select room_id from room_restrictions rr where $1 < rr.end_date and $2 > rr.start_date);
+		(select room_id from room_restrictions rr
+			where $1 < rr.end_date and $2 > rr.start_date and rr.deleted_at is null);
 		`
 
 	rows, err := m.DB.QueryContext(ctx, query, start, end)
 	if err != nil {
 		return rooms, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var room models.Room
 		err := rows.Scan(
 			&room.ID,
 			&room.RoomName,
+			&room.Slug,
+			&room.NightlyPrice,
+			&room.WeekendPrice,
+			&room.MinNights,
 		)
 		if err != nil {
 			return rooms, err
@@ -140,42 +268,302 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 }
 
 // GetRoomByID gets a room by id
-func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var room models.Room
+	var photos string
 
 	query := `
-		select id, room_name, created_at, updated_at from rooms where id = $1
+		select id, room_name, slug, description, capacity, nightly_price, weekend_price, min_nights, created_at, updated_at,
+		coalesce((select string_agg(p.path, E'\n' order by p.position, p.id) from room_photos p where p.room_id = rooms.id), ''),
+		coalesce(ical_token, ''), ical_import_url
+		from rooms where id = $1
 `
 
 	row := m.DB.QueryRowContext(ctx, query, id)
 	err := row.Scan(
 		&room.ID,
 		&room.RoomName,
+		&room.Slug,
+		&room.Description,
+		&room.Capacity,
+		&room.NightlyPrice,
+		&room.WeekendPrice,
+		&room.MinNights,
+		&room.CreatedAt,
+		&room.UpdatedAt,
+		&photos,
+		&room.ICalToken,
+		&room.ICalImportURL,
+	)
+
+	if err != nil {
+		return room, err
+	}
+
+	room.Photos = splitPhotos(photos)
+
+	return room, nil
+}
+
+// GetRoomBySlug gets a room by its slug
+func (m *postgresDBRepo) GetRoomBySlug(ctx context.Context, slug string) (models.Room, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var room models.Room
+	var photos string
+
+	query := `
+		select id, room_name, slug, description, capacity, nightly_price, weekend_price, min_nights, created_at, updated_at,
+		coalesce((select string_agg(p.path, E'\n' order by p.position, p.id) from room_photos p where p.room_id = rooms.id), '')
+		from rooms where slug = $1
+`
+
+	row := m.DB.QueryRowContext(ctx, query, slug)
+	err := row.Scan(
+		&room.ID,
+		&room.RoomName,
+		&room.Slug,
+		&room.Description,
+		&room.Capacity,
+		&room.NightlyPrice,
+		&room.WeekendPrice,
+		&room.MinNights,
 		&room.CreatedAt,
 		&room.UpdatedAt,
+		&photos,
 	)
 
 	if err != nil {
 		return room, err
 	}
 
+	room.Photos = splitPhotos(photos)
+
 	return room, nil
 }
 
+// InsertRoom inserts a room and its photos into the database
+func (m *postgresDBRepo) InsertRoom(ctx context.Context, room models.Room) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
+
+	stmt := `insert into rooms (room_name, slug, description, capacity, nightly_price, weekend_price,
+			min_nights, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		room.RoomName,
+		room.Slug,
+		room.Description,
+		room.Capacity,
+		room.NightlyPrice,
+		room.WeekendPrice,
+		room.MinNights,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = insertRoomPhotos(ctx, tx, newID, room.Photos); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// UpdateRoom updates a room and replaces its photos
+func (m *postgresDBRepo) UpdateRoom(ctx context.Context, room models.Room) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `update rooms set room_name = $1, slug = $2, description = $3, capacity = $4,
+			nightly_price = $5, weekend_price = $6, min_nights = $7, updated_at = $8 where id = $9`
+
+	_, err = tx.ExecContext(ctx, stmt,
+		room.RoomName,
+		room.Slug,
+		room.Description,
+		room.Capacity,
+		room.NightlyPrice,
+		room.WeekendPrice,
+		room.MinNights,
+		time.Now(),
+		room.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from room_photos where room_id = $1", room.ID)
+	if err != nil {
+		return err
+	}
+
+	if err = insertRoomPhotos(ctx, tx, room.ID, room.Photos); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteRoom deletes a room, which fails while reservations still reference it
+func (m *postgresDBRepo) DeleteRoom(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, "delete from rooms where id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetSeasonsForRoom returns the seasonal rates of a room ordered by start date
+func (m *postgresDBRepo) GetSeasonsForRoom(ctx context.Context, roomID int) ([]models.Season, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var seasons []models.Season
+
+	query := `
+		select id, room_id, name, start_date, end_date, nightly_price, weekend_price, min_nights,
+		created_at, updated_at
+		from room_seasons where room_id = $1 order by start_date
+`
+
+	rows, err := m.DB.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.Season
+		err := rows.Scan(
+			&s.ID,
+			&s.RoomID,
+			&s.Name,
+			&s.StartDate,
+			&s.EndDate,
+			&s.NightlyPrice,
+			&s.WeekendPrice,
+			&s.MinNights,
+			&s.CreatedAt,
+			&s.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		seasons = append(seasons, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return seasons, nil
+}
+
+// InsertSeason inserts a seasonal rate for a room
+func (m *postgresDBRepo) InsertSeason(ctx context.Context, s models.Season) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+
+	stmt := `insert into room_seasons (room_id, name, start_date, end_date, nightly_price, weekend_price,
+			min_nights, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		s.RoomID,
+		s.Name,
+		s.StartDate,
+		s.EndDate,
+		s.NightlyPrice,
+		s.WeekendPrice,
+		s.MinNights,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// DeleteSeason deletes a seasonal rate of a room
+func (m *postgresDBRepo) DeleteSeason(ctx context.Context, roomID, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, "delete from room_seasons where id = $1 and room_id = $2", id, roomID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// insertRoomPhotos inserts the photos of a room keeping their order
+func insertRoomPhotos(ctx context.Context, tx *sql.Tx, roomID int, photos []string) error {
+	for i, photo := range photos {
+		_, err := tx.ExecContext(ctx, "insert into room_photos (room_id, path, position) values ($1, $2, $3)",
+			roomID, photo, i)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitPhotos splits the photo paths aggregated by the room queries
+func splitPhotos(photos string) []string {
+	if photos == "" {
+		return nil
+	}
+	return strings.Split(photos, "\n")
+}
+
 // GetUserByID returns a user by id
-func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	query := `select id, first_name, last_name, email, password, access_level, created_at, updated_at
+	query := `select id, first_name, last_name, email, password, access_level, session_version, verified_at, locale,
+			created_at, updated_at
 			from users where id = $1`
 
 	row := m.DB.QueryRowContext(ctx, query, id)
 
 	var u models.User
+	var verifiedAt sql.NullTime
 	err := row.Scan(
 		&u.ID,
 		&u.FirstName,
@@ -183,6 +571,9 @@ func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
 		&u.Email,
 		&u.Password,
 		&u.AccessLevel,
+		&u.SessionVersion,
+		&verifiedAt,
+		&u.Locale,
 		&u.CreatedAt,
 		&u.UpdatedAt,
 	)
@@ -190,21 +581,24 @@ func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
 	if err != nil {
 		return u, err
 	}
+	u.VerifiedAt = verifiedAt.Time
 
 	return u, nil
 }
 
 // GetUserByEmail returns a user by email
-func (m *postgresDBRepo) GetUserByEmail(email string) (models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	query := `select id, first_name, last_name, email, password, access_level, created_at, updated_at
+	query := `select id, first_name, last_name, email, password, access_level, session_version, verified_at, locale,
+			created_at, updated_at
 			from users where email = $1`
 
 	row := m.DB.QueryRowContext(ctx, query, email)
 
 	var u models.User
+	var verifiedAt sql.NullTime
 	err := row.Scan(
 		&u.ID,
 		&u.FirstName,
@@ -212,6 +606,9 @@ func (m *postgresDBRepo) GetUserByEmail(email string) (models.User, error) {
 		&u.Email,
 		&u.Password,
 		&u.AccessLevel,
+		&u.SessionVersion,
+		&verifiedAt,
+		&u.Locale,
 		&u.CreatedAt,
 		&u.UpdatedAt,
 	)
@@ -219,13 +616,14 @@ func (m *postgresDBRepo) GetUserByEmail(email string) (models.User, error) {
 	if err != nil {
 		return u, err
 	}
+	u.VerifiedAt = verifiedAt.Time
 
 	return u, nil
 }
 
 // CreateUser create a user in the database
-func (m *postgresDBRepo) CreateUser(u models.User) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) CreateUser(ctx context.Context, u models.User) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var newID int
@@ -237,8 +635,8 @@ func (m *postgresDBRepo) CreateUser(u models.User) (int, error) {
 
 	stmt := `
 	INSERT INTO public.users
-	(created_at, updated_at, "name", first_name, last_name, email, "password", access_level)
-	VALUES($1, $2, $3, $4, $5, $6, $7, 0) returning id
+	(created_at, updated_at, "name", first_name, last_name, email, "password", access_level, locale)
+	VALUES($1, $2, $3, $4, $5, $6, $7, 0, $8) returning id
 `
 
 	err = m.DB.QueryRowContext(ctx, stmt,
@@ -249,6 +647,7 @@ func (m *postgresDBRepo) CreateUser(u models.User) (int, error) {
 		u.LastName,
 		u.Email,
 		hashedPassword,
+		u.Locale,
 	).Scan(&newID)
 
 	if err != nil {
@@ -258,21 +657,26 @@ func (m *postgresDBRepo) CreateUser(u models.User) (int, error) {
 	return newID, nil
 }
 
-// UpdateUser updates a user in the database
-func (m *postgresDBRepo) UpdateUser(u models.User) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// UpdateUser updates a user in the database. A new email address has to be verified again
+func (m *postgresDBRepo) UpdateUser(ctx context.Context, u models.User) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	query := `
-		update users set first_name = $1, last_name = $2, email = $3, access_level = $4, updated_at = $5
+		update users set first_name = $1, last_name = $2, "name" = $3, email = $4, access_level = $5, updated_at = $6,
+		verified_at = case when email = $4 then verified_at end, locale = $7
+		where id = $8
 `
 
 	_, err := m.DB.ExecContext(ctx, query,
 		u.FirstName,
 		u.LastName,
+		fmt.Sprintf("%s %s", u.FirstName, u.LastName),
 		u.Email,
 		u.AccessLevel,
 		time.Now(),
+		u.Locale,
+		u.ID,
 	)
 
 	if err != nil {
@@ -283,8 +687,8 @@ func (m *postgresDBRepo) UpdateUser(u models.User) error {
 }
 
 // Authenticate authenticates a user
-func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var id int
@@ -306,51 +710,322 @@ func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string,
 	return id, hashedPassword, nil
 }
 
-// AllReservations returns a slice of all reservations
-func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// UpdatePassword sets the password of a user and signs the user out of every session.
+// It returns the new session version of the user
+func (m *postgresDBRepo) UpdatePassword(ctx context.Context, userID int, password string) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	var reservations []models.Reservation
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
 
-	query := `
-		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, 
-		r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
-		rm.id, rm.room_name
-		from reservations r
-		left join rooms rm on (r.room_id = rm.id)
-		order by r.start_date asc
-`
+	var sessionVersion int
+	stmt := `update users set password = $1, session_version = session_version + 1, updated_at = $2
+			where id = $3 returning session_version`
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	err = m.DB.QueryRowContext(ctx, stmt, hashedPassword, time.Now(), userID).Scan(&sessionVersion)
 	if err != nil {
-		return reservations, err
+		return 0, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var i models.Reservation
-		err := rows.Scan(
-			&i.ID,
-			&i.FirstName,
-			&i.LastName,
-			&i.Email,
-			&i.Phone,
-			&i.StartDate,
-			&i.EndDate,
-			&i.RoomID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Processed,
-			&i.Room.ID,
-			&i.Room.RoomName,
-		)
+	return sessionVersion, nil
+}
 
-		if err != nil {
-			return reservations, err
-		}
-		reservations = append(reservations, i)
-	}
+// CreatePasswordReset stores the hash of a password reset token of a user
+func (m *postgresDBRepo) CreatePasswordReset(ctx context.Context, userID int, tokenHash []byte, expiresAt time.Time) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	stmt := `insert into password_resets (user_id, token_hash, expires_at, created_at) values ($1, $2, $3, $4)`
+
+	_, err := m.DB.ExecContext(ctx, stmt, userID, tokenHash, expiresAt, time.Now())
+	return err
+}
+
+// PasswordResetUserID returns the user of a password reset token which can still be used
+func (m *postgresDBRepo) PasswordResetUserID(ctx context.Context, tokenHash []byte) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var userID int
+	query := `select user_id from password_resets where token_hash = $1 and used_at is null and expires_at > now()`
+
+	err := m.DB.QueryRowContext(ctx, query, tokenHash).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, repository.ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// ResetPassword sets the password of the user of a password reset token, uses up
+// every token of the user and signs the user out of every session
+func (m *postgresDBRepo) ResetPassword(ctx context.Context, tokenHash []byte, password string) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// locked so that the token can only be used once
+	var userID int
+	query := `select user_id from password_resets
+			where token_hash = $1 and used_at is null and expires_at > now() for update`
+
+	err = tx.QueryRowContext(ctx, query, tokenHash).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, repository.ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `update users set password = $1, session_version = session_version + 1, updated_at = $2 where id = $3`
+	if _, err := tx.ExecContext(ctx, stmt, hashedPassword, time.Now(), userID); err != nil {
+		return 0, err
+	}
+
+	stmt = `update password_resets set used_at = $1 where user_id = $2 and used_at is null`
+	if _, err := tx.ExecContext(ctx, stmt, time.Now(), userID); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// VerifyEmail marks the email address of a user as verified, as long as it is still
+// the address of the user
+func (m *postgresDBRepo) VerifyEmail(ctx context.Context, userID int, email string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	stmt := `update users set verified_at = coalesce(verified_at, $1) where id = $2 and email = $3`
+
+	result, err := m.DB.ExecContext(ctx, stmt, time.Now(), userID, email)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return repository.ErrInvalidToken
+	}
+	return nil
+}
+
+// InsertAuthEvent adds an entry to the auth log
+func (m *postgresDBRepo) InsertAuthEvent(ctx context.Context, e models.AuthEvent) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	stmt := `insert into auth_events (created_at, event, email, user_id, ip, detail)
+			values ($1, $2, $3, nullif($4, 0), $5, $6)`
+
+	_, err := m.DB.ExecContext(ctx, stmt, time.Now(), e.Event, e.Email, e.UserID, e.IP, e.Detail)
+	return err
+}
+
+// RecentAuthEvents returns the latest entries of the auth log, newest first
+func (m *postgresDBRepo) RecentAuthEvents(ctx context.Context, limit int) ([]models.AuthEvent, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `select id, created_at, event, email, coalesce(user_id, 0), ip, detail
+			from auth_events order by created_at desc limit $1`
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.AuthEvent
+	for rows.Next() {
+		var e models.AuthEvent
+		err := rows.Scan(&e.ID, &e.CreatedAt, &e.Event, &e.Email, &e.UserID, &e.IP, &e.Detail)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// CountSigninFailures returns the failed sign ins for an email address or an IP address since
+// a time. Failures before the last lockout of the key don't count, nor do failures for an
+// account before its last successful sign in
+func (m *postgresDBRepo) CountSigninFailures(ctx context.Context, kind, key string, since time.Time) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var query string
+	switch kind {
+	case models.LockoutEmail:
+		query = `select count(*) from auth_events
+			where event = 'signin_failure' and email = $1 and created_at > $2
+			and created_at > coalesce((select max(created_at) from auth_lockouts where kind = 'email' and key = $1), '-infinity')
+			and created_at > coalesce((select max(created_at) from auth_events where event = 'signin_success' and email = $1), '-infinity')`
+	case models.LockoutIP:
+		query = `select count(*) from auth_events
+			where event = 'signin_failure' and ip = $1 and created_at > $2
+			and created_at > coalesce((select max(created_at) from auth_lockouts where kind = 'ip' and key = $1), '-infinity')`
+	default:
+		return 0, fmt.Errorf("unknown lockout kind %q", kind)
+	}
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, key, since).Scan(&count)
+	return count, err
+}
+
+// LockedUntil returns when the lockout of an email address or an IP address ends, or the zero
+// time when neither is locked out
+func (m *postgresDBRepo) LockedUntil(ctx context.Context, email, ip string) (time.Time, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `select max(locked_until) from auth_lockouts
+			where lifted_at is null and locked_until > now()
+			and ((kind = 'email' and key = $1) or (kind = 'ip' and key = $2))`
+
+	var until sql.NullTime
+	if err := m.DB.QueryRowContext(ctx, query, email, ip).Scan(&until); err != nil {
+		return time.Time{}, err
+	}
+	return until.Time, nil
+}
+
+// InsertLockout locks an email address or an IP address out
+func (m *postgresDBRepo) InsertLockout(ctx context.Context, l models.Lockout) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+	stmt := `insert into auth_lockouts (created_at, kind, key, locked_until) values ($1, $2, $3, $4) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt, time.Now(), l.Kind, l.Key, l.LockedUntil).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// ActiveLockouts returns the lockouts which are not over nor lifted, latest first
+func (m *postgresDBRepo) ActiveLockouts(ctx context.Context) ([]models.Lockout, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `select id, created_at, kind, key, locked_until from auth_lockouts
+			where lifted_at is null and locked_until > now() order by created_at desc`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lockouts []models.Lockout
+	for rows.Next() {
+		var l models.Lockout
+		if err := rows.Scan(&l.ID, &l.CreatedAt, &l.Kind, &l.Key, &l.LockedUntil); err != nil {
+			return nil, err
+		}
+		lockouts = append(lockouts, l)
+	}
+
+	return lockouts, rows.Err()
+}
+
+// LiftLockout ends a lockout before its time, recording the staff member who lifted it
+func (m *postgresDBRepo) LiftLockout(ctx context.Context, id, liftedBy int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	stmt := `update auth_lockouts set lifted_at = $1, lifted_by = nullif($2, 0) where id = $3 and lifted_at is null`
+
+	result, err := m.DB.ExecContext(ctx, stmt, time.Now(), liftedBy, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AllReservations returns a slice of all reservations
+func (m *postgresDBRepo) AllReservations(ctx context.Context) ([]models.Reservation, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `
+		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, 
+		r.end_date, r.room_id, r.total_price, r.created_at, r.updated_at, r.processed,
+		r.cancelled_at, rm.id, rm.room_name
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		order by r.start_date asc
+`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		var cancelledAt sql.NullTime
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.TotalPrice,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Processed,
+			&cancelledAt,
+			&i.Room.ID,
+			&i.Room.RoomName,
+		)
+
+		if err != nil {
+			return reservations, err
+		}
+		i.CancelledAt = cancelledAt.Time
+		reservations = append(reservations, i)
+	}
 
 	if err = rows.Err(); err != nil {
 		return reservations, err
@@ -359,20 +1034,20 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 	return reservations, nil
 }
 
-// AllNewReservations returns a slice of all reservations
-func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// AllNewReservations returns the reservations which are neither processed nor cancelled
+func (m *postgresDBRepo) AllNewReservations(ctx context.Context) ([]models.Reservation, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var reservations []models.Reservation
 
 	query := `
 		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, 
-		r.end_date, r.room_id, r.created_at, r.updated_at, 
+		r.end_date, r.room_id, r.total_price, r.created_at, r.updated_at, 
 		rm.id, rm.room_name
 		from reservations r
 		left join rooms rm on (r.room_id = rm.id)
-		where processed = 0
+		where r.processed = 0 and r.cancelled_at is null
 		order by r.start_date asc
 `
 
@@ -393,6 +1068,7 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 			&i.StartDate,
 			&i.EndDate,
 			&i.RoomID,
+			&i.TotalPrice,
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Room.ID,
@@ -413,21 +1089,37 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 }
 
 // GetReservationByID returns one reservation by ID
-func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	return m.getReservation(ctx, "r.id = $1", id)
+}
+
+// GetReservationByConfirmationCode returns the reservation with a confirmation code
+func (m *postgresDBRepo) GetReservationByConfirmationCode(ctx context.Context, code string) (models.Reservation, error) {
+	return m.getReservation(ctx, "r.confirmation_code = $1", code)
+}
+
+// GetReservationByAccessToken returns the reservation of the token mailed to the guest
+func (m *postgresDBRepo) GetReservationByAccessToken(ctx context.Context, tokenHash []byte) (models.Reservation, error) {
+	return m.getReservation(ctx, "r.access_token_hash = $1", tokenHash)
+}
+
+// getReservation returns the reservation matching a condition on the reservations table, aliased r
+func (m *postgresDBRepo) getReservation(ctx context.Context, where string, arg interface{}) (models.Reservation, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var res models.Reservation
+	var code sql.NullString
+	var cancelledAt sql.NullTime
 
 	query := `
 		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
-		r.end_date, r.room_id, r.created_at, r.updated_at, r.processed, 
-		rm.id, rm.room_name
+		r.end_date, r.room_id, r.total_price, r.created_at, r.updated_at, r.processed,
+		r.confirmation_code, r.cancelled_at, rm.id, rm.room_name
 		from reservations r
 		left join rooms rm on (r.room_id = rm.id)
-		where r.id = $1
-`
-	row := m.DB.QueryRowContext(ctx, query, id)
+		where ` + where
+	row := m.DB.QueryRowContext(ctx, query, arg)
 	err := row.Scan(
 		&res.ID,
 		&res.FirstName,
@@ -437,9 +1129,12 @@ func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error)
 		&res.StartDate,
 		&res.EndDate,
 		&res.RoomID,
+		&res.TotalPrice,
 		&res.CreatedAt,
 		&res.UpdatedAt,
 		&res.Processed,
+		&code,
+		&cancelledAt,
 		&res.Room.ID,
 		&res.Room.RoomName,
 	)
@@ -447,13 +1142,15 @@ func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error)
 	if err != nil {
 		return res, err
 	}
+	res.ConfirmationCode = code.String
+	res.CancelledAt = cancelledAt.Time
 
 	return res, nil
 }
 
 // UpdateReservation updates a reservation in the database
-func (m *postgresDBRepo) UpdateReservation(u models.Reservation) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) UpdateReservation(ctx context.Context, u models.Reservation) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	query := `
@@ -477,24 +1174,150 @@ func (m *postgresDBRepo) UpdateReservation(u models.Reservation) error {
 	return nil
 }
 
-// DeleteReservation deletes one reservation by id
-func (m *postgresDBRepo) DeleteReservation(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// DeleteReservation deletes one reservation by id along with its room restriction
+func (m *postgresDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	query := "delete from reservations where id = $1"
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	_, err := m.DB.ExecContext(ctx, query, id)
+	_, err = tx.ExecContext(ctx, "delete from room_restrictions where reservation_id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from reservations where id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ChangeReservationDates moves a reservation and its room restriction to new dates with
+// a new total, returning repository.ErrRoomNotAvailable when the room is taken by others then
+// and repository.ErrReservationCancelled when the reservation was cancelled meanwhile
+func (m *postgresDBRepo) ChangeReservationDates(ctx context.Context, res models.Reservation, mails []models.MailData) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
+	// lock the room so concurrent bookings for it wait until this one is done
+	var roomID int
+	err = tx.QueryRowContext(ctx, "select id from rooms where id = $1 for update", res.RoomID).Scan(&roomID)
+	if err != nil {
+		return err
+	}
+
+	var numRows int
+	query := `
+		select
+			count(id)
+		from
+			room_restrictions
+		where
+			room_id = $1
+			and $2 < end_date and $3 > start_date
+			and reservation_id is distinct from $4
+			and deleted_at is null;`
+
+	err = tx.QueryRowContext(ctx, query, res.RoomID, res.StartDate, res.EndDate, res.ID).Scan(&numRows)
+	if err != nil {
+		return err
+	}
+	if numRows > 0 {
+		return repository.ErrRoomNotAvailable
+	}
+
+	stmt := `update reservations set start_date = $1, end_date = $2, total_price = $3, updated_at = $4
+			where id = $5 and cancelled_at is null`
+	result, err := tx.ExecContext(ctx, stmt, res.StartDate, res.EndDate, res.TotalPrice, time.Now(), res.ID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return repository.ErrReservationCancelled
+	}
+
+	stmt = `update room_restrictions set start_date = $1, end_date = $2, updated_at = $3 where reservation_id = $4`
+	_, err = tx.ExecContext(ctx, stmt, res.StartDate, res.EndDate, time.Now(), res.ID)
+	if err != nil {
+		if isExclusionViolation(err) {
+			return repository.ErrRoomNotAvailable
+		}
+		return err
+	}
+
+	for _, mail := range mails {
+		if _, err = insertMail(ctx, tx, mail); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		if isExclusionViolation(err) {
+			return repository.ErrRoomNotAvailable
+		}
+		return err
+	}
 	return nil
 }
 
+// CancelReservation marks a reservation as cancelled and releases its room restriction.
+// The reservation is kept for the records. It returns repository.ErrReservationCancelled
+// when the reservation was already cancelled
+func (m *postgresDBRepo) CancelReservation(ctx context.Context, id int, mails []models.MailData) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "update reservations set cancelled_at = $1, updated_at = $1 where id = $2 and cancelled_at is null", time.Now(), id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return repository.ErrReservationCancelled
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from room_restrictions where reservation_id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	for _, mail := range mails {
+		if _, err = insertMail(ctx, tx, mail); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
 // UpdateProcessedForReservation updates processed for a reservation by id
-func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	query := "update reservations set processed = $1 where id = $2"
@@ -507,13 +1330,18 @@ func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error
 	return nil
 }
 
-func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// AllRooms returns every room of the catalogue with its photos
+func (m *postgresDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var rooms []models.Room
 
-	query := `select id, room_name, created_at, updated_at from rooms order by room_name`
+	query := `
+		select id, room_name, slug, description, capacity, nightly_price, weekend_price, min_nights, created_at, updated_at,
+		coalesce((select string_agg(p.path, E'\n' order by p.position, p.id) from room_photos p where p.room_id = rooms.id), '')
+		from rooms order by room_name
+`
 
 	rows, err := m.DB.QueryContext(ctx, query)
 	if err != nil {
@@ -523,15 +1351,24 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 
 	for rows.Next() {
 		var rm models.Room
+		var photos string
 		err := rows.Scan(
 			&rm.ID,
 			&rm.RoomName,
+			&rm.Slug,
+			&rm.Description,
+			&rm.Capacity,
+			&rm.NightlyPrice,
+			&rm.WeekendPrice,
+			&rm.MinNights,
 			&rm.CreatedAt,
 			&rm.UpdatedAt,
+			&photos,
 		)
 		if err != nil {
 			return rooms, err
 		}
+		rm.Photos = splitPhotos(photos)
 		rooms = append(rooms, rm)
 	}
 
@@ -543,16 +1380,17 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 }
 
 // GetRestrictionsForRoomByDate returns restrictions for a room by date range
-func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var restrictions []models.RoomRestriction
 
 	query := `
-		select id, coalesce(reservation_id, 0), restriction_id, room_id, start_date, end_date
+		select id, coalesce(reservation_id, 0), restriction_id, room_id, start_date, end_date,
+		coalesce(external_source, '')
 		from room_restrictions where $1 < end_date and $2 >= start_date
-		and room_id = $3
+		and room_id = $3 and deleted_at is null
 `
 
 	rows, err := m.DB.QueryContext(ctx, query, start, end, roomID)
@@ -570,6 +1408,7 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end tim
 			&r.RoomID,
 			&r.StartDate,
 			&r.EndDate,
+			&r.ExternalSource,
 		)
 		if err != nil {
 			return nil, err
@@ -585,8 +1424,8 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end tim
 }
 
 // InsertBlockForRoom inserts a room restriction
-func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	query := `insert into room_restrictions (start_date, end_date, room_id, restriction_id,
@@ -594,37 +1433,187 @@ func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
 
 	_, err := m.DB.ExecContext(ctx, query, startDate, startDate.AddDate(0, 0, 1), id, 2, time.Now(), time.Now())
 	if err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("can't block room", "room_id", id, "error", err)
 		return err
 	}
 	return nil
 }
 
 // DeleteBlockByID deletes a room restriction
-func (m *postgresDBRepo) DeleteBlockByID(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	query := `delete from room_restrictions where id = $1`
 
 	_, err := m.DB.ExecContext(ctx, query, id)
 	if err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("can't delete block", "restriction_id", id, "error", err)
 		return err
 	}
 	return nil
 }
 
+// GetRoomByICalToken gets the room whose calendar feed has the token
+func (m *postgresDBRepo) GetRoomByICalToken(ctx context.Context, token string) (models.Room, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var room models.Room
+
+	query := `select id, room_name, slug from rooms where ical_token = $1`
+
+	err := m.DB.QueryRowContext(ctx, query, token).Scan(&room.ID, &room.RoomName, &room.Slug)
+	if err != nil {
+		return room, err
+	}
+	room.ICalToken = token
+
+	return room, nil
+}
+
+// SetRoomICalToken sets the token of the calendar feed of a room, which stops the previous url working
+func (m *postgresDBRepo) SetRoomICalToken(ctx context.Context, roomID int, token string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, "update rooms set ical_token = $1, updated_at = $2 where id = $3", token, time.Now(), roomID)
+	return err
+}
+
+// SetRoomICalImportURL keeps the url of the calendar imported as blocks of a room
+func (m *postgresDBRepo) SetRoomICalImportURL(ctx context.Context, roomID int, url string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, "update rooms set ical_import_url = $1, updated_at = $2 where id = $3", url, time.Now(), roomID)
+	return err
+}
+
+// SyncExternalBlocks makes the blocks of a room imported from source match blocks: new events
+// are added, moved ones get their new dates and the ones no longer there are removed. Events
+// overlapping a reservation or another block are left out and returned as conflicts
+func (m *postgresDBRepo) SyncExternalBlocks(ctx context.Context, roomID int, source string, blocks []models.ExternalBlock) (models.CalendarSync, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var sync models.CalendarSync
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return sync, err
+	}
+	defer tx.Rollback()
+
+	// lock the room so two imports of it don't add the same events
+	var id int
+	err = tx.QueryRowContext(ctx, "select id from rooms where id = $1 for update", roomID).Scan(&id)
+	if err != nil {
+		return sync, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		select id, external_uid, start_date, end_date from room_restrictions
+		where room_id = $1 and external_source = $2`, roomID, source)
+	if err != nil {
+		return sync, err
+	}
+
+	existing := make(map[string]models.RoomRestriction)
+	for rows.Next() {
+		var r models.RoomRestriction
+		var uid string
+		if err := rows.Scan(&r.ID, &uid, &r.StartDate, &r.EndDate); err != nil {
+			rows.Close()
+			return sync, err
+		}
+		existing[uid] = r
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return sync, err
+	}
+
+	wanted := make(map[string]bool)
+	for _, b := range blocks {
+		wanted[b.UID] = true
+	}
+
+	// removed first, so that events moved onto their dates don't conflict with them
+	for uid, r := range existing {
+		if wanted[uid] {
+			continue
+		}
+		if _, err = tx.ExecContext(ctx, "delete from room_restrictions where id = $1", r.ID); err != nil {
+			return sync, err
+		}
+		sync.Removed++
+	}
+
+	seen := make(map[string]bool)
+	for _, b := range blocks {
+		if seen[b.UID] {
+			continue
+		}
+		seen[b.UID] = true
+
+		r, found := existing[b.UID]
+		if found && r.StartDate.Equal(b.StartDate) && r.EndDate.Equal(b.EndDate) {
+			continue
+		}
+
+		// a savepoint keeps the transaction usable when the event overlaps another restriction
+		if _, err = tx.ExecContext(ctx, "savepoint external_block"); err != nil {
+			return sync, err
+		}
+
+		if found {
+			_, err = tx.ExecContext(ctx, `update room_restrictions set start_date = $1, end_date = $2, updated_at = $3
+				where id = $4`, b.StartDate, b.EndDate, time.Now(), r.ID)
+		} else {
+			_, err = tx.ExecContext(ctx, `insert into room_restrictions (start_date, end_date, room_id, restriction_id,
+				external_source, external_uid, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8)`,
+				b.StartDate, b.EndDate, roomID, 2, source, b.UID, time.Now(), time.Now())
+		}
+
+		if isExclusionViolation(err) {
+			if _, err = tx.ExecContext(ctx, "rollback to savepoint external_block"); err != nil {
+				return sync, err
+			}
+			sync.Conflicts = append(sync.Conflicts, b)
+			continue
+		}
+		if err != nil {
+			return sync, err
+		}
+		if _, err = tx.ExecContext(ctx, "release savepoint external_block"); err != nil {
+			return sync, err
+		}
+
+		if found {
+			sync.Moved++
+		} else {
+			sync.Added++
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.CalendarSync{}, err
+	}
+
+	return sync, nil
+}
+
 // GetReservationsByUser returns a slice of user reservations
-func (m *postgresDBRepo) GetReservationsByUser(email string) ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) GetReservationsByUser(ctx context.Context, email string) ([]models.Reservation, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var reservations []models.Reservation
 
 	query := `
 		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, 
-		r.end_date, r.room_id, r.processed, rm.room_name
+		r.end_date, r.room_id, r.total_price, r.processed, r.cancelled_at, rm.room_name
 		from reservations r
 		inner join rooms rm on rm.id = r.room_id
 		where r.email=$1
@@ -639,6 +1628,7 @@ func (m *postgresDBRepo) GetReservationsByUser(email string) ([]models.Reservati
 
 	for rows.Next() {
 		var i models.Reservation
+		var cancelledAt sql.NullTime
 		err := rows.Scan(
 			&i.ID,
 			&i.FirstName,
@@ -648,13 +1638,16 @@ func (m *postgresDBRepo) GetReservationsByUser(email string) ([]models.Reservati
 			&i.StartDate,
 			&i.EndDate,
 			&i.RoomID,
+			&i.TotalPrice,
 			&i.Processed,
+			&cancelledAt,
 			&i.Room.RoomName,
 		)
 
 		if err != nil {
 			return reservations, err
 		}
+		i.CancelledAt = cancelledAt.Time
 		reservations = append(reservations, i)
 	}
 
@@ -664,3 +1657,243 @@ func (m *postgresDBRepo) GetReservationsByUser(email string) ([]models.Reservati
 
 	return reservations, nil
 }
+
+// EnqueueMail stores a mail in the outbox to be sent by the mail queue
+func (m *postgresDBRepo) EnqueueMail(ctx context.Context, mail models.MailData) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	return insertMail(ctx, m.DB, mail)
+}
+
+// rowQuerier is what insertMail needs of a *sql.DB or a *sql.Tx
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// insertMail stores a rendered mail in the outbox. Given the transaction of a change, the
+// mail about it is only stored when the change is committed
+func insertMail(ctx context.Context, q rowQuerier, mail models.MailData) (int, error) {
+	var newID int
+
+	stmt := `insert into mail_outbox (from_address, to_address, subject, content, text_content, template,
+			status, next_attempt_at, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id`
+
+	err := q.QueryRowContext(ctx, stmt,
+		mail.From,
+		mail.To,
+		mail.Subject,
+		mail.Content,
+		mail.TextContent,
+		mail.Template,
+		models.MailPending,
+		time.Now(),
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// ClaimMail marks up to limit mails due for sending as being sent and returns them. Mails
+// left sending for longer than lease, by a worker that died, are claimed again.
+func (m *postgresDBRepo) ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMail, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		update mail_outbox set status = $1, attempts = attempts + 1, updated_at = now()
+		where id in (
+			select id from mail_outbox
+			where (status = $2 and next_attempt_at <= now())
+			or (status = $1 and updated_at < $3)
+			order by next_attempt_at
+			limit $4
+			for update skip locked
+		)
+		returning id, from_address, to_address, subject, content, text_content, template, status, attempts,
+		next_attempt_at, last_error, created_at, updated_at
+`
+
+	rows, err := m.DB.QueryContext(ctx, query, models.MailSending, models.MailPending, time.Now().Add(-lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mails []models.OutboxMail
+	for rows.Next() {
+		var o models.OutboxMail
+		err := rows.Scan(
+			&o.ID,
+			&o.Mail.From,
+			&o.Mail.To,
+			&o.Mail.Subject,
+			&o.Mail.Content,
+			&o.Mail.TextContent,
+			&o.Mail.Template,
+			&o.Status,
+			&o.Attempts,
+			&o.NextAttemptAt,
+			&o.LastError,
+			&o.CreatedAt,
+			&o.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		mails = append(mails, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return mails, nil
+}
+
+// MarkMailSent records that a mail of the outbox was sent
+func (m *postgresDBRepo) MarkMailSent(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `update mail_outbox set status = $1, last_error = '', sent_at = $2, updated_at = $2 where id = $3`
+
+	_, err := m.DB.ExecContext(ctx, query, models.MailSent, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MarkMailFailed records a failed attempt to send a mail, which is tried again at nextAttemptAt
+// or given up on when dead
+func (m *postgresDBRepo) MarkMailFailed(ctx context.Context, id int, lastError string, nextAttemptAt time.Time, dead bool) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	status := models.MailPending
+	if dead {
+		status = models.MailDead
+	}
+
+	query := `update mail_outbox set status = $1, last_error = $2, next_attempt_at = $3, updated_at = $4
+			where id = $5`
+
+	_, err := m.DB.ExecContext(ctx, query, status, lastError, nextAttemptAt, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetMailByStatus returns the latest mails of the outbox with the given status
+func (m *postgresDBRepo) GetMailByStatus(ctx context.Context, status string, limit int) ([]models.OutboxMail, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		select id, from_address, to_address, subject, content, text_content, template, status, attempts,
+		next_attempt_at, last_error, sent_at, created_at, updated_at
+		from mail_outbox where status = $1
+		order by created_at desc
+		limit $2
+`
+
+	rows, err := m.DB.QueryContext(ctx, query, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mails []models.OutboxMail
+	for rows.Next() {
+		var o models.OutboxMail
+		var sentAt sql.NullTime
+		err := rows.Scan(
+			&o.ID,
+			&o.Mail.From,
+			&o.Mail.To,
+			&o.Mail.Subject,
+			&o.Mail.Content,
+			&o.Mail.TextContent,
+			&o.Mail.Template,
+			&o.Status,
+			&o.Attempts,
+			&o.NextAttemptAt,
+			&o.LastError,
+			&sentAt,
+			&o.CreatedAt,
+			&o.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		o.SentAt = sentAt.Time
+		mails = append(mails, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return mails, nil
+}
+
+// CountMailByStatus returns how many mails of the outbox have each status
+func (m *postgresDBRepo) CountMailByStatus(ctx context.Context) (map[string]int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, "select status, count(id) from mail_outbox group by status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// ResendMail queues a mail of the outbox to be sent again right away
+func (m *postgresDBRepo) ResendMail(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `update mail_outbox set status = $1, attempts = 0, last_error = '', next_attempt_at = $2,
+			updated_at = $2 where id = $3 and status <> $4`
+
+	result, err := m.DB.ExecContext(ctx, query, models.MailPending, time.Now(), id, models.MailSending)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("mail %d not found or being sent", id)
+	}
+
+	return nil
+}
@@ -1,19 +1,37 @@
 package dbrepo
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
 	"errors"
-	"log"
 	"time"
 
+	"github.com/marcelofranco/webapp-go-demo/internal/logging"
 	"github.com/marcelofranco/webapp-go-demo/internal/models"
+	"github.com/marcelofranco/webapp-go-demo/internal/repository"
+	"github.com/marcelofranco/webapp-go-demo/internal/tokens"
 )
 
-func (m *testDBRepo) AllUsers() bool {
-	return true
+// Ping checks the database answers
+func (m *testDBRepo) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Stats returns the statistics of the connection pool
+func (m *testDBRepo) Stats() sql.DBStats {
+	return sql.DBStats{MaxOpenConnections: 10, OpenConnections: 2, InUse: 1, Idle: 1}
+}
+
+func (m *testDBRepo) AllUsers(ctx context.Context) bool {
+	return ctx.Err() == nil
 }
 
 // InsertReservation inserts a reservation into the database
-func (m *testDBRepo) InsertReservation(res models.Reservation) (int, error) {
+func (m *testDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
 	if res.RoomID == 2 {
 		return 0, errors.New("error insert reservation")
 	}
@@ -21,17 +39,43 @@ func (m *testDBRepo) InsertReservation(res models.Reservation) (int, error) {
 }
 
 // InsertRoomRestriction inserts a room restriction into the database
-func (m *testDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
+func (m *testDBRepo) InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if r.RoomID == 3 {
 		return errors.New("error insert room restriction")
 	}
 	return nil
 }
 
+// BookReservation checks availability and inserts the reservation and its room restriction
+func (m *testDBRepo) BookReservation(ctx context.Context, res models.Reservation, mails []models.MailData) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := testMailError(mails); err != nil {
+		return 0, err
+	}
+	switch res.RoomID {
+	case 2:
+		return 0, errors.New("error insert reservation")
+	case 3:
+		return 0, errors.New("error insert room restriction")
+	case 4:
+		return 0, repository.ErrRoomNotAvailable
+	default:
+		return 1, nil
+	}
+}
+
 // SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID, and false if no availability
-func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
+func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 	switch roomID {
-	case 2:
+	case 2, 4:
 		return false, nil
 	case 3:
 		return false, errors.New("error on search")
@@ -41,19 +85,22 @@ func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roo
 }
 
 // SearchAvailabilityForAllRooms returns a slice of available rooms, if any, for given date range
-func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+func (m *testDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	var rooms []models.Room
 
 	layout := "2006-01-02"
 	str := "2049-12-31"
 	t, err := time.Parse(layout, str)
 	if err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error(err.Error())
 	}
 
 	testDateToFail, err := time.Parse(layout, "2060-01-01")
 	if err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error(err.Error())
 	}
 
 	if start == testDateToFail {
@@ -64,44 +111,181 @@ func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]mode
 		return rooms, nil
 	}
 
-	room := models.Room{}
+	room := models.Room{
+		ID:           1,
+		RoomName:     "General's Quarters",
+		NightlyPrice: 12000,
+		MinNights:    1,
+	}
 	rooms = append(rooms, room)
 
 	return rooms, nil
 }
 
 // GetRoomByID gets a room by id
-func (m *testDBRepo) GetRoomByID(id int) (models.Room, error) {
+func (m *testDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Room{}, err
+	}
+	var room models.Room
+	// room 3 does not exist and room 4 is booked by everyone else first
+	if id == 3 || id > 4 {
+		return room, errors.New("cant find room")
+	}
+	room.ID = id
+	room.NightlyPrice = 12000
+	room.MinNights = 1
+	return room, nil
+}
+
+// GetRoomBySlug gets a room by its slug
+func (m *testDBRepo) GetRoomBySlug(ctx context.Context, slug string) (models.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Room{}, err
+	}
 	var room models.Room
-	if id > 2 {
+	switch slug {
+	case "generals-quarters":
+		room.ID = 1
+	case "majors-suite":
+		room.ID = 2
+	default:
 		return room, errors.New("cant find room")
 	}
+	room.RoomName = "General's Quarters"
+	room.Slug = slug
+	room.Capacity = 2
+	room.NightlyPrice = 12000
+	room.Photos = []string{"/static/images/generals-quarters.png"}
 	return room, nil
 }
 
+// InsertRoom inserts a room and its photos into the database
+func (m *testDBRepo) InsertRoom(ctx context.Context, room models.Room) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if room.RoomName == "Error" {
+		return 0, errors.New("error insert room")
+	}
+	return 3, nil
+}
+
+// UpdateRoom updates a room and replaces its photos
+func (m *testDBRepo) UpdateRoom(ctx context.Context, room models.Room) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if room.RoomName == "Error" {
+		return errors.New("error update room")
+	}
+	return nil
+}
+
+// DeleteRoom deletes a room
+func (m *testDBRepo) DeleteRoom(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if id == 2 {
+		return errors.New("room has reservations")
+	}
+	return nil
+}
+
+// GetSeasonsForRoom returns the seasonal rates of a room
+func (m *testDBRepo) GetSeasonsForRoom(ctx context.Context, roomID int) ([]models.Season, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if roomID == 2 {
+		return nil, errors.New("error getting seasons")
+	}
+
+	start, _ := time.Parse("2006-01-02", "2049-12-20")
+	end, _ := time.Parse("2006-01-02", "2049-12-31")
+
+	season := models.Season{
+		ID:           1,
+		RoomID:       roomID,
+		Name:         "Holidays",
+		StartDate:    start,
+		EndDate:      end,
+		NightlyPrice: 20000,
+		MinNights:    3,
+	}
+
+	return []models.Season{season}, nil
+}
+
+// InsertSeason inserts a seasonal rate for a room
+func (m *testDBRepo) InsertSeason(ctx context.Context, s models.Season) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if s.Name == "Error" {
+		return 0, errors.New("error inserting season")
+	}
+	return 2, nil
+}
+
+// DeleteSeason deletes a seasonal rate of a room
+func (m *testDBRepo) DeleteSeason(ctx context.Context, roomID, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if id == 2 {
+		return errors.New("error deleting season")
+	}
+	return nil
+}
+
 // GetUserByID returns a user by id
-func (m *testDBRepo) GetUserByID(id int) (models.User, error) {
-	var u models.User
+func (m *testDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return models.User{}, err
+	}
+	u := models.User{ID: id, Email: "john@smith.com", VerifiedAt: time.Now()}
 	if id == 2 {
 		return u, errors.New("invalid user")
 	}
 	if id == 3 {
 		u.Email = "noreservation@here.com"
 	}
+	if id == 4 {
+		u.Email = "unverified@here.com"
+		u.VerifiedAt = time.Time{}
+	}
+	if id == 5 {
+		u.Email = "locked@here.com"
+	}
 	return u, nil
 }
 
 // GetUserByEmail returns a user by id
-func (m *testDBRepo) GetUserByEmail(email string) (models.User, error) {
+func (m *testDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return models.User{}, err
+	}
 	var u models.User
 	if email == "test@here.com" {
 		return u, errors.New("email not exist")
 	}
+	if email == "john@smith.com" {
+		u.ID = 1
+	}
+	u.Email = email
+	if email != "unverified@here.com" {
+		u.VerifiedAt = time.Now()
+	}
 	return u, nil
 }
 
 // CreateUser updates a user in the database
-func (m *testDBRepo) CreateUser(u models.User) (int, error) {
+func (m *testDBRepo) CreateUser(ctx context.Context, u models.User) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
 	if u.FirstName == "Error" {
 		return 0, errors.New("error create user")
 	}
@@ -109,73 +293,417 @@ func (m *testDBRepo) CreateUser(u models.User) (int, error) {
 }
 
 // UpdateUser updates a user in the database
-func (m *testDBRepo) UpdateUser(u models.User) error {
+func (m *testDBRepo) UpdateUser(ctx context.Context, u models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if u.FirstName == "Error" {
+		return errors.New("error update user")
+	}
 	return nil
 }
 
 // Authenticate authenticates a user
-func (m *testDBRepo) Authenticate(email, testPassword string) (int, string, error) {
+func (m *testDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, "", err
+	}
 	if testPassword == "unauthorized" {
 		return 0, "unauthorized", errors.New("unauthorized")
 	}
 	return 1, "hashedPassword", nil
 }
 
+// UpdatePassword sets the password of a user and signs the user out of every session
+func (m *testDBRepo) UpdatePassword(ctx context.Context, userID int, password string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// CreatePasswordReset stores the hash of a password reset token of a user
+func (m *testDBRepo) CreatePasswordReset(ctx context.Context, userID int, tokenHash []byte, expiresAt time.Time) error {
+	return ctx.Err()
+}
+
+// VerifyEmail marks the email address of a user as verified
+func (m *testDBRepo) VerifyEmail(ctx context.Context, userID int, email string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if email != "unverified@here.com" {
+		return repository.ErrInvalidToken
+	}
+	return nil
+}
+
+// InsertAuthEvent adds an entry to the auth log
+func (m *testDBRepo) InsertAuthEvent(ctx context.Context, e models.AuthEvent) error {
+	return ctx.Err()
+}
+
+// RecentAuthEvents returns the latest entries of the auth log, newest first
+func (m *testDBRepo) RecentAuthEvents(ctx context.Context, limit int) ([]models.AuthEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return []models.AuthEvent{
+		{ID: 1, CreatedAt: time.Now(), Event: models.AuthSigninFailure, Email: "john@smith.com", IP: "192.0.2.1"},
+	}, nil
+}
+
+// CountSigninFailures returns the failed sign ins for an email address or an IP address since a time.
+// failing@here.com is one failure away from a lockout with the settings of the tests
+func (m *testDBRepo) CountSigninFailures(ctx context.Context, kind, key string, since time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if kind == models.LockoutEmail && key == "failing@here.com" {
+		return 2, nil
+	}
+	return 0, nil
+}
+
+// LockedUntil returns when the lockout of an email address or an IP address ends
+func (m *testDBRepo) LockedUntil(ctx context.Context, email, ip string) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+	if email == "locked@here.com" {
+		return time.Now().Add(10 * time.Minute), nil
+	}
+	return time.Time{}, nil
+}
+
+// InsertLockout locks an email address or an IP address out
+func (m *testDBRepo) InsertLockout(ctx context.Context, l models.Lockout) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// ActiveLockouts returns the lockouts which are not over nor lifted
+func (m *testDBRepo) ActiveLockouts(ctx context.Context) ([]models.Lockout, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return []models.Lockout{
+		{ID: 1, CreatedAt: time.Now(), Kind: models.LockoutEmail, Key: "locked@here.com", LockedUntil: time.Now().Add(10 * time.Minute)},
+	}, nil
+}
+
+// LiftLockout ends a lockout before its time
+func (m *testDBRepo) LiftLockout(ctx context.Context, id, liftedBy int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if id == 2 {
+		return errors.New("no such lockout")
+	}
+	return nil
+}
+
+// PasswordResetUserID returns the user of a password reset token which can still be used
+func (m *testDBRepo) PasswordResetUserID(ctx context.Context, tokenHash []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(tokenHash, tokens.Hash("valid-token")) {
+		return 0, repository.ErrInvalidToken
+	}
+	return 1, nil
+}
+
+// ResetPassword sets the password of the user of a password reset token
+func (m *testDBRepo) ResetPassword(ctx context.Context, tokenHash []byte, password string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(tokenHash, tokens.Hash("valid-token")) {
+		return 0, repository.ErrInvalidToken
+	}
+	return 1, nil
+}
+
 // AllReservations returns a slice of all reservations
-func (m *testDBRepo) AllReservations() ([]models.Reservation, error) {
-	var reservations []models.Reservation
-	return reservations, nil
+func (m *testDBRepo) AllReservations(ctx context.Context) ([]models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return []models.Reservation{guestReservation(5), guestReservation(7)}, nil
 }
 
-// AllNewReservations returns a slice of all reservations
-func (m *testDBRepo) AllNewReservations() ([]models.Reservation, error) {
+// AllNewReservations returns the reservations which are neither processed nor cancelled
+func (m *testDBRepo) AllNewReservations(ctx context.Context) ([]models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	var reservations []models.Reservation
 	return reservations, nil
 }
 
 // GetReservationByID returns one reservation by ID
-func (m *testDBRepo) GetReservationByID(id int) (models.Reservation, error) {
+func (m *testDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Reservation{}, err
+	}
 	var res models.Reservation
+	if id == 2 {
+		return res, errors.New("cant find reservation")
+	}
+	if id >= 5 {
+		return guestReservation(id), nil
+	}
+	res.RoomID = 1
+	res.FirstName = "John"
+	res.LastName = "Smith"
+	res.Email = "john@smith.com"
+	res.StartDate = time.Now()
+	res.EndDate = time.Now().Add(24 * time.Hour)
 	return res, nil
 }
 
+// guestReservation returns a reservation a month from now, made by a guest without an account.
+// The room of reservation 6 is taken by everyone else and reservation 7 is cancelled
+func guestReservation(id int) models.Reservation {
+	today := time.Now().Truncate(24 * time.Hour)
+	res := models.Reservation{
+		ID:               id,
+		FirstName:        "John",
+		LastName:         "Smith",
+		Email:            "john@smith.com",
+		StartDate:        today.AddDate(0, 0, 30),
+		EndDate:          today.AddDate(0, 0, 32),
+		RoomID:           1,
+		TotalPrice:       24000,
+		ConfirmationCode: "ABCD2345",
+	}
+	switch id {
+	case 6:
+		res.RoomID = 4
+	case 7:
+		res.CancelledAt = time.Now()
+	}
+	return res
+}
+
+// GetReservationByConfirmationCode returns the reservation with a confirmation code
+func (m *testDBRepo) GetReservationByConfirmationCode(ctx context.Context, code string) (models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Reservation{}, err
+	}
+	if code != "ABCD2345" {
+		return models.Reservation{}, errors.New("cant find reservation")
+	}
+	return guestReservation(5), nil
+}
+
+// GetReservationByAccessToken returns the reservation of the token mailed to the guest
+func (m *testDBRepo) GetReservationByAccessToken(ctx context.Context, tokenHash []byte) (models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Reservation{}, err
+	}
+	if !bytes.Equal(tokenHash, tokens.Hash("guest-token")) {
+		return models.Reservation{}, errors.New("cant find reservation")
+	}
+	return guestReservation(5), nil
+}
+
 // UpdateReservation updates a reservation in the database
-func (m *testDBRepo) UpdateReservation(u models.Reservation) error {
+func (m *testDBRepo) UpdateReservation(ctx context.Context, u models.Reservation) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if u.FirstName == "Error" {
+		return errors.New("error update reservation")
+	}
 	return nil
 }
 
 // DeleteReservation deletes one reservation by id
-func (m *testDBRepo) DeleteReservation(id int) error {
+func (m *testDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if id == 3 {
+		return errors.New("error delete reservation")
+	}
+	return nil
+}
+
+// ChangeReservationDates moves a reservation and its room restriction to new dates
+func (m *testDBRepo) ChangeReservationDates(ctx context.Context, res models.Reservation, mails []models.MailData) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := testMailError(mails); err != nil {
+		return err
+	}
+	if res.RoomID == 4 {
+		return repository.ErrRoomNotAvailable
+	}
+	if res.ID == 8 {
+		return repository.ErrReservationCancelled
+	}
 	return nil
 }
 
+// CancelReservation marks a reservation as cancelled and releases its room restriction
+func (m *testDBRepo) CancelReservation(ctx context.Context, id int, mails []models.MailData) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if id == 8 {
+		return repository.ErrReservationCancelled
+	}
+	return testMailError(mails)
+}
+
 // UpdateProcessedForReservation updates processed for a reservation by id
-func (m *testDBRepo) UpdateProcessedForReservation(id, processed int) error {
+func (m *testDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if id == 3 {
+		return errors.New("error update processed")
+	}
 	return nil
 }
 
-func (m *testDBRepo) AllRooms() ([]models.Room, error) {
+func (m *testDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	var rooms []models.Room
+	room := models.Room{
+		RoomName:     "General's Quarters",
+		Slug:         "generals-quarters",
+		Capacity:     2,
+		NightlyPrice: 12000,
+	}
+	room.ID = 1
+	rooms = append(rooms, room)
 	return rooms, nil
 }
 
 // GetRestrictionsForRoomByDate returns restrictions for a room by date range
-func (m *testDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+func (m *testDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	var restrictions []models.RoomRestriction
+
+	reservation := models.RoomRestriction{
+		StartDate:     start,
+		EndDate:       start.AddDate(0, 0, 2),
+		RoomID:        roomID,
+		ReservationID: 1,
+		RestrictionID: 1,
+	}
+	reservation.ID = 1
+
+	block := models.RoomRestriction{
+		StartDate:     start.AddDate(0, 0, 3),
+		EndDate:       start.AddDate(0, 0, 4),
+		RoomID:        roomID,
+		RestrictionID: 2,
+	}
+	block.ID = 2
+
+	// the last night of the month of start and the first one of the next
+	imported := models.RoomRestriction{
+		StartDate:      start.AddDate(0, 1, -1),
+		EndDate:        start.AddDate(0, 1, 1),
+		RoomID:         roomID,
+		RestrictionID:  2,
+		ExternalSource: "https://example.com/other-site.ics",
+	}
+	imported.ID = 3
+
+	restrictions = append(restrictions, reservation, block, imported)
 	return restrictions, nil
 }
 
 // InsertBlockForRoom inserts a room restriction
-func (m *testDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
+func (m *testDBRepo) InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if id == 2 {
+		return errors.New("error insert block")
+	}
 	return nil
 }
 
 // DeleteBlockByID deletes a room restriction
-func (m *testDBRepo) DeleteBlockByID(id int) error {
+func (m *testDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if id == 3 {
+		return errors.New("error delete block")
+	}
 	return nil
 }
 
-func (m *testDBRepo) GetReservationsByUser(email string) ([]models.Reservation, error) {
+// GetRoomByICalToken gets the room whose calendar feed has the token
+func (m *testDBRepo) GetRoomByICalToken(ctx context.Context, token string) (models.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Room{}, err
+	}
+	if token != "feed-token" {
+		return models.Room{}, errors.New("no room with this token")
+	}
+	return models.Room{ID: 1, RoomName: "General's Quarters", Slug: "generals-quarters", ICalToken: token}, nil
+}
+
+// SetRoomICalToken sets the token of the calendar feed of a room
+func (m *testDBRepo) SetRoomICalToken(ctx context.Context, roomID int, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if roomID == 2 {
+		return errors.New("error set ical token")
+	}
+	return nil
+}
+
+// SetRoomICalImportURL keeps the url of the calendar imported as blocks of a room
+func (m *testDBRepo) SetRoomICalImportURL(ctx context.Context, roomID int, url string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if roomID == 2 {
+		return errors.New("error set ical import url")
+	}
+	return nil
+}
+
+// SyncExternalBlocks adds every block, but the ones with the uid conflict which are returned as conflicts
+func (m *testDBRepo) SyncExternalBlocks(ctx context.Context, roomID int, source string, blocks []models.ExternalBlock) (models.CalendarSync, error) {
+	var sync models.CalendarSync
+	if err := ctx.Err(); err != nil {
+		return sync, err
+	}
+	if roomID == 2 {
+		return sync, errors.New("error sync blocks")
+	}
+	for _, b := range blocks {
+		if b.UID == "conflict" {
+			sync.Conflicts = append(sync.Conflicts, b)
+		} else {
+			sync.Added++
+		}
+	}
+	return sync, nil
+}
+
+func (m *testDBRepo) GetReservationsByUser(ctx context.Context, email string) ([]models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	var reservations []models.Reservation
 	if email == "noreservation@here.com" {
 		return reservations, errors.New("no reservations")
@@ -188,3 +716,81 @@ func (m *testDBRepo) GetReservationsByUser(email string) ([]models.Reservation,
 	reservations = append(reservations, reservation)
 	return reservations, nil
 }
+
+// EnqueueMail stores a mail in the outbox
+func (m *testDBRepo) EnqueueMail(ctx context.Context, mail models.MailData) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := testMailError([]models.MailData{mail}); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// testMailError fails to store the mails to outbox-error@here.com in the outbox
+func testMailError(mails []models.MailData) error {
+	for _, mail := range mails {
+		if mail.To == "outbox-error@here.com" {
+			return errors.New("error insert mail")
+		}
+	}
+	return nil
+}
+
+// ClaimMail returns the mails due for sending
+func (m *testDBRepo) ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMail, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// MarkMailSent records that a mail was sent
+func (m *testDBRepo) MarkMailSent(ctx context.Context, id int) error {
+	return ctx.Err()
+}
+
+// MarkMailFailed records a failed attempt to send a mail
+func (m *testDBRepo) MarkMailFailed(ctx context.Context, id int, lastError string, nextAttemptAt time.Time, dead bool) error {
+	return ctx.Err()
+}
+
+// GetMailByStatus returns the latest mails of the outbox with the given status
+func (m *testDBRepo) GetMailByStatus(ctx context.Context, status string, limit int) ([]models.OutboxMail, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mail := models.OutboxMail{
+		ID: 1,
+		Mail: models.MailData{
+			From:    "me@here.com",
+			To:      "john@smith.com",
+			Subject: "Reservation confirmation",
+		},
+		Status:    status,
+		Attempts:  8,
+		LastError: "connection refused",
+	}
+
+	return []models.OutboxMail{mail}, nil
+}
+
+// CountMailByStatus returns how many mails of the outbox have each status
+func (m *testDBRepo) CountMailByStatus(ctx context.Context) (map[string]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return map[string]int{models.MailSent: 10, models.MailDead: 1}, nil
+}
+
+// ResendMail queues a mail of the outbox to be sent again
+func (m *testDBRepo) ResendMail(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if id == 2 {
+		return errors.New("mail not found")
+	}
+	return nil
+}
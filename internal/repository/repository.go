@@ -1,35 +1,85 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/marcelofranco/webapp-go-demo/internal/models"
 )
 
+// ErrRoomNotAvailable is returned when the room got booked or blocked for the requested dates
+var ErrRoomNotAvailable = errors.New("room is not available for the requested dates")
+
+// ErrInvalidToken is returned for a token which does not exist, expired or was already used
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// ErrReservationCancelled is returned when the reservation got cancelled before it could be changed
+var ErrReservationCancelled = errors.New("reservation is cancelled")
+
 type DatabaseRepo interface {
-	AllUsers() bool
-
-	InsertReservation(res models.Reservation) (int, error)
-	InsertRoomRestriction(r models.RoomRestriction) error
-	SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error)
-	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
-	GetRoomByID(id int) (models.Room, error)
-
-	GetUserByID(id int) (models.User, error)
-	GetUserByEmail(email string) (models.User, error)
-	CreateUser(u models.User) (int, error)
-	UpdateUser(u models.User) error
-	Authenticate(email, testPassword string) (int, string, error)
-
-	AllReservations() ([]models.Reservation, error)
-	AllNewReservations() ([]models.Reservation, error)
-	GetReservationByID(id int) (models.Reservation, error)
-	GetReservationsByUser(email string) ([]models.Reservation, error)
-	UpdateReservation(u models.Reservation) error
-	DeleteReservation(id int) error
-	UpdateProcessedForReservation(id, processed int) error
-	AllRooms() ([]models.Room, error)
-	GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error)
-	InsertBlockForRoom(id int, startDate time.Time) error
-	DeleteBlockByID(id int) error
+	Ping(ctx context.Context) error
+	Stats() sql.DBStats
+
+	AllUsers(ctx context.Context) bool
+
+	InsertReservation(ctx context.Context, res models.Reservation) (int, error)
+	InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error
+	BookReservation(ctx context.Context, res models.Reservation, mails []models.MailData) (int, error)
+	SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error)
+	SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error)
+	GetRoomByID(ctx context.Context, id int) (models.Room, error)
+
+	GetUserByID(ctx context.Context, id int) (models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	CreateUser(ctx context.Context, u models.User) (int, error)
+	UpdateUser(ctx context.Context, u models.User) error
+	Authenticate(ctx context.Context, email, testPassword string) (int, string, error)
+	UpdatePassword(ctx context.Context, userID int, password string) (int, error)
+	CreatePasswordReset(ctx context.Context, userID int, tokenHash []byte, expiresAt time.Time) error
+	PasswordResetUserID(ctx context.Context, tokenHash []byte) (int, error)
+	ResetPassword(ctx context.Context, tokenHash []byte, password string) (int, error)
+	VerifyEmail(ctx context.Context, userID int, email string) error
+	InsertAuthEvent(ctx context.Context, e models.AuthEvent) error
+	RecentAuthEvents(ctx context.Context, limit int) ([]models.AuthEvent, error)
+	CountSigninFailures(ctx context.Context, kind, key string, since time.Time) (int, error)
+	LockedUntil(ctx context.Context, email, ip string) (time.Time, error)
+	InsertLockout(ctx context.Context, l models.Lockout) (int, error)
+	ActiveLockouts(ctx context.Context) ([]models.Lockout, error)
+	LiftLockout(ctx context.Context, id, liftedBy int) error
+
+	AllReservations(ctx context.Context) ([]models.Reservation, error)
+	AllNewReservations(ctx context.Context) ([]models.Reservation, error)
+	GetReservationByID(ctx context.Context, id int) (models.Reservation, error)
+	GetReservationByConfirmationCode(ctx context.Context, code string) (models.Reservation, error)
+	GetReservationByAccessToken(ctx context.Context, tokenHash []byte) (models.Reservation, error)
+	GetReservationsByUser(ctx context.Context, email string) ([]models.Reservation, error)
+	UpdateReservation(ctx context.Context, u models.Reservation) error
+	DeleteReservation(ctx context.Context, id int) error
+	ChangeReservationDates(ctx context.Context, res models.Reservation, mails []models.MailData) error
+	CancelReservation(ctx context.Context, id int, mails []models.MailData) error
+	UpdateProcessedForReservation(ctx context.Context, id, processed int) error
+	AllRooms(ctx context.Context) ([]models.Room, error)
+	GetRoomBySlug(ctx context.Context, slug string) (models.Room, error)
+	InsertRoom(ctx context.Context, room models.Room) (int, error)
+	UpdateRoom(ctx context.Context, room models.Room) error
+	DeleteRoom(ctx context.Context, id int) error
+	GetSeasonsForRoom(ctx context.Context, roomID int) ([]models.Season, error)
+	InsertSeason(ctx context.Context, s models.Season) (int, error)
+	DeleteSeason(ctx context.Context, roomID, id int) error
+	EnqueueMail(ctx context.Context, mail models.MailData) (int, error)
+	ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMail, error)
+	MarkMailSent(ctx context.Context, id int) error
+	MarkMailFailed(ctx context.Context, id int, lastError string, nextAttemptAt time.Time, dead bool) error
+	GetMailByStatus(ctx context.Context, status string, limit int) ([]models.OutboxMail, error)
+	CountMailByStatus(ctx context.Context) (map[string]int, error)
+	ResendMail(ctx context.Context, id int) error
+	GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error)
+	InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error
+	DeleteBlockByID(ctx context.Context, id int) error
+	GetRoomByICalToken(ctx context.Context, token string) (models.Room, error)
+	SetRoomICalToken(ctx context.Context, roomID int, token string) error
+	SetRoomICalImportURL(ctx context.Context, roomID int, url string) error
+	SyncExternalBlocks(ctx context.Context, roomID int, source string, blocks []models.ExternalBlock) (models.CalendarSync, error)
 }
@@ -0,0 +1,112 @@
+package sessionstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// PostgresStore keeps the sessions in the sessions table, so that they survive
+// a restart and are shared by every instance of the app
+type PostgresStore struct {
+	db     *sql.DB
+	logger *slog.Logger
+	stop   chan struct{}
+}
+
+// NewPostgres returns a store on db which deletes the expired sessions every
+// cleanupInterval, or never when it is 0, and logs the failures to do so with logger
+func NewPostgres(db *sql.DB, cleanupInterval time.Duration, logger *slog.Logger) *PostgresStore {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	p := &PostgresStore{
+		db:     db,
+		logger: logger,
+		stop:   make(chan struct{}),
+	}
+	if cleanupInterval > 0 {
+		go p.cleanup(cleanupInterval)
+	}
+	return p
+}
+
+// Find returns the data of a session which has not expired
+func (p *PostgresStore) Find(token string) ([]byte, bool, error) {
+	return p.FindCtx(context.Background(), token)
+}
+
+// FindCtx returns the data of a session which has not expired. The expiry is checked
+// against the clock of the app, which is the one that set it
+func (p *PostgresStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	var b []byte
+	var expiry time.Time
+
+	query := `select data, expiry from sessions where token = $1`
+	err := p.db.QueryRowContext(ctx, query, token).Scan(&b, &expiry)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !time.Now().Before(expiry) {
+		return nil, false, nil
+	}
+
+	return b, true, nil
+}
+
+// Commit adds or replaces a session
+func (p *PostgresStore) Commit(token string, b []byte, expiry time.Time) error {
+	return p.CommitCtx(context.Background(), token, b, expiry)
+}
+
+// CommitCtx adds or replaces a session
+func (p *PostgresStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	query := `insert into sessions (token, data, expiry) values ($1, $2, $3)
+			on conflict (token) do update set data = excluded.data, expiry = excluded.expiry`
+
+	_, err := p.db.ExecContext(ctx, query, token, b, expiry)
+	return err
+}
+
+// Delete removes a session
+func (p *PostgresStore) Delete(token string) error {
+	return p.DeleteCtx(context.Background(), token)
+}
+
+// DeleteCtx removes a session
+func (p *PostgresStore) DeleteCtx(ctx context.Context, token string) error {
+	_, err := p.db.ExecContext(ctx, `delete from sessions where token = $1`, token)
+	return err
+}
+
+// StopCleanup stops deleting the expired sessions
+func (p *PostgresStore) StopCleanup() {
+	close(p.stop)
+}
+
+// cleanup deletes the expired sessions every interval until StopCleanup
+func (p *PostgresStore) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.deleteExpired(); err != nil {
+				p.logger.Error("can't delete expired sessions", "error", err)
+			}
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *PostgresStore) deleteExpired() error {
+	_, err := p.db.Exec(`delete from sessions where expiry <= $1`, time.Now())
+	return err
+}
@@ -0,0 +1,219 @@
+package sessionstore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDriver is a connector keeping the sessions table in memory, answering the few statements the store runs
+type fakeDriver struct {
+	mu       sync.Mutex
+	sessions map[string]fakeSession
+}
+
+type fakeSession struct {
+	data   []byte
+	expiry time.Time
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error)             { return fakeConn{d}, nil }
+func (d *fakeDriver) Connect(context.Context) (driver.Conn, error) { return fakeConn{d}, nil }
+func (d *fakeDriver) Driver() driver.Driver                        { return d }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{c.d, strings.Join(strings.Fields(query), " ")}, nil
+}
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("no transactions") }
+
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(s.query, "insert into sessions"):
+		s.d.sessions[args[0].(string)] = fakeSession{data: args[1].([]byte), expiry: args[2].(time.Time)}
+	case s.query == "delete from sessions where token = $1":
+		delete(s.d.sessions, args[0].(string))
+	case s.query == "delete from sessions where expiry <= $1":
+		for token, session := range s.d.sessions {
+			if !session.expiry.After(args[0].(time.Time)) {
+				delete(s.d.sessions, token)
+			}
+		}
+	default:
+		return nil, errors.New("unexpected statement: " + s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if s.query != "select data, expiry from sessions where token = $1" {
+		return nil, errors.New("unexpected query: " + s.query)
+	}
+	rows := &fakeRows{}
+	if session, ok := s.d.sessions[args[0].(string)]; ok {
+		rows.values = [][]driver.Value{{session.data, session.expiry}}
+	}
+	return rows, nil
+}
+
+type fakeRows struct{ values [][]driver.Value }
+
+func (r *fakeRows) Columns() []string { return []string{"data", "expiry"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// newTestStore returns a store on an empty in-memory sessions table, without cleanup
+func newTestStore(t *testing.T) (*PostgresStore, *fakeDriver) {
+	d := &fakeDriver{sessions: map[string]fakeSession{}}
+	db := sql.OpenDB(d)
+	t.Cleanup(func() { db.Close() })
+
+	return NewPostgres(db, 0, nil), d
+}
+
+func TestPostgresStore_Find(t *testing.T) {
+	store, _ := newTestStore(t)
+
+	if err := store.Commit("live", []byte("data"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Commit("expired", []byte("data"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		wantFound bool
+	}{
+		{"live", "live", true},
+		{"expired", "expired", false},
+		{"unknown", "unknown", false},
+	}
+
+	for _, e := range tests {
+		b, found, err := store.Find(e.token)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+		}
+		if found != e.wantFound {
+			t.Errorf("%s: expected found %v but got %v", e.name, e.wantFound, found)
+		}
+		if found && string(b) != "data" {
+			t.Errorf("%s: expected data %q but got %q", e.name, "data", b)
+		}
+		if !found && b != nil {
+			t.Errorf("%s: expected no data but got %q", e.name, b)
+		}
+	}
+}
+
+func TestPostgresStore_Commit(t *testing.T) {
+	store, _ := newTestStore(t)
+
+	// committing again replaces the data and the expiry, which can bring an expired session back
+	if err := store.Commit("token", []byte("old"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Commit("token", []byte("new"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if b, found, _ := store.Find("token"); !found || string(b) != "new" {
+		t.Errorf("expected the new data but got %q, found %v", b, found)
+	}
+
+	if err := store.Commit("token", []byte("new"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := store.Find("token"); found {
+		t.Error("expected the session to expire when committed with an expiry in the past")
+	}
+}
+
+func TestPostgresStore_Delete(t *testing.T) {
+	store, _ := newTestStore(t)
+
+	if err := store.Commit("token", []byte("data"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("token"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := store.Find("token"); found {
+		t.Error("expected a deleted session not to be found")
+	}
+
+	// deleting a session which doesn't exist is not an error
+	if err := store.Delete("token"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestPostgresStore_deleteExpired(t *testing.T) {
+	store, d := newTestStore(t)
+
+	_ = store.Commit("live", []byte("data"), time.Now().Add(time.Hour))
+	_ = store.Commit("expired", []byte("data"), time.Now().Add(-time.Second))
+
+	if err := store.deleteExpired(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.sessions["expired"]; ok {
+		t.Error("expected the expired session to be deleted")
+	}
+	if _, ok := d.sessions["live"]; !ok {
+		t.Error("expected the live session to be kept")
+	}
+}
+
+func TestPostgresStore_cleanup(t *testing.T) {
+	d := &fakeDriver{sessions: map[string]fakeSession{}}
+	db := sql.OpenDB(d)
+	defer db.Close()
+
+	store := NewPostgres(db, time.Millisecond, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer store.StopCleanup()
+
+	_ = store.Commit("expired", []byte("data"), time.Now().Add(-time.Second))
+
+	for i := 0; i < 1000; i++ {
+		d.mu.Lock()
+		_, ok := d.sessions["expired"]
+		d.mu.Unlock()
+		if !ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Error("expected the cleanup to delete the expired session")
+}
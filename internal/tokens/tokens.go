@@ -0,0 +1,64 @@
+package tokens
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// New returns a random token to send to a user, and its hash to store in the
+// database, so that the tokens can't be used by someone who reads the database
+func New() (string, []byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, Hash(token), nil
+}
+
+// codeAlphabet leaves out the characters easily read as others, like 0 and O
+const codeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// NewCode returns a random code of n characters, short enough to be read over the phone
+func NewCode(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := make([]byte, n)
+	for i := range b {
+		// 256 is not a multiple of the alphabet size, the bias it adds is fine for a code
+		// which is always checked along with an email address
+		code[i] = codeAlphabet[int(b[i])%len(codeAlphabet)]
+	}
+	return string(code), nil
+}
+
+// Hash returns the hash a token is stored with
+func Hash(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// Sign returns the signature of a message with a secret key, to send in a link
+// along with the values the message is made of
+func Sign(key []byte, message string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify tells if a signature is the one of the message with the key
+func Verify(key []byte, message, signature string) bool {
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return hmac.Equal(sig, mac.Sum(nil))
+}
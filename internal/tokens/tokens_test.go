@@ -0,0 +1,67 @@
+package tokens
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	token, hash, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(token) != 43 {
+		t.Errorf("expected a token of 43 characters but got %q", token)
+	}
+	if !bytes.Equal(hash, Hash(token)) {
+		t.Error("expected the hash of the token")
+	}
+
+	other, _, _ := New()
+	if other == token {
+		t.Error("expected a different token each time")
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	key := []byte("secret")
+	sig := Sign(key, "verify-email:1:john@smith.com")
+
+	tests := []struct {
+		name      string
+		key       []byte
+		message   string
+		signature string
+		valid     bool
+	}{
+		{"valid", key, "verify-email:1:john@smith.com", sig, true},
+		{"other-message", key, "verify-email:1:jane@smith.com", sig, false},
+		{"other-key", []byte("other"), "verify-email:1:john@smith.com", sig, false},
+		{"truncated", key, "verify-email:1:john@smith.com", sig[:20], false},
+		{"not-base64", key, "verify-email:1:john@smith.com", "not base64!", false},
+	}
+
+	for _, e := range tests {
+		if Verify(e.key, e.message, e.signature) != e.valid {
+			t.Errorf("%s: expected valid to be %v", e.name, e.valid)
+		}
+	}
+}
+
+func TestNewCode(t *testing.T) {
+	code, err := NewCode(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(code) != 8 {
+		t.Errorf("expected a code of 8 characters but got %q", code)
+	}
+	for _, c := range code {
+		if !strings.ContainsRune(codeAlphabet, c) {
+			t.Errorf("unexpected character %q in %q", c, code)
+		}
+	}
+}
@@ -1,3 +1,3 @@
 #!/bin/bash
 
-go build -o webapp cmd/web/*.go && ./webapp
+go build -o webapp cmd/web/*.go && ./webapp migrate up && ./webapp
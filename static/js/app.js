@@ -151,13 +151,15 @@ function createReservationModal(room, csrf_token) {
                         attention.custom({
                             icon: 'success',
                             msg: '<p>Room is available</p>' +
+                                '<p>' + data.nights + ' nights for $' + (data.total_price / 100).toFixed(2) + '</p>' +
                                 '<p><a href="/book-room?id=' + data.room_id + '&s=' + data.start_date + '&e=' + data.end_date +
                                 '" class="btn btn-primary">Book now!</a></p>',
                             showConfirmButton: false,
                         })
                     } else {
                         attention.error({
-                            title: "No availability"
+                            title: data.fields ? "Check your dates" : "No availability",
+                            text: data.message,
                         });
                     }
                 })